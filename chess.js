@@ -35,6 +35,8 @@ function ChessGame(canvas, clocks, addr) {
     this.clocks = clocks;
     this.clocks_ctx = clocks.getContext("2d");
     this.color = 0;
+    this.free = false;
+    this.analyzing = false;
     this.turn = 0;
     this.board = [];
     this.sel = null;
@@ -89,13 +91,17 @@ function ChessGame(canvas, clocks, addr) {
     this.game.addEventListener('click', function(e) {
         _this.click(e)
     });
+    document.getElementById("analyze").addEventListener('click', function(e) {
+        e.preventDefault();
+        _this.toggleAnalysis();
+    });
 
     this.clocks_int = window.setInterval(function() {
         _this.tick();
     }, 1000);
 
     window.onbeforeunload = function(e) {
-        if (_this.color != 0) {
+        if (_this.color != 0 && !_this.free) {
             return "Leaving the page will cancel the current game.";
         }
     };
@@ -314,13 +320,19 @@ ChessGame.prototype.click = function(e) {
     var pos = y*8+x;
     var prev_sel = this.sel;
 
+    /* both sides can be moved while analyzing */
+    var color = this.color;
+    if (this.free) {
+        color = (this.turn % 2 == 1) ? WHITE : BLACK;
+    }
+
     /* process the mouse click */
     if (x < 0 || x > 7 || y < 0 || y > 7 || this.sel == pos) {
         this.sel = null;
-    } else if ((this.board[pos]&COLOR_MASK) == this.color) {
+    } else if ((this.board[pos]&COLOR_MASK) == color) {
         this.sel = pos;
         this.ws.send(JSON.stringify({cmd: "select", turn: this.turn, src: pos}));
-    } else if (this.sel != null && (this.turn % 2 == 1) == (this.color == WHITE)) {
+    } else if (this.sel != null && (this.turn % 2 == 1) == (color == WHITE)) {
         this.ws.send(JSON.stringify({cmd: "move", turn: this.turn, src: this.sel,
             dst: pos}));
         this.sel = null;
@@ -378,6 +390,10 @@ ChessGame.prototype.process = function(e) {
             document.getElementById("history").innerHTML +=
                 msg.History + " ";
         }
+        if (msg.Opening) {
+            document.getElementById("opening").innerHTML = msg.Opening;
+        }
+        document.getElementById("info").innerHTML = "";
     }
     else if (msg.cmd == "start") {
         document.getElementById("dlg-waiting").style.display = 'none';
@@ -397,6 +413,7 @@ ChessGame.prototype.process = function(e) {
         ];
         this.color = msg.color;
         this.turn = msg.turn;
+        this.gameId = msg.game;
         this.totalTime = msg.RemainingA;
         this.remainingA = msg.RemainingA;
         this.remainingB = msg.RemainingB;
@@ -405,9 +422,35 @@ ChessGame.prototype.process = function(e) {
     }
     else if (msg.cmd == "msg") {
         document.getElementById("result").innerHTML = msg.Text;
+        if (this.gameId) {
+            document.getElementById("export-pgn").href = "/game/" + this.gameId + ".pgn";
+            document.getElementById("export-gif").href = "/game/" + this.gameId + ".gif";
+            document.getElementById("export").style.display = "block";
+        }
         document.getElementById("dlg-result").style.display = "block";
         this.color = 0;
     }
+    else if (msg.cmd == "analysis") {
+        this.free = true;
+        this.color = msg.color;
+        this.turn = msg.turn;
+        this.renderBase();
+        this.renderClocks();
+        document.getElementById("analysis").style.display = "block";
+    }
+    else if (msg.cmd == "info" && msg.turn == this.turn && msg.Text) {
+        document.getElementById("info").innerHTML = msg.Text;
+    }
+    else if (msg.cmd == "info" && msg.turn == this.turn) {
+        var score = (msg.Score >= 0 ? "+" : "") + (msg.Score / 100).toFixed(2);
+        if (msg.TB) {
+            score = msg.TB;
+        } else if (msg.Mate != 0) {
+            score = "#" + msg.Mate;
+        }
+        document.getElementById("info").innerHTML = "depth " + msg.Depth +
+            ", " + score + "<br />" + msg.PV;
+    }
     else if (msg.cmd == "ping") {
         this.ws.send(JSON.stringify({cmd: "pong"}));
     }
@@ -419,8 +462,16 @@ ChessGame.prototype.process = function(e) {
     }
 }
 
+ChessGame.prototype.toggleAnalysis = function() {
+    this.analyzing = !this.analyzing;
+    this.ws.send(JSON.stringify({cmd: this.analyzing ? "analyze" : "stop"}));
+    document.getElementById("analyze").innerHTML =
+        this.analyzing ? "stop" : "start";
+    document.getElementById("dlg-result").style.display = "none";
+}
+
 ChessGame.prototype.tick = function() {
-    if (this.color != 0) {
+    if (this.color != 0 && !this.free) {
         if (this.turn%2 == 1) {
             this.remainingA -= 1000000000;
             if (this.remainingA < 0)
@@ -4,72 +4,801 @@
 package chess
 
 import (
-    "math"
+    "context"
     "math/rand"
+    "sync"
+    "sync/atomic"
+    "time"
 )
 
-func (b *Board) MoveAI() (src, dst Square) {
-    src, dst, _ = b.negaMax(4)
-    return
+// SearchLimits restricts the resources the AI may spend on a single move.
+// Zero values mean that the corresponding resource isn't limited. If no
+// limit is set at all, the search stops at defaultDepth.
+type SearchLimits struct {
+    Time      time.Duration // remaining time on the clock
+    Inc       time.Duration // increment added after each move
+    MovesToGo int           // moves until the next time control or 0
+    Nodes     int           // maximum number of nodes to visit
+    Depth     int           // maximum search depth in half-moves
+    Threads   int           // number of goroutines used for searching
+    MultiPV   int           // number of best lines to search, default 1
+    Infinite  bool          // search until cancelled, ignoring Depth
+
+    // Progress is called with the results of each completed iteration of
+    // the search, once for each line in MultiPV mode.
+    Progress func(Info)
+}
+
+const (
+    defaultDepth     = 4  // depth used if no limits are given
+    maxDepth         = 64 // hard limit for iterative deepening
+    defaultMovesToGo = 30 // expected number of moves in sudden death games
+    infinity         = 1 << 20
+
+    // Scores beyond mateBound announce a forced mate. A player who is mated
+    // at the given ply scores -infinity+ply, so that faster mates are
+    // preferred.
+    mateBound = infinity - 2*maxDepth
+
+    // Positions which are won according to the endgame tablebases score
+    // tbWin-ply, less than any mate but more than any evaluation. Scores
+    // beyond winBound depend on the ply.
+    tbWin    = mateBound - 2*maxDepth
+    winBound = tbWin - 2*maxDepth
+)
+
+// Selective search techniques. They are always enabled, except for
+// comparisons in tests.
+type technique uint8
+
+const (
+    nullMovePruning    technique = 1 << iota // pass to prove a cutoff
+    lateMoveReductions                       // search late quiet moves less deep
+    checkExtensions                          // search positions in check deeper
+    futilityPruning                          // skip quiet moves near the leaves
+    aspirationWindows                        // narrow root window
+)
+
+// Parameters of the selective search.
+const (
+    nullMoveDepth     = 3  // minimum depth for null-move pruning
+    nullMoveReduction = 2  // depth reduction of the null-move search (R)
+    lmrDepth          = 3  // minimum depth for late move reductions
+    lmrMoves          = 3  // number of moves which are never reduced
+    aspirationWindow  = 30 // initial half width of the aspiration window
+)
+
+// Quiet moves at depth 1 and 2 are skipped if the static evaluation plus
+// the margin doesn't exceed alpha.
+var futilityMargin = [3]int{0, 150, 350}
+
+// budget returns the amount of time which should be spent on the next move
+// or 0 if the time isn't limited.
+func (l SearchLimits) budget() time.Duration {
+    if l.Time <= 0 {
+        return 0
+    }
+    mtg := l.MovesToGo
+    if mtg <= 0 {
+        mtg = defaultMovesToGo
+    }
+    t := l.Time/time.Duration(mtg) + l.Inc*3/4
+    if t > l.Time/2 {
+        t = l.Time / 2
+    }
+    if t < time.Millisecond {
+        t = time.Millisecond
+    }
+    return t
+}
+
+// MoveAI searches the best move for the current player within the given
+// limits using the default engine. The search stops early if ctx is
+// cancelled.
+func (b *Board) MoveAI(ctx context.Context, limits SearchLimits) (
+    src, dst Square) {
+    m, _ := Engines[DefaultEngine].BestMove(ctx, b, limits)
+    return m.Src, m.Dst
+}
+
+// SearchEngine is the strongest built-in engine. It uses an alpha-beta
+// search with iterative deepening, a transposition table and a quiescence
+// search. The move of the last completed iteration is returned.
+type SearchEngine struct{}
+
+// BestMove implements Engine. The search runs on limits.Threads goroutines
+// and stops at the limits or as soon as ctx is cancelled.
+func (e SearchEngine) BestMove(ctx context.Context, b *Board,
+    limits SearchLimits) (Move, Info) {
+    s := newSearcher(ctx, limits)
+    s.game = b.gameKeys()
+    s.tt.newSearch()
+    m := s.searchParallel(&b.Position)
+    return m, s.info
+}
+
+// Analyze searches the position of b and returns the best limits.MultiPV
+// lines of the last completed iteration, ordered from the best to the
+// worst. The result is empty if the current player has no legal moves.
+func (e SearchEngine) Analyze(ctx context.Context, b *Board,
+    limits SearchLimits) []Info {
+    s := newSearcher(ctx, limits)
+    s.game = b.gameKeys()
+    s.tt.newSearch()
+    s.searchParallel(&b.Position)
+    return s.lines
+}
+
+// A searcher holds the state of a single alpha-beta search.
+type searcher struct {
+    ctx      context.Context
+    limits   SearchLimits
+    start    time.Time
+    deadline time.Time
+    nodes    int
+    stopped  bool
+    best     Move   // best move of the last completed iteration
+    info     Info   // statistics of the last completed iteration
+    lines    []Info // all lines of the last completed iteration
+    exclude  []Move // root moves which are skipped in MultiPV mode
+    seldepth int
+    tt       *TransTable
+    noise    int    // maximum random error added to evaluations
+    seed     uint64 // varies the noise between searches
+    rand     *rand.Rand
+    stop     *int32 // signals helpers to stop a parallel search
+    offset   int    // additional depth searched by helpers
+
+    // data for the move ordering
+    killers [maxDepth + 1][2]Move
+    counter [64][64]Move
+    history [2][64][64]int
+    path    [maxDepth + 1]Move // moves leading to the current node
+
+    // hash keys of the positions along the current path and of all
+    // positions of the game before the root, to detect repetitions
+    keys    [maxDepth + 1]uint64
+    game    []uint64
+    noOrder bool // disables the move ordering for comparisons
+
+    // endgame tablebases or nil, and their result for the root position
+    tb     *tablebases
+    tbRoot Info
+
+    disabled technique // selective techniques which aren't used
+
+    // triangular table of principal variations. pv[ply] contains the
+    // best line found from the node at the given ply.
+    pv    [maxDepth + 1][maxDepth + 1]Move
+    pvLen [maxDepth + 1]int
+}
+
+func newSearcher(ctx context.Context, limits SearchLimits) *searcher {
+    s := &searcher{ctx: ctx, limits: limits, start: time.Now(), tt: transTable,
+        tb: syzygy, rand: rand.New(rand.NewSource(rand.Int63()))}
+    if t := limits.budget(); t > 0 {
+        s.deadline = s.start.Add(t)
+    }
+    return s
+}
+
+// gameKeys returns the hash keys of all positions of the game before the
+// current one.
+func (b *Board) gameKeys() []uint64 {
+    keys, p := make([]uint64, len(b.hist)), b.start
+    for i, r := range b.hist {
+        keys[i] = p.Hash()
+        p.move(r.src, r.dst)
+    }
+    return keys
+}
+
+// search runs an iterative deepening search on the position p.
+func (s *searcher) search(p *Position) (best Move) {
+    depth := s.limits.Depth
+    if s.limits.Infinite {
+        depth = maxDepth
+    } else if depth <= 0 || depth > maxDepth {
+        depth = maxDepth
+        if s.limits.Time <= 0 && s.limits.Nodes <= 0 {
+            depth = defaultDepth
+        }
+    }
+
+    multiPV := s.limits.MultiPV
+    if multiPV < 1 {
+        multiPV = 1
+    }
+
+    // only the moves which keep the best result according to the
+    // tablebases are searched
+    s.best = Move{-1, -1}
+    skip := s.probeRoot(p)
+    for d := 1; d+s.offset <= depth; d++ {
+        lines := make([]Info, 0, multiPV)
+        s.exclude = append(s.exclude[:0], skip...)
+        for i := 0; i < multiPV; i++ {
+            // only a single line can be searched with a narrow window
+            aspire := multiPV == 1 && d > 1 && s.info.Score > -winBound &&
+                s.info.Score < winBound
+            m, score := s.searchRoot(p, d+s.offset, s.info.Score, aspire)
+            if s.stopped || m.Src < 0 {
+                break
+            }
+            lines = append(lines, s.lineInfo(d, score, i+1))
+            s.exclude = append(s.exclude, m)
+        }
+        if s.stopped || len(lines) == 0 {
+            break
+        }
+        // the selective search may rate later lines better than earlier ones
+        for i := 1; i < len(lines); i++ {
+            for j := i; j > 0 && lines[j].Score > lines[j-1].Score; j-- {
+                lines[j], lines[j-1] = lines[j-1], lines[j]
+            }
+        }
+        for i := range lines {
+            lines[i].MultiPV = i + 1
+        }
+        s.best, s.info, s.lines = lines[0].PV[0], lines[0], lines
+        if s.limits.Progress != nil {
+            for _, info := range lines {
+                s.limits.Progress(info)
+            }
+        }
+        // the next iteration is unlikely to finish in the remaining time
+        if !s.deadline.IsZero() &&
+            time.Since(s.start) > s.deadline.Sub(s.start)/2 {
+            break
+        }
+    }
+    if s.best.Src < 0 {
+        // not even the first iteration completed, so just pick any move
+        if moves := p.LegalMoves(); len(moves) > 0 {
+            s.best = moves[s.rand.Intn(len(moves))]
+        }
+    }
+    s.info.Nodes = s.nodes
+    s.info.Time = time.Since(s.start)
+    return s.best
 }
 
-func (b *Board) negaMax(depth int) (bsrc, bdst Square, max float64) {
-    if depth <= 0 {
-        max = b.evaluate()
+// searchRoot searches the root position. If aspire is set, the search
+// starts with a narrow window around the score of the previous iteration,
+// which is widened each time the result falls outside of it.
+func (s *searcher) searchRoot(p *Position, depth, prev int, aspire bool) (
+    Move, int) {
+    alpha, beta, delta := -infinity, infinity, aspirationWindow
+    if aspire && s.uses(aspirationWindows) {
+        alpha, beta = prev-delta, prev+delta
+    }
+    for {
+        m, score := s.negaMax(p, depth, 0, alpha, beta)
+        switch {
+        case s.stopped:
+            return m, score
+        case score <= alpha && alpha > -infinity:
+            alpha = score - delta
+        case score >= beta && beta < infinity:
+            beta = score + delta
+        default:
+            return m, score
+        }
+        delta *= 2
+        if alpha < -infinity {
+            alpha = -infinity
+        }
+        if beta > infinity {
+            beta = infinity
+        }
+    }
+}
+
+// uses checks if the selective search technique t is enabled.
+func (s *searcher) uses(t technique) bool {
+    return s.disabled&t == 0
+}
+
+// lineInfo collects the statistics and the principal variation of the
+// search which has just been completed.
+func (s *searcher) lineInfo(depth, score, rank int) Info {
+    info := Info{Depth: depth, SelDepth: s.seldepth, Score: score,
+        Nodes: s.nodes, Time: time.Since(s.start), MultiPV: rank}
+    info.PV = append([]Move(nil), s.pv[0][:s.pvLen[0]]...)
+    if info.Time > 0 {
+        info.NPS = int(int64(s.nodes) * int64(time.Second) / int64(info.Time))
+    }
+    if score > mateBound {
+        info.Mate = (infinity - score + 1) / 2
+    } else if score < -mateBound {
+        info.Mate = -(infinity + score) / 2
+    }
+    info.TB, info.WDL, info.DTZ = s.tbRoot.TB, s.tbRoot.WDL, s.tbRoot.DTZ
+    return info
+}
+
+// probeRoot looks up the root position in the endgame tablebases. If it's
+// contained, the moves which don't keep the best result are returned, so
+// that the search skips them. Wins are converted by the moves with the
+// lowest DTZ, so that the fifty-move rule can't interfere, and losses are
+// delayed as long as possible.
+func (s *searcher) probeRoot(p *Position) (skip []Move) {
+    s.tbRoot = Info{}
+    wdl, err := s.tb.probeWDL(p)
+    if err != nil {
+        return nil
+    }
+    dtz, err := s.tb.probeDTZ(p)
+    if err != nil {
+        return nil
+    }
+    moves := p.LegalMoves()
+    ranks, max := make([]int, len(moves)), -infinity
+    for i, m := range moves {
+        q := *p
+        q.move(m.Src, m.Dst)
+        s.keys[1] = q.Hash()
+        d := 0
+        switch {
+        case q.halfmove == 0:
+            v, err := s.tb.probeWDL(&q)
+            if err != nil {
+                return nil
+            }
+            d = dtzBeforeZeroing(-v)
+        case q.halfmove >= 100 || s.repetition(&q, 1):
+            // draw
+        default:
+            if d, err = s.tb.probeDTZ(&q); err != nil {
+                return nil
+            }
+            if d = -d; d > 0 {
+                d++
+            } else if d < 0 {
+                d--
+            }
+        }
+        if d == 2 && q.isCheck() && q.isStalemate() {
+            d = 1 // checkmate
+        }
+        switch {
+        case d > 0 && d+p.halfmove < 100:
+            ranks[i] = 1000 - d
+        case d < 0 && p.halfmove-d < 100:
+            ranks[i] = -1000 - d
+        }
+        if ranks[i] > max {
+            max = ranks[i]
+        }
+    }
+    for i, m := range moves {
+        if ranks[i] < max {
+            skip = append(skip, m)
+        }
+    }
+    s.tbRoot = Info{TB: true, WDL: wdl, DTZ: dtz}
+    return skip
+}
+
+// searchParallel runs the search on multiple goroutines (Lazy SMP). The
+// helpers share the transposition table with the main search, which can
+// reuse their results. Every second helper searches one ply deeper and the
+// random move order lets all of them explore different parts of the tree.
+// Only the move of the main search is returned.
+func (s *searcher) searchParallel(p *Position) Move {
+    if s.limits.Threads <= 1 {
+        return s.search(p)
+    }
+    var stop int32
+    var wg sync.WaitGroup
+    s.stop = &stop
+    helpers := make([]*searcher, s.limits.Threads-1)
+    for i := range helpers {
+        h := *s
+        h.rand = rand.New(rand.NewSource(s.rand.Int63()))
+        h.offset = i % 2
+        h.limits.Progress, h.limits.MultiPV = nil, 1
+        helpers[i] = &h
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            h.search(p)
+        }()
+    }
+    m := s.search(p)
+    atomic.StoreInt32(&stop, 1)
+    wg.Wait()
+    for _, h := range helpers {
+        s.info.Nodes += h.nodes
+    }
+    return m
+}
+
+// evaluate returns the static evaluation of p including some noise, if
+// the strength of the searcher is limited. The noise depends on the
+// position only, so that transpositions are evaluated consistently.
+func (s *searcher) evaluate(p *Position) int {
+    v := p.evaluate()
+    if s.noise > 0 {
+        v += int((p.Hash()^s.seed)%uint64(2*s.noise+1)) - s.noise
+    }
+    return v
+}
+
+// timeout checks if the search has exceeded its limits or was cancelled.
+func (s *searcher) timeout() bool {
+    if s.limits.Nodes > 0 && s.nodes >= s.limits.Nodes {
+        s.stopped = true
+    } else if s.nodes&1023 == 0 && ((s.stop != nil &&
+        atomic.LoadInt32(s.stop) != 0) || (!s.deadline.IsZero() &&
+        time.Now().After(s.deadline)) || s.ctx.Err() != nil) {
+        s.stopped = true
+    }
+    return s.stopped
+}
+
+// negaMax performs an alpha-beta search of the given depth. ply is the
+// distance to the root of the search. The returned score is only meaningful
+// if the search wasn't stopped.
+func (s *searcher) negaMax(p *Position, depth, ply int, alpha, beta int) (
+    best Move, max int) {
+    s.nodes++
+    s.pvLen[ply] = ply
+    if s.timeout() {
         return
     }
+    inCheck := p.isCheck()
+    if inCheck && s.uses(checkExtensions) {
+        // don't enter the quiescence search while in check
+        depth++
+    }
 
-    max = math.Inf(-1)
-    src := Square(rand.Intn(64))
-    for i := 0; i < 64; i++ {
-        src = (src + 1) % 64
-        if b.board[src]&ColorMask != b.color {
-            continue
+    // draws by the fifty-move rule or by repetition. A single repetition is
+    // enough, since the players could repeat the moves again.
+    key := p.Hash()
+    s.keys[ply] = key
+    if ply > 0 && ((p.halfmove >= 100 && !inCheck) || s.repetition(p, ply)) {
+        return Move{-1, -1}, 0
+    }
+    if depth <= 0 || ply >= maxDepth {
+        return Move{-1, -1}, s.quiesce(p, ply, alpha, beta)
+    }
+
+    // look for the results of previous searches. The stored move is tried
+    // first, since it's likely to be the best move again.
+    first := Move{-1, -1}
+    if e, ok := s.tt.probe(key); ok {
+        first = e.move()
+        if score := fromTT(int(e.score), ply); ply > 0 &&
+            int(e.depth) >= depth {
+            switch {
+            case e.bound == boundExact,
+                e.bound == boundLower && score >= beta,
+                e.bound == boundUpper && score <= alpha:
+                return first, score
+            }
         }
-        dst := Square(rand.Intn(64))
-        for j := 0; j < 64; j++ {
-            dst = (dst + 1) % 64
-            if b.mayMove(src, dst) {
+    }
 
-                piece, victim := b.board[src], b.board[dst]
-                b.board[dst], b.board[src] = piece, 0
-                b.occupied &^= Bitboard(1) << uint(src)
-                b.occupied |= Bitboard(1) << uint(dst)
+    // the tablebases know the exact result of positions with few pieces,
+    // but only right after a capture or pawn move the fifty-move counter
+    // can't change it
+    if ply > 0 && p.halfmove == 0 && s.tb != nil {
+        if wdl, err := s.tb.probeWDL(p); err == nil {
+            score := 0
+            if wdl == WDLWin {
+                score = tbWin - ply
+            } else if wdl == WDLLoss {
+                score = -tbWin + ply
+            }
+            s.tt.store(key, Move{-1, -1}, depth, toTT(score, ply), boundExact)
+            return Move{-1, -1}, score
+        }
+    }
+    if ply == 0 && s.best.Src >= 0 {
+        first = s.best
+    }
 
-                if !b.isCheck() {
-                    b.color ^= ColorMask
-                    _, _, score := b.negaMax(depth - 1)
-                    score = -score
-                    b.color ^= ColorMask
+    static := -infinity
+    if ply > 0 && !inCheck {
+        static = s.evaluate(p)
+    }
 
-                    if score > max {
-                        bsrc, bdst, max = src, dst, score
+    // null-move pruning: if passing still fails high, a real move would
+    // most likely fail high too. This doesn't hold in pawn endgames, where
+    // zugzwang is common, and two null moves in a row prove nothing.
+    if s.uses(nullMovePruning) && ply > 0 && depth >= nullMoveDepth &&
+        static >= beta && beta < mateBound && s.path[ply-1].Src >= 0 &&
+        !p.pawnEndgame() {
+        q := *p
+        q.nullMove()
+        s.path[ply] = Move{-1, -1}
+        _, score := s.negaMax(&q, depth-1-nullMoveReduction, ply+1, -beta,
+            -beta+1)
+        if s.stopped {
+            return
+        }
+        if -score >= beta {
+            return Move{-1, -1}, beta
+        }
+    }
+
+    // futility pruning: quiet moves near the leaves can't raise the score
+    // above alpha if the position is far behind.
+    futile := s.uses(futilityPruning) && depth < len(futilityMargin) &&
+        static > -infinity && static+futilityMargin[depth] <= alpha
+
+    alphaOrig := alpha
+    best, max = Move{-1, -1}, -infinity
+    moves := s.orderMoves(p, first, ply)
+    legal, searched := 0, 0
+    for i := range moves {
+        m := nextMove(moves, i)
+        q := *p
+        q.move(m.Src, m.Dst)
+        if q.inCheck(p.color) {
+            continue
+        }
+        if legal++; ply == 0 && s.excluded(m) {
+            continue
+        }
+
+        // moves which give check are neither pruned nor reduced
+        reduce := 0
+        if searched > 0 && !inCheck && p.quiet(m) {
+            switch {
+            case futile:
+                if !q.isCheck() {
+                    if static+futilityMargin[depth] > max {
+                        max = static + futilityMargin[depth]
                     }
+                    continue
                 }
-
-                b.board[src], b.board[dst] = piece, victim
-                b.occupied |= Bitboard(1) << uint(src)
-                if victim == 0 {
-                    b.occupied &^= Bitboard(1) << uint(dst)
+            case s.uses(lateMoveReductions) && depth >= lmrDepth &&
+                searched >= lmrMoves && moves[i].score < orderCounter &&
+                !q.isCheck():
+                reduce = 1
+                if searched >= 4*lmrMoves && depth > lmrDepth {
+                    reduce = 2
                 }
             }
         }
+
+        s.path[ply] = m
+        score := 0
+        if reduce > 0 {
+            // reduced search with a null window, repeated at full depth if
+            // the move turns out to be better than expected
+            _, score = s.negaMax(&q, depth-1-reduce, ply+1, -alpha-1, -alpha)
+            score = -score
+        }
+        if reduce == 0 || (score > alpha && !s.stopped) {
+            _, score = s.negaMax(&q, depth-1, ply+1, -beta, -alpha)
+            score = -score
+        }
+        searched++
+        if s.stopped {
+            return
+        }
+        if score > max {
+            best, max = m, score
+        }
+        if score > alpha {
+            alpha = score
+            s.pv[ply][ply] = m
+            copy(s.pv[ply][ply+1:], s.pv[ply+1][ply+1:s.pvLen[ply+1]])
+            s.pvLen[ply] = s.pvLen[ply+1]
+        }
+        if alpha >= beta {
+            s.cutoff(p, m, depth, ply)
+            break
+        }
+    }
+
+    if legal == 0 {
+        if inCheck {
+            return Move{-1, -1}, -infinity + ply
+        }
+        return Move{-1, -1}, 0 // stalemate
+    }
+
+    bound := uint8(boundExact)
+    if max <= alphaOrig {
+        bound = boundUpper
+    } else if max >= beta {
+        bound = boundLower
+    }
+    if ply > 0 || len(s.exclude) == 0 {
+        s.tt.store(key, best, depth, toTT(max, ply), bound)
     }
     return
 }
 
-func (b *Board) evaluate() float64 {
-    values := []float64{0, 1, 3, 3, 5, 9, 200}
-    score := 0.0
-    for p := Square(0); p < 64; p++ {
-        s := values[b.board[p]&PieceMask]
-        if (p>>3 == 0 || p>>3 == 7) && b.board[p]|PieceMask == P {
-            s = 9
+// repetition checks if the position at the given ply occurred before,
+// either earlier in the search or in the game. Only positions since the
+// last capture or pawn move can be equal.
+func (s *searcher) repetition(p *Position, ply int) bool {
+    for d := 2; d <= p.halfmove; d += 2 {
+        i := ply - d
+        var key uint64
+        if i >= 0 {
+            if s.path[i].Src < 0 || s.path[i+1].Src < 0 {
+                return false // positions before a null move don't count
+            }
+            key = s.keys[i]
+        } else if j := len(s.game) + i; j >= 0 {
+            key = s.game[j]
+        } else {
+            break
         }
-        if b.board[p]&ColorMask != b.color {
-            s = -s
+        if key == s.keys[ply] {
+            return true
         }
-        score += s
+    }
+    return false
+}
+
+// toTT converts a mate or tablebase score relative to the root into a
+// score relative to the node at the given ply, which is stored in the
+// transposition table. fromTT does the opposite.
+func toTT(score, ply int) int {
+    if score > winBound {
+        return score + ply
+    } else if score < -winBound {
+        return score - ply
+    }
+    return score
+}
+
+func fromTT(score, ply int) int {
+    if score > winBound {
+        return score - ply
+    } else if score < -winBound {
+        return score + ply
     }
     return score
 }
+
+// pawnEndgame checks if the player to move has only the king and pawns
+// left.
+func (p *Position) pawnEndgame() bool {
+    for sq := Square(0); sq < 64; sq++ {
+        piece := p.board[sq]
+        if piece&ColorMask == p.color && piece&PieceMask != P &&
+            piece&PieceMask != K {
+            return false
+        }
+    }
+    return true
+}
+
+// excluded checks if the root move m has already been searched as one of
+// the better lines in MultiPV mode.
+func (s *searcher) excluded(m Move) bool {
+    for _, e := range s.exclude {
+        if e == m {
+            return true
+        }
+    }
+    return false
+}
+
+// Margin for delta pruning. Captures which can't raise the score above
+// alpha, even with this additional positional gain, are skipped.
+const deltaMargin = 200
+
+// quiesce extends the search at the leaves by resolving all captures and
+// promotions, so that the evaluation isn't done in the middle of an exchange.
+// The side to move can always decline to capture (stand pat).
+func (s *searcher) quiesce(p *Position, ply, alpha, beta int) int {
+    s.nodes++
+    if ply > s.seldepth {
+        s.seldepth = ply
+    }
+    if s.timeout() {
+        return 0
+    }
+    standPat := s.evaluate(p)
+    if standPat >= beta {
+        return standPat
+    }
+    if standPat > alpha {
+        alpha = standPat
+    }
+
+    for _, m := range p.captures() {
+        gain := pieceValues[p.board[m.Dst]&PieceMask].mg
+        if p.board[m.Src]&PieceMask == P && (m.Dst>>3 == 0 || m.Dst>>3 == 7) {
+            gain += pieceValues[Q].mg - pieceValues[P].mg
+        }
+        if standPat+gain+deltaMargin < alpha || p.see(m) < 0 {
+            continue
+        }
+        q := *p
+        q.move(m.Src, m.Dst)
+        if q.inCheck(p.color) {
+            continue
+        }
+        score := -s.quiesce(&q, ply+1, -beta, -alpha)
+        if s.stopped {
+            return 0
+        }
+        if score >= beta {
+            return score
+        }
+        if score > alpha {
+            alpha = score
+        }
+    }
+    return alpha
+}
+
+// captures returns all pseudo-legal captures and promotions of the current
+// player, ordered by the most valuable victim and the least valuable
+// attacker (MVV-LVA).
+func (p *Position) captures() []Move {
+    moves := make([]Move, 0, 16)
+    for src := Square(0); src < 64; src++ {
+        if p.board[src]&ColorMask != p.color {
+            continue
+        }
+        pawn := p.board[src]&PieceMask == P
+        for dst := Square(0); dst < 64; dst++ {
+            if (p.board[dst] != 0 || (pawn && (dst == p.eps ||
+                dst>>3 == 0 || dst>>3 == 7))) && p.mayMove(src, dst) {
+                moves = append(moves, Move{src, dst})
+            }
+        }
+    }
+    order := func(m Move) int {
+        return 8*int(p.board[m.Dst]&PieceMask) - int(p.board[m.Src]&PieceMask)
+    }
+    for i := 1; i < len(moves); i++ {
+        for j := i; j > 0 && order(moves[j]) > order(moves[j-1]); j-- {
+            moves[j], moves[j-1] = moves[j-1], moves[j]
+        }
+    }
+    return moves
+}
+
+// randomMoves returns all pseudo-legal moves of the current player, starting
+// at a random square. The move first is put in front if it's contained.
+// Castling moves are only included if they are legal.
+func (p *Position) randomMoves(first Move, rnd *rand.Rand) []Move {
+    moves := make([]Move, 0, 48)
+    add := func(m Move) {
+        moves = append(moves, m)
+        if m == first {
+            moves[0], moves[len(moves)-1] = first, moves[0]
+        }
+    }
+    src := Square(rnd.Intn(64))
+    for i := 0; i < 64; i++ {
+        src = (src + 1) % 64
+        if p.board[src]&ColorMask != p.color {
+            continue
+        }
+        dst := Square(rnd.Intn(64))
+        for j := 0; j < 64; j++ {
+            dst = (dst + 1) % 64
+            if p.mayMove(src, dst) {
+                add(Move{src, dst})
+            }
+        }
+    }
+
+    // mayMove doesn't know about castling
+    home := Square(4)
+    if p.color == Black {
+        home = 60
+    }
+    if p.board[home] == K|p.color {
+        if p.canCastle(home, home+3) {
+            add(Move{home, home + 2})
+        }
+        if p.canCastle(home, home-4) {
+            add(Move{home, home - 2})
+        }
+    }
+    return moves
+}
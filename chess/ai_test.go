@@ -0,0 +1,424 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "context"
+    "math/rand"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestMoveAICapture(t *testing.T) {
+    // the black queen on d5 is hanging
+    b, err := ParseFEN("4k3/8/8/3q4/8/2N5/8/4K3 w - - 0 1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    src, dst := b.MoveAI(context.Background(), SearchLimits{Depth: 2})
+    if src != Sq("c3") || dst != Sq("d5") {
+        t.Errorf("expected Nxd5, got %v", Move{src, dst})
+    }
+}
+
+func TestMoveAILimits(t *testing.T) {
+    b := NewBoard()
+    start := time.Now()
+    src, dst := b.MoveAI(context.Background(), SearchLimits{Time: 300 * time.Millisecond})
+    if d := time.Since(start); d > 150*time.Millisecond {
+        t.Errorf("search took %v, which exceeds half of the remaining time", d)
+    }
+    if !b.Legal(Move{src, dst}) {
+        t.Errorf("illegal move %v", Move{src, dst})
+    }
+
+    s := newSearcher(context.Background(), SearchLimits{Nodes: 500})
+    m := s.search(&b.Position)
+    if s.nodes > 500 {
+        t.Errorf("search visited %d nodes, exceeding the limit of 500", s.nodes)
+    }
+    if !b.Legal(m) {
+        t.Errorf("illegal move %v", m)
+    }
+}
+
+func TestBudget(t *testing.T) {
+    tests := []struct {
+        limits SearchLimits
+        budget time.Duration
+    }{
+        {SearchLimits{}, 0},
+        {SearchLimits{Time: 30 * time.Second}, time.Second},
+        {SearchLimits{Time: 10 * time.Second, MovesToGo: 5}, 2 * time.Second},
+        {SearchLimits{Time: 10 * time.Second, MovesToGo: 1}, 5 * time.Second},
+        {SearchLimits{Time: 30 * time.Second, Inc: 4 * time.Second},
+            4 * time.Second},
+    }
+    for _, test := range tests {
+        if b := test.limits.budget(); b != test.budget {
+            t.Errorf("budget(%+v) = %v, want %v", test.limits, b, test.budget)
+        }
+    }
+}
+
+func TestTransTable(t *testing.T) {
+    tt := NewTransTable(1)
+    if len(tt.slots) != 1<<16 {
+        t.Errorf("expected %d entries, got %d", 1<<16, len(tt.slots))
+    }
+    key := uint64(0x1234)
+    tt.store(key, Move{Sq("e2"), Sq("e4")}, 5, 50, boundExact)
+    tt.store(key, Move{Sq("d2"), Sq("d4")}, 3, 150, boundLower)
+    if e, ok := tt.probe(key); !ok || e.depth != 5 ||
+        e.move() != (Move{Sq("e2"), Sq("e4")}) {
+        t.Errorf("deeper entry was replaced by a shallower one: %+v", e)
+    }
+    if _, ok := tt.probe(key + tt.mask + 1); ok {
+        t.Errorf("probe returned an entry for a different key")
+    }
+    tt.newSearch()
+    tt.store(key, Move{Sq("d2"), Sq("d4")}, 3, 150, boundLower)
+    if e, ok := tt.probe(key); !ok || e.depth != 3 {
+        t.Errorf("outdated entry wasn't replaced: %+v", e)
+    }
+}
+
+func TestTransTableNodes(t *testing.T) {
+    b, err := ParseFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    s := newSearcher(context.Background(), SearchLimits{Depth: 4})
+    s.tt = NewTransTable(1)
+    s.search(&b.Position)
+    with := s.nodes
+
+    s = newSearcher(context.Background(), SearchLimits{Depth: 4})
+    s.tt = NewTransTable(0)
+    s.search(&b.Position)
+    if with >= s.nodes {
+        t.Errorf("transposition table didn't reduce the number of nodes: %d >= %d",
+            with, s.nodes)
+    }
+}
+
+// Tactical test positions in the Extended Position Description (EPD)
+// format. "bm" lists the best move and "am" a move which must be avoided.
+var tactics = []string{
+    `4k3/8/8/3q4/8/2N5/8/4K3 w - - bm Nxd5; id "hanging queen";`,
+    `4k3/8/4p3/3p4/8/8/8/3QK3 w - - am Qxd5; id "defended pawn";`,
+    `3k4/3n4/8/8/8/8/8/3QK3 w - - am Qxd7+; id "defended by the king";`,
+    `4k3/8/3p4/4p3/8/8/8/4RK2 w - - am Rxe5; id "defended pawn";`,
+    `2r1k3/1P6/8/8/8/8/8/4K3 w - - bm bxc8=Q+; id "promotion";`,
+    `4k3/8/8/8/8/8/1p1K4/8 b - - bm b1=Q; id "promotion before Kc2";`,
+    `4k3/8/8/1b6/8/3P4/2N5/4K3 w - - am d4; id "discovered attack";`,
+    `8/8/8/N7/8/3k2N1/1P6/R3K1B1 w Q - bm 0-0-0#; id "castling mate";`,
+}
+
+func TestTactics(t *testing.T) {
+    for _, epd := range tactics {
+        fields := strings.Fields(epd)
+        b, err := ParseFEN(strings.Join(fields[:4], " ") + " 0 1")
+        if err != nil {
+            t.Fatal(err)
+        }
+        ops := strings.Join(fields[4:], " ")
+        for _, depth := range []int{1, 2, 3} {
+            src, dst := b.MoveAI(context.Background(), SearchLimits{Depth: depth})
+            c := *b
+            c.Move(src, dst)
+            move := c.LastMove()
+            for _, op := range strings.Split(ops, ";") {
+                op = strings.TrimSpace(op)
+                switch {
+                case strings.HasPrefix(op, "bm ") && op[3:] != move:
+                    t.Errorf("%s: expected %s at depth %d, got %s",
+                        ops, op[3:], depth, move)
+                case strings.HasPrefix(op, "am ") && op[3:] == move:
+                    t.Errorf("%s: played %s at depth %d", ops, move, depth)
+                }
+            }
+        }
+    }
+}
+
+func TestRandomMoves(t *testing.T) {
+    rnd := rand.New(rand.NewSource(1))
+    for _, fen := range []string{
+        "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1",
+        "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1",
+        "r3k2r/8/8/8/8/8/8/R3K2R w Kq - 0 1",
+        "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+        "r3k2r/8/8/8/8/8/5r2/R3K2R w KQkq - 0 1",
+        "r3k2r/8/8/8/8/8/8/R3K1R1 w Qkq - 0 1",
+    } {
+        b, _ := ParseFEN(fen)
+        legal := 0
+        for _, m := range b.randomMoves(Move{-1, -1}, rnd) {
+            q := b.Position
+            q.move(m.Src, m.Dst)
+            if q.inCheck(b.color) {
+                continue
+            }
+            if !b.Legal(m) {
+                t.Errorf("%s: illegal move %v", fen, m)
+            }
+            legal++
+        }
+        if n := len(b.LegalMoves()); legal != n {
+            t.Errorf("%s: generated %d legal moves, want %d", fen, legal, n)
+        }
+    }
+}
+
+func TestSearchParallel(t *testing.T) {
+    b, _ := ParseFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+    s := newSearcher(context.Background(), SearchLimits{Depth: 3, Threads: 4})
+    s.tt = NewTransTable(1)
+    m := s.searchParallel(&b.Position)
+    if !b.Legal(m) {
+        t.Errorf("illegal move %v", m)
+    }
+    if s.info.Depth != 3 {
+        t.Errorf("expected depth 3, got %d", s.info.Depth)
+    }
+}
+
+func TestPrincipalVariation(t *testing.T) {
+    b, _ := ParseFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+    var progress []Info
+    m, info := SearchEngine{}.BestMove(context.Background(), b,
+        SearchLimits{Depth: 4, Progress: func(info Info) {
+            progress = append(progress, info)
+        }})
+    if len(info.PV) == 0 || info.PV[0] != m {
+        t.Fatalf("principal variation %v doesn't start with %v", info.PV, m)
+    }
+    p := b.Position
+    for _, m := range info.PV {
+        if !containsMove(p.LegalMoves(), m) {
+            t.Fatalf("illegal move %v in principal variation %v", m, info.PV)
+        }
+        p = p.Apply(m)
+    }
+    if info.SelDepth < info.Depth {
+        t.Errorf("selective depth %d is lower than depth %d",
+            info.SelDepth, info.Depth)
+    }
+    if len(progress) != 4 {
+        t.Fatalf("expected 4 progress reports, got %d", len(progress))
+    }
+    for i, p := range progress {
+        if p.Depth != i+1 || p.MultiPV != 1 {
+            t.Errorf("unexpected progress report %+v", p)
+        }
+    }
+}
+
+func TestMultiPV(t *testing.T) {
+    b := NewBoard()
+    lines := SearchEngine{}.Analyze(context.Background(), b,
+        SearchLimits{Depth: 3, MultiPV: 3})
+    if len(lines) != 3 {
+        t.Fatalf("expected 3 lines, got %d", len(lines))
+    }
+    for i, line := range lines {
+        if line.MultiPV != i+1 {
+            t.Errorf("line %d has rank %d", i+1, line.MultiPV)
+        }
+        if len(line.PV) == 0 || !b.Legal(line.PV[0]) {
+            t.Fatalf("invalid principal variation %v", line.PV)
+        }
+        for j := 0; j < i; j++ {
+            if lines[j].PV[0] == line.PV[0] {
+                t.Errorf("lines %d and %d start with the same move", j+1, i+1)
+            }
+        }
+        if i > 0 && line.Score > lines[i-1].Score {
+            t.Errorf("line %d scores better than line %d", i+1, i)
+        }
+    }
+
+    // Kb1 is the only legal move
+    b, _ = ParseFEN("7k/8/8/8/8/8/6q1/K7 w - - 0 1")
+    if lines = (SearchEngine{}).Analyze(context.Background(), b,
+        SearchLimits{Depth: 2, MultiPV: 5}); len(lines) != 1 {
+        t.Errorf("expected 1 line, got %d", len(lines))
+    }
+}
+
+func TestSelectiveSearch(t *testing.T) {
+    all := nullMovePruning | lateMoveReductions | checkExtensions |
+        futilityPruning | aspirationWindows
+    nodes := func(disabled technique) (n int) {
+        for _, fen := range orderingPositions {
+            b, _ := ParseFEN(fen)
+            s := newSearcher(context.Background(), SearchLimits{Depth: 4})
+            s.tt, s.disabled = NewTransTable(4), disabled
+            if m := s.search(&b.Position); !b.Legal(m) {
+                t.Errorf("illegal move %v", m)
+            }
+            n += s.nodes
+        }
+        return
+    }
+    if selective, full := nodes(0), nodes(all); selective >= full/2 {
+        t.Errorf("the selective search didn't reduce the number of nodes: "+
+            "%d >= %d/2", selective, full)
+    }
+
+    // a quiet move mates, which must not be pruned
+    b, _ := ParseFEN("6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1")
+    for _, disabled := range []technique{0, all} {
+        s := newSearcher(context.Background(), SearchLimits{Depth: 3})
+        s.tt, s.disabled = NewTransTable(1), disabled
+        if m := s.search(&b.Position); m != (Move{Sq("a1"), Sq("a8")}) {
+            t.Errorf("expected Ra8#, got %v (disabled %d)", m, disabled)
+        }
+    }
+}
+
+func TestNullMove(t *testing.T) {
+    b, _ := ParseFEN("4k3/8/8/8/3pP3/8/8/4K3 b - e3 0 1")
+    q := b.Position
+    q.nullMove()
+    if q.color != White || q.eps != -1 || q.Hash() == b.Hash() {
+        t.Errorf("unexpected position after a null move: %v", q)
+    }
+    if !b.pawnEndgame() {
+        t.Errorf("expected a pawn endgame")
+    }
+
+    // only the player to move counts
+    b, _ = ParseFEN("8/8/8/8/8/1k6/p7/K7 w - - 0 1")
+    if q := b.Apply(Move{Sq("a1"), Sq("b1")}); !q.pawnEndgame() {
+        t.Errorf("expected a pawn endgame")
+    }
+    if b, _ = ParseFEN("4k3/8/8/8/8/8/4P3/3NK3 w - - 0 1"); b.pawnEndgame() {
+        t.Errorf("the knight wasn't noticed")
+    }
+}
+
+// Positions with a forced mate in the given number of moves. The AI has
+// to find the shortest one.
+var mates = []struct {
+    fen string
+    n   int
+}{
+    {"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", 1},
+    {"r1b2k1r/ppp1bppp/8/1B1Q4/5q2/2P5/PPP2PPP/R3R1K1 w - - 1 1", 2},
+    {"6k1/8/6K1/8/8/8/8/1R6 w - - 0 1", 1},
+    {"7k/8/5K2/8/8/8/8/6R1 w - - 0 1", 2},
+}
+
+func TestMateInN(t *testing.T) {
+    for _, test := range mates {
+        b, _ := ParseFEN(test.fen)
+        m, info := SearchEngine{}.BestMove(context.Background(), b,
+            SearchLimits{Depth: 2*test.n + 1})
+        if info.Mate != test.n || info.Score != infinity-(2*test.n-1) {
+            t.Errorf("%s: expected mate in %d, got %d (score %d)", test.fen,
+                test.n, info.Mate, info.Score)
+        }
+        if test.n == 1 {
+            if q := b.Apply(m); !q.Checkmate() {
+                t.Errorf("%s: %v doesn't mate", test.fen, m)
+            }
+        }
+    }
+
+    // Kh7 is forced and followed by Rh1#
+    b, _ := ParseFEN("7k/5K2/8/8/8/8/8/6R1 b - - 0 1")
+    if _, info := (SearchEngine{}).BestMove(context.Background(), b,
+        SearchLimits{Depth: 3}); info.Mate != -1 || info.Score != -infinity+2 {
+        t.Errorf("expected to be mated in 1, got %+v", info)
+    }
+}
+
+func TestStalemate(t *testing.T) {
+    // most queen moves stalemate, but Qf1# and Qa8# mate
+    b, _ := ParseFEN("8/8/8/8/8/Q7/5K1p/7k w - - 0 1")
+    for depth := 1; depth <= 4; depth++ {
+        m, _ := SearchEngine{}.BestMove(context.Background(), b,
+            SearchLimits{Depth: depth})
+        if q := b.Apply(m); !q.Checkmate() {
+            t.Errorf("depth %d: %v doesn't mate", depth, m)
+        }
+    }
+
+    // a stalemated player scores a draw, a mated one loses
+    s := newSearcher(context.Background(), SearchLimits{})
+    b, _ = ParseFEN("k7/2Q5/1K6/8/8/8/8/8 b - - 0 1")
+    if _, score := s.negaMax(&b.Position, 1, 1, -infinity, infinity); score != 0 {
+        t.Errorf("expected 0 for stalemate, got %d", score)
+    }
+    b, _ = ParseFEN("k7/1Q6/1K6/8/8/8/8/8 b - - 0 1")
+    if _, score := s.negaMax(&b.Position, 1, 1, -infinity, infinity); score != -infinity+1 {
+        t.Errorf("expected %d for checkmate, got %d", -infinity+1, score)
+    }
+}
+
+func TestDraws(t *testing.T) {
+    // white is a queen up, but every move reaches the fifty-move limit
+    b, _ := ParseFEN("7k/8/8/8/8/8/8/1Q5K w - - 99 80")
+    if _, info := (SearchEngine{}).BestMove(context.Background(), b,
+        SearchLimits{Depth: 3}); info.Score != 0 {
+        t.Errorf("expected a draw by the fifty-move rule, got %d", info.Score)
+    }
+
+    // the knights return to their initial squares
+    b = NewBoard()
+    for _, mv := range strings.Fields("Nf3 Nf6 Ng1 Ng8") {
+        b.MoveSAN(mv)
+    }
+    s := newSearcher(context.Background(), SearchLimits{})
+    s.game, s.keys[0] = b.gameKeys(), b.Hash()
+    if !s.repetition(&b.Position, 0) {
+        t.Errorf("repetition not detected")
+    }
+    b = NewBoard()
+    b.MoveSAN("Nf3")
+    s.game, s.keys[0] = b.gameKeys(), b.Hash()
+    if s.repetition(&b.Position, 0) {
+        t.Errorf("unexpected repetition")
+    }
+
+    // black is lost, but Ka8 repeats the initial position
+    b, _ = ParseFEN("k7/8/8/8/8/8/8/KQ6 w - - 0 1")
+    for _, mv := range strings.Fields("Qb3 Ka7 Qb1") {
+        if err := b.MoveSAN(mv); err != nil {
+            t.Fatal(err)
+        }
+    }
+    m, info := SearchEngine{}.BestMove(context.Background(), b,
+        SearchLimits{Depth: 3})
+    if m != (Move{Sq("a7"), Sq("a8")}) || info.Score != 0 {
+        t.Errorf("expected a draw by repetition, got %v %+v", m, info)
+    }
+}
+
+func containsMove(moves []Move, m Move) bool {
+    for _, x := range moves {
+        if x == m {
+            return true
+        }
+    }
+    return false
+}
+
+// benchmarkThreads measures the time to reach a fixed depth using the given
+// number of goroutines.
+func benchmarkThreads(b *testing.B, threads int) {
+    board, _ := ParseFEN("r1bq1rk1/pp2bppp/2n1pn2/3p4/2PP4/2N2N2/PP2BPPP/R2QKB1R w KQ - 0 1")
+    for i := 0; i < b.N; i++ {
+        s := newSearcher(context.Background(), SearchLimits{Depth: 4, Threads: threads})
+        s.tt = NewTransTable(16)
+        s.searchParallel(&board.Position)
+    }
+}
+
+func BenchmarkSearch1(b *testing.B) { benchmarkThreads(b, 1) }
+func BenchmarkSearch2(b *testing.B) { benchmarkThreads(b, 2) }
+func BenchmarkSearch4(b *testing.B) { benchmarkThreads(b, 4) }
@@ -47,3 +47,86 @@ func TestKasparovsImmortal(t *testing.T) {
         35. Qb2+ Kd1 36. Bf1 Rd2 37. Rd7 Rxd7 38. Bxc4 bxc4 39. Qxh8
         Rd3 40. Qa8 c3 41. Qa4+ Ke1 42. f4 f5 43. Kc1 Rd2 44. Qa7`)
 }
+
+func TestFEN(t *testing.T) {
+    b := NewBoard()
+    for _, mv := range []string{"e4", "c5", "Nf3"} {
+        if err := b.MoveSAN(mv); err != nil {
+            t.Fatalf("the move %q failed: %v", mv, err)
+        }
+    }
+    want := "rnbqkbnr/pp1ppppp/8/2p5/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2"
+    if got := b.String(); got != want {
+        t.Errorf("unexpected FEN. want=%q, got=%q", want, got)
+    }
+
+    for _, fen := range []string{
+        want,
+        "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+        "r3k2r/8/8/8/8/8/8/R3K2R w Kq - 12 40",
+        "8/8/8/4k3/8/8/8/4K3 w - - 0 1",
+    } {
+        b, err := ParseFEN(fen)
+        if err != nil {
+            t.Errorf("ParseFEN(%q) failed: %v", fen, err)
+        } else if b.String() != fen {
+            t.Errorf("FEN round trip failed. want=%q, got=%q", fen, b)
+        }
+    }
+
+    for _, fen := range []string{
+        "", "8/8/8/8/8/8/8/8 w - - 0 1", "rnbqkbnr/pppppppp/8/8 w",
+        "rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+        "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1",
+    } {
+        if _, err := ParseFEN(fen); err == nil {
+            t.Errorf("ParseFEN(%q) should fail", fen)
+        }
+    }
+}
+
+func TestHash(t *testing.T) {
+    play := func(moves string) *Board {
+        b := NewBoard()
+        for _, mv := range strings.Fields(moves) {
+            if err := b.MoveSAN(mv); err != nil {
+                t.Fatalf("the move %q failed: %v", mv, err)
+            }
+        }
+        return b
+    }
+    tests := []struct {
+        a, b  string
+        equal bool
+    }{
+        {"Nf3 Nf6 Ng1 Ng8", "", true},
+        {"d4 Nf6 c4 e6", "c4 e6 d4 Nf6", true},
+        {"e4 e5", "e3 e6 e4 e5", true},
+        {"Nf3 Nf6 Ng1 Ng8", "Nf3", false},
+        {"e4 e6 e5 d5", "e4 d6 e5 d5", false},
+        {"Nf3 Nf6 Rg1 Ng8 Rh1 Nf6 Ng1 Ng8", "", false},
+    }
+    for _, test := range tests {
+        a, b := play(test.a), play(test.b)
+        if (a.Hash() == b.Hash()) != test.equal {
+            t.Errorf("unexpected hash for %q and %q: equal=%v", test.a,
+                test.b, !test.equal)
+        }
+    }
+}
+
+func TestClone(t *testing.T) {
+    b := NewBoard()
+    b.MoveSAN("e4")
+    b.MoveSAN("e5")
+    b.MoveSAN("Nf3")
+    c := b.Clone()
+    b.MoveSAN("Nc6")
+    c.MoveSAN("Nf6")
+    if h := strings.Join(b.History(SAN), " "); h != "e4 e5 Nf3 Nc6" {
+        t.Errorf("original board has history %q", h)
+    }
+    if h := strings.Join(c.History(SAN), " "); h != "e4 e5 Nf3 Nf6" {
+        t.Errorf("cloned board has history %q", h)
+    }
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "bytes"
+    "context"
+    "encoding/binary"
+    "math/rand"
+    "sort"
+    "strings"
+    "testing"
+)
+
+type testEntry struct {
+    moves  string // moves leading to the position
+    move   uint16
+    weight uint16
+}
+
+// polyglotMove encodes a move in the Polyglot format.
+func polyglotMove(src, dst string, promote uint16) uint16 {
+    return promote<<12 | uint16(Sq(src))<<6 | uint16(Sq(dst))
+}
+
+func writeBook(t *testing.T, entries []testEntry) []byte {
+    type raw struct {
+        key          uint64
+        move, weight uint16
+    }
+    var raws []raw
+    for _, e := range entries {
+        b := NewBoard()
+        for _, mv := range strings.Fields(e.moves) {
+            if err := b.MoveSAN(mv); err != nil {
+                t.Fatal(err)
+            }
+        }
+        raws = append(raws, raw{b.Position.polyglotKey(), e.move, e.weight})
+    }
+    sort.Slice(raws, func(i, j int) bool { return raws[i].key < raws[j].key })
+    buf := &bytes.Buffer{}
+    for _, r := range raws {
+        binary.Write(buf, binary.BigEndian, r.key)
+        binary.Write(buf, binary.BigEndian, r.move)
+        binary.Write(buf, binary.BigEndian, r.weight)
+        binary.Write(buf, binary.BigEndian, uint32(0))
+    }
+    return buf.Bytes()
+}
+
+func TestBook(t *testing.T) {
+    data := writeBook(t, []testEntry{
+        {"", polyglotMove("e2", "e4", 0), 3},
+        {"", polyglotMove("d2", "d4", 0), 1},
+        {"", polyglotMove("e2", "e5", 0), 100}, // illegal
+        {"e4 e5 Nf3 Nc6 Bc4 Bc5", polyglotMove("e1", "h1", 0), 1},
+        {"a4 h5 a5 h4 a6 h3 axb7 hxg2", polyglotMove("b7", "a8", 1), 1},
+    })
+    book, err := ReadBook(bytes.NewReader(data))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    b := NewBoard()
+    moves := book.Lookup(b)
+    if len(moves) != 2 {
+        t.Fatalf("expected two book moves, got %v", moves)
+    }
+    count := map[Move]int{}
+    rnd := rand.New(rand.NewSource(1))
+    for i := 0; i < 1000; i++ {
+        m, ok := book.Pick(b, rnd)
+        if !ok {
+            t.Fatal("no book move in the initial position")
+        }
+        count[m]++
+    }
+    if n := count[Move{Sq("e2"), Sq("e4")}]; n < 650 || n > 850 {
+        t.Errorf("1.e4 was picked %d out of 1000 times", n)
+    }
+
+    for _, mv := range strings.Fields("e4 e5 Nf3 Nc6 Bc4 Bc5") {
+        b.MoveSAN(mv)
+    }
+    if m, ok := book.Pick(b, rnd); !ok || m != (Move{Sq("e1"), Sq("g1")}) {
+        t.Errorf("expected castling, got %v", m)
+    }
+
+    // underpromotions aren't supported
+    b = NewBoard()
+    for _, mv := range strings.Fields("a4 h5 a5 h4 a6 h3 axb7 hxg2") {
+        b.MoveSAN(mv)
+    }
+    if m, ok := book.Pick(b, rnd); ok {
+        t.Errorf("expected no book move, got %v", m)
+    }
+
+    // the engine falls back to the search after leaving the book
+    e := BookEngine{Book: book, Engine: GreedyEngine{}}
+    if m, _ := e.BestMove(context.Background(), b, SearchLimits{}); !b.Legal(m) {
+        t.Errorf("illegal fallback move %v", m)
+    }
+
+    if _, err := ReadBook(bytes.NewReader(data[:20])); err != ErrInvalidBook {
+        t.Errorf("expected ErrInvalidBook, got %v", err)
+    }
+}
+
+// TestPolyglotKey checks the hash keys with the examples from the Polyglot
+// specification.
+func TestPolyglotKey(t *testing.T) {
+    tests := []struct {
+        moves string
+        key   uint64
+    }{
+        {"", 0x463b96181691fc9c},
+        {"e4", 0x823c9b50fd114196},
+        {"e4 d5", 0x0756b94461c50fb0},
+        {"e4 d5 e5", 0x662fafb965db29d4},
+        {"e4 d5 e5 f5", 0x22a48b5a8e47ff78},
+        {"e4 d5 e5 f5 Ke2", 0x652a607ca3f242c1},
+        {"e4 d5 e5 f5 Ke2 Kf7", 0x00fdd303c946bdd9},
+        {"a4 b5 h4 b4 c4", 0x3c8123ea7b067637},
+        {"a4 b5 h4 b4 c4 bxc3 Ra3", 0x5c3f9b829b279560},
+    }
+    for _, test := range tests {
+        b := NewBoard()
+        for _, mv := range strings.Fields(test.moves) {
+            if err := b.MoveSAN(mv); err != nil {
+                t.Fatal(err)
+            }
+        }
+        if key := b.Position.polyglotKey(); key != test.key {
+            t.Errorf("key after %q = %016x, want %016x", test.moves, key,
+                test.key)
+        }
+    }
+}
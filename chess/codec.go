@@ -0,0 +1,202 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "encoding/binary"
+    "errors"
+)
+
+// The binary encoding of a position consists of the following fields:
+//
+//     8 bytes    bitboard of all occupied squares (big endian)
+//     n/2 bytes  one nibble for each of the n pieces, ordered by square
+//     1 byte     side to move (bit 0) and castling rights (bits 1-4)
+//     1 byte     en passant target square or 0xff
+//     2 bytes    halfmove clock (big endian)
+//     2 bytes    number of half-moves played (big endian)
+//
+// Each nibble stores the piece kind and has the 4th bit set for black
+// pieces. A position with all 32 pieces requires 30 bytes.
+//
+// Games are encoded as a single flag byte, followed by the start position
+// (prefixed by its length) if the game didn't start from the initial
+// position, and one byte for each half-move. The byte is the index of the
+// move in the list of legal moves, as generated by LegalMoves.
+
+// ErrInvalidEncoding is returned if binary data can not be decoded.
+var ErrInvalidEncoding = errors.New("chess: invalid binary encoding")
+
+// ErrUnknownMove is returned if a game can't be encoded, because one of
+// its moves isn't legal.
+var ErrUnknownMove = errors.New("chess: move not in the list of legal moves")
+
+// flag which marks games with a custom start position
+const customStart = 0x01
+
+// Sizes of encoded positions with two kings and with all 32 pieces.
+const (
+    minPositionSize = 8 + 1 + 6
+    maxPositionSize = 8 + 16 + 6
+)
+
+// MarshalBinary encodes the position in a compact binary format.
+func (p Position) MarshalBinary() ([]byte, error) {
+    data := make([]byte, 8, 30)
+    binary.BigEndian.PutUint64(data, uint64(p.occupied))
+    nibble := false
+    for sq := Square(0); sq < 64; sq++ {
+        piece := p.board[sq]
+        if piece == 0 {
+            continue
+        }
+        v := piece & PieceMask
+        if piece&ColorMask == Black {
+            v |= 0x8
+        }
+        if nibble {
+            data[len(data)-1] |= v
+        } else {
+            data = append(data, v<<4)
+        }
+        nibble = !nibble
+    }
+
+    flags := p.castling() << 1
+    if p.color == Black {
+        flags |= 1
+    }
+    eps := byte(0xff)
+    if p.eps >= 0 {
+        eps = byte(p.eps)
+    }
+    data = append(data, flags, eps, 0, 0, 0, 0)
+    binary.BigEndian.PutUint16(data[len(data)-4:], uint16(p.halfmove))
+    binary.BigEndian.PutUint16(data[len(data)-2:], uint16(p.ply))
+    return data, nil
+}
+
+// UnmarshalBinary decodes a position which was encoded with MarshalBinary.
+// This is the only method which modifies the position it's called on.
+func (p *Position) UnmarshalBinary(data []byte) error {
+    if len(data) < 8 {
+        return ErrInvalidEncoding
+    }
+    q := Position{occupied: Bitboard(binary.BigEndian.Uint64(data))}
+    n := 0
+    for b := q.occupied; b != 0; b &= b - 1 {
+        n++
+    }
+    if n > 32 || len(data) != 8+(n+1)/2+6 {
+        return ErrInvalidEncoding
+    }
+
+    kings, i := [2]int{}, 0
+    for sq := Square(0); sq < 64; sq++ {
+        if q.occupied&(1<<uint(sq)) == 0 {
+            continue
+        }
+        v := data[8+i/2] >> 4
+        if i%2 == 1 {
+            v = data[8+i/2] & 0xf
+        }
+        if v&PieceMask == 0 || v&PieceMask > K {
+            return ErrInvalidEncoding
+        }
+        q.board[sq] = v&PieceMask | White
+        if v&0x8 != 0 {
+            q.board[sq] = v&PieceMask | Black
+        }
+        if v&PieceMask == K {
+            kings[q.board[sq]>>4]++
+        }
+        i++
+    }
+    if kings[0] != 1 || kings[1] != 1 {
+        return ErrInvalidEncoding
+    }
+
+    data = data[8+(n+1)/2:]
+    if data[0]>>5 != 0 {
+        return ErrInvalidEncoding
+    }
+    q.color = White
+    if data[0]&1 != 0 {
+        q.color = Black
+    }
+    q.moved = movedSquares(data[0] >> 1)
+    q.moved = movedSquares(q.castling())
+    q.eps = Square(data[1])
+    if data[1] == 0xff {
+        q.eps = -1
+    } else if data[1] >= 64 {
+        return ErrInvalidEncoding
+    }
+    q.halfmove = int(binary.BigEndian.Uint16(data[2:]))
+    q.ply = int(binary.BigEndian.Uint16(data[4:]))
+    q.check, q.stalemate = q.isCheck(), q.isStalemate()
+    *p = q
+    return nil
+}
+
+// MarshalBinary encodes the start position and all moves of the game using
+// approximately one byte per half-move. ErrUnknownMove is returned if the
+// history contains a move which isn't legal.
+func (b *Board) MarshalBinary() ([]byte, error) {
+    data := []byte{0}
+    if b.start != NewBoard().Position {
+        start, _ := b.start.MarshalBinary()
+        data[0] |= customStart
+        data = append(data, byte(len(start)))
+        data = append(data, start...)
+    }
+    p := b.start
+    for _, r := range b.hist {
+        m, found := Move{r.src, r.dst}, false
+        for i, legal := range p.LegalMoves() {
+            if legal == m {
+                data, found = append(data, byte(i)), true
+                break
+            }
+        }
+        if !found {
+            return nil, ErrUnknownMove
+        }
+        p.move(m.Src, m.Dst)
+    }
+    return data, nil
+}
+
+// UnmarshalBinary replays a game which was encoded with MarshalBinary.
+func (b *Board) UnmarshalBinary(data []byte) error {
+    if len(data) == 0 || data[0]&^customStart != 0 {
+        return ErrInvalidEncoding
+    }
+    c := NewBoard()
+    if data[0]&customStart != 0 {
+        if len(data) < 2 {
+            return ErrInvalidEncoding
+        }
+        n := 2 + int(data[1])
+        if n < 2+minPositionSize || n > 2+maxPositionSize || len(data) < n {
+            return ErrInvalidEncoding
+        }
+        if err := c.start.UnmarshalBinary(data[2:n]); err != nil {
+            return err
+        }
+        c.Position = c.start
+        data = data[n:]
+    } else {
+        data = data[1:]
+    }
+    for _, i := range data {
+        moves := c.LegalMoves()
+        if int(i) >= len(moves) {
+            return ErrInvalidEncoding
+        }
+        c.Move(moves[i].Src, moves[i].Dst)
+    }
+    *b = *c
+    return nil
+}
@@ -0,0 +1,104 @@
+package chess
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestPositionEncoding(t *testing.T) {
+    for _, fen := range []string{
+        "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+        "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+        "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w Kq - 3 17",
+        "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 99 150",
+        "7k/8/8/8/8/8/8/K7 b - - 0 80",
+    } {
+        p, err := ParsePosition(fen)
+        if err != nil {
+            t.Fatal(err)
+        }
+        data, err := p.MarshalBinary()
+        if err != nil {
+            t.Fatal(err)
+        }
+        if len(data) > 30 {
+            t.Errorf("encoding of %q is too long: %d bytes", fen, len(data))
+        }
+        var q Position
+        if err := q.UnmarshalBinary(data); err != nil {
+            t.Errorf("UnmarshalBinary(%q) failed: %v", fen, err)
+        } else if q != p {
+            t.Errorf("round trip failed. want=%q, got=%q", p, q)
+        }
+    }
+
+    var p Position
+    for _, data := range [][]byte{nil, make([]byte, 8), make([]byte, 30)} {
+        if err := p.UnmarshalBinary(data); err == nil {
+            t.Errorf("UnmarshalBinary(%v) should fail", data)
+        }
+    }
+}
+
+func TestGameEncoding(t *testing.T) {
+    games := []struct {
+        fen   string
+        moves string
+    }{
+        {"", `e4 d6 d4 Nf6 Nc3 g6 Be3 Bg7 Qd2 c6 f3 b5 Nge2 Nbd7 Bh6 Bxh6
+            Qxh6 Bb7 a3 e5 0-0-0 Qe7 Kb1 a6 Nc1 0-0-0 Nb3 exd4 Rxd4 c5 Rd1
+            Nb6 g3 Kb8 Na5 Ba8 Bh3 d5 Qf4+ Ka7 Rhe1 d4 Nd5 Nbxd5 exd5 Qd6`},
+        {"8/P6k/8/8/8/8/6p1/K7 w - - 0 1", "a8=Q g1=Q+ Ka2 Qg2+"},
+        {"", ""},
+    }
+    for _, game := range games {
+        b := NewBoard()
+        if game.fen != "" {
+            var err error
+            if b, err = ParseFEN(game.fen); err != nil {
+                t.Fatal(err)
+            }
+        }
+        for _, mv := range strings.Fields(game.moves) {
+            if err := b.MoveSAN(mv); err != nil {
+                t.Fatalf("the move %q failed: %v", mv, err)
+            }
+        }
+        data, err := b.MarshalBinary()
+        if err != nil {
+            t.Fatal(err)
+        }
+        if game.fen == "" && len(data) != len(b.hist)+1 {
+            t.Errorf("unexpected encoding size %d for %d moves", len(data),
+                len(b.hist))
+        }
+        c := &Board{}
+        if err := c.UnmarshalBinary(data); err != nil {
+            t.Fatalf("UnmarshalBinary failed: %v", err)
+        }
+        if c.Position != b.Position || c.start != b.start ||
+            strings.Join(c.History(SAN), " ") != strings.Join(b.History(SAN), " ") {
+            t.Errorf("round trip failed. want=%q, got=%q", b.History(SAN),
+                c.History(SAN))
+        }
+    }
+
+    if err := (&Board{}).UnmarshalBinary([]byte{0, 20}); err == nil {
+        t.Errorf("UnmarshalBinary should fail for invalid move indices")
+    }
+    // the length of the start position must not overflow
+    for _, n := range []int{0, 14, 31, 254, 255} {
+        data := make([]byte, 300)
+        data[0], data[1] = customStart, byte(n)
+        if err := (&Board{}).UnmarshalBinary(data); err != ErrInvalidEncoding {
+            t.Errorf("start position of length %d: got %v", n, err)
+        }
+    }
+
+    b := NewBoard()
+    b.MoveSAN("e4")
+    b.hist[0].dst = Sq("e5")
+    if _, err := b.MarshalBinary(); err != ErrUnknownMove {
+        t.Errorf("MarshalBinary should fail for illegal moves, got %v", err)
+    }
+}
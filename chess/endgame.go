@@ -0,0 +1,843 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "bufio"
+    "compress/gzip"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "strings"
+)
+
+// An EndgameTable contains the result and the distance to mate of every
+// position with a material of three or four pieces, e.g. KQvK or KBNvK.
+// The tables are generated by retrograde analysis, starting at all mates
+// and working backwards, so unlike the Syzygy tablebases (see ProbeWDL)
+// they don't need to be downloaded. The fifty-move rule is ignored and
+// all promotions are considered, although the AI only plays queen
+// promotions.
+//
+// Every position is indexed by the squares of its pieces, the side to move
+// and, if both sides have pawns, a flag for possible en passant captures.
+// The table stores a single byte per index: positive values are the number
+// of half-moves to mate, negative values -n-1 mean that the player to move
+// is mated after n half-moves and zero is a draw. Identical pieces and
+// symmetric positions are stored multiple times, so four piece tables use
+// about 32 MB, or 64 MB with en passant flags.
+type EndgameTable struct {
+    name   string  // material, e.g. "KQvK"
+    pieces []uint8 // pieces of the index, white ones first
+    ep     bool    // positions with en passant captures are stored too
+    dtm    []int8
+}
+
+// Limits of the endgame tables.
+const (
+    egMinPieces = 3
+    egMaxPieces = 4
+    egMaxDTM    = 126 // maximum number of half-moves to mate
+)
+
+// ErrDistanceToMate is returned if a mate takes longer than supported.
+var ErrDistanceToMate = errors.New("chess: distance to mate too long")
+
+// ErrInvalidEndgameTable is returned if a file isn't a valid endgame table.
+var ErrInvalidEndgameTable = errors.New("chess: invalid endgame table")
+
+// GenerateEndgames generates the endgame tables of the given materials,
+// like "KQK", "KRvK" or "KPvKP". The tables of all endgames which can
+// arise by captures and promotions are generated first. Tables with four
+// pieces take about a minute, or several minutes if pawns are involved.
+func GenerateEndgames(materials ...string) ([]*EndgameTable, error) {
+    g := &egGenerator{tables: make(map[string]*EndgameTable)}
+    tables := make([]*EndgameTable, len(materials))
+    for i, m := range materials {
+        name, err := parseMaterial(m)
+        if err != nil {
+            return nil, err
+        }
+        if tables[i], err = g.generate(name); err != nil {
+            return nil, err
+        }
+    }
+    return tables, nil
+}
+
+// ReadEndgameTable reads a table which was written by WriteTo.
+func ReadEndgameTable(r io.Reader) (*EndgameTable, error) {
+    z, err := gzip.NewReader(r)
+    if err != nil {
+        return nil, ErrInvalidEndgameTable
+    }
+    defer z.Close()
+    br := bufio.NewReader(z)
+    name, err := br.ReadString('\n')
+    if err != nil {
+        return nil, ErrInvalidEndgameTable
+    }
+    name = strings.TrimSuffix(name, "\n")
+    if canonical, err := parseMaterial(name); err != nil || canonical != name {
+        return nil, ErrInvalidEndgameTable
+    }
+    t := newEndgameTable(name)
+    data, err := ioutil.ReadAll(br)
+    if err != nil {
+        return nil, err
+    }
+    if len(data) != len(t.dtm) {
+        return nil, ErrInvalidEndgameTable
+    }
+    for i, v := range data {
+        t.dtm[i] = int8(v)
+    }
+    return t, nil
+}
+
+// WriteTo writes the gzip compressed table to w.
+func (t *EndgameTable) WriteTo(w io.Writer) (int64, error) {
+    cw := &countingWriter{w: w}
+    z := gzip.NewWriter(cw)
+    data := make([]byte, len(t.dtm))
+    for i, v := range t.dtm {
+        data[i] = byte(v)
+    }
+    if _, err := io.WriteString(z, t.name+"\n"); err != nil {
+        return cw.n, err
+    }
+    if _, err := z.Write(data); err != nil {
+        return cw.n, err
+    }
+    err := z.Close()
+    return cw.n, err
+}
+
+type countingWriter struct {
+    w io.Writer
+    n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+    n, err := w.w.Write(p)
+    w.n += int64(n)
+    return n, err
+}
+
+// Material returns the material of the table, e.g. "KQvK".
+func (t *EndgameTable) Material() string {
+    return t.name
+}
+
+// Probe looks up the current position of b. It returns the result with
+// perfect play from the point of view of the player to move and the number
+// of half-moves until mate, which is 0 for draws and if the player is
+// already mated. ErrNotInTablebases is returned if the material doesn't
+// match or castling is still possible.
+func (t *EndgameTable) Probe(b *Board) (WDL, int, error) {
+    if b.castling() != 0 {
+        return WDLDraw, 0, ErrNotInTablebases
+    }
+    var p egPos
+    for sq := 0; sq < 64; sq++ {
+        if piece := b.board[sq]; piece != 0 {
+            if p.n == egMaxPieces {
+                return WDLDraw, 0, ErrNotInTablebases
+            }
+            p.pieces[p.n], p.sqs[p.n] = piece, sq
+            p.n++
+        }
+    }
+    p.stm, p.ep = b.color, b.epCapture()
+    white, black := p.signature(White), p.signature(Black)
+    var idx int
+    switch {
+    case t.name == white+"v"+black:
+        idx = t.index(&p, false)
+    case t.name == black+"v"+white:
+        idx = t.index(&p, true)
+    default:
+        return WDLDraw, 0, ErrNotInTablebases
+    }
+    switch v := int(t.dtm[idx]); {
+    case v > 0:
+        return WDLWin, v, nil
+    case v < 0:
+        return WDLLoss, -v - 1, nil
+    }
+    return WDLDraw, 0, nil
+}
+
+// parseMaterial checks the material given like "KQK" or "KQvK" and returns
+// its canonical name, which starts with the stronger side.
+func parseMaterial(m string) (string, error) {
+    sides := strings.Split(m, "v")
+    if len(sides) == 1 {
+        if i := strings.LastIndex(m, "K"); i > 0 {
+            sides = []string{m[:i], m[i:]}
+        }
+    }
+    if len(sides) != 2 {
+        return "", fmt.Errorf("chess: invalid material %q", m)
+    }
+    n := 0
+    for i, side := range sides {
+        var count [7]int
+        for _, r := range side {
+            piece := strings.IndexRune(" PNBRQK", r)
+            if piece <= 0 {
+                return "", fmt.Errorf("chess: invalid material %q", m)
+            }
+            count[piece]++
+            n++
+        }
+        if count[K] != 1 {
+            return "", fmt.Errorf("chess: invalid material %q", m)
+        }
+        sides[i] = countSignature(&count)
+    }
+    if n < egMinPieces || n > egMaxPieces {
+        return "", fmt.Errorf("chess: endgame tables need %d to %d pieces",
+            egMinPieces, egMaxPieces)
+    }
+    return canonicalMaterial(sides[0], sides[1]), nil
+}
+
+// countSignature returns the pieces of one side in the order KQRBNP.
+func countSignature(count *[7]int) string {
+    buf := make([]byte, 0, egMaxPieces)
+    for _, piece := range []uint8{K, Q, R, B, N, P} {
+        for i := 0; i < count[piece]; i++ {
+            buf = append(buf, " PNBRQK"[piece])
+        }
+    }
+    return string(buf)
+}
+
+// canonicalMaterial names an endgame with the stronger side first.
+func canonicalMaterial(a, b string) string {
+    value := func(side string) (v int) {
+        for _, r := range side {
+            v += [7]int{0, 1, 3, 3, 5, 9, 0}[strings.IndexRune(" PNBRQK", r)]
+        }
+        return
+    }
+    if va, vb := value(a), value(b); va < vb || (va == vb && a < b) {
+        a, b = b, a
+    }
+    return a + "v" + b
+}
+
+// newEndgameTable allocates an empty table for the canonical material.
+func newEndgameTable(name string) *EndgameTable {
+    t := &EndgameTable{name: name}
+    pawns := [2]bool{}
+    for i, side := range strings.Split(name, "v") {
+        color := [2]uint8{White, Black}[i]
+        for _, r := range side {
+            piece := uint8(strings.IndexRune(" PNBRQK", r))
+            t.pieces = append(t.pieces, piece|color)
+            if piece == P {
+                pawns[i] = true
+            }
+        }
+    }
+    t.ep = pawns[0] && pawns[1]
+    size := 1 << uint(6*len(t.pieces)+1)
+    if t.ep {
+        size *= 2
+    }
+    t.dtm = make([]int8, size)
+    return t
+}
+
+// index returns the index of the position p, whose material must match.
+// If flip is set, the colors are swapped and the board is mirrored.
+func (t *EndgameTable) index(p *egPos, flip bool) int {
+    var used [egMaxPieces]bool
+    idx := 0
+    for _, piece := range t.pieces {
+        for j := 0; j < p.n; j++ {
+            pj, sq := p.pieces[j], p.sqs[j]
+            if flip {
+                pj, sq = pj^ColorMask, sq^56
+            }
+            if !used[j] && pj == piece {
+                used[j] = true
+                idx = idx<<6 | sq
+                break
+            }
+        }
+    }
+    if (p.stm == Black) != flip {
+        idx |= 1 << uint(6*len(t.pieces))
+    }
+    if p.ep && t.ep {
+        idx |= 2 << uint(6*len(t.pieces))
+    }
+    return idx
+}
+
+// decode sets up the position with the given index.
+func (t *EndgameTable) decode(idx int, p *egPos) {
+    n := len(t.pieces)
+    p.n, p.stm, p.ep = n, White, idx>>uint(6*n+1) != 0
+    if idx>>uint(6*n)&1 != 0 {
+        p.stm = Black
+    }
+    for i := n - 1; i >= 0; i-- {
+        p.pieces[i], p.sqs[i] = t.pieces[i], idx&63
+        idx >>= 6
+    }
+}
+
+// An egPos is a position of an endgame with a few pieces. If ep is set,
+// the only pawn of the player who isn't to move has just advanced two
+// squares and can be captured en passant.
+type egPos struct {
+    pieces [egMaxPieces]uint8
+    sqs    [egMaxPieces]int
+    n      int
+    stm    uint8
+    ep     bool
+}
+
+// signature describes the pieces of the given color, e.g. "KRP".
+func (p *egPos) signature(color uint8) string {
+    var count [7]int
+    for i := 0; i < p.n; i++ {
+        if p.pieces[i]&ColorMask == color {
+            count[p.pieces[i]&PieceMask]++
+        }
+    }
+    return countSignature(&count)
+}
+
+// occupied returns the bitboard of all pieces.
+func (p *egPos) occupied() (occ Bitboard) {
+    for i := 0; i < p.n; i++ {
+        occ |= 1 << uint(p.sqs[i])
+    }
+    return
+}
+
+// at returns the index of the piece on sq or -1.
+func (p *egPos) at(sq int) int {
+    for i := 0; i < p.n; i++ {
+        if p.sqs[i] == sq {
+            return i
+        }
+    }
+    return -1
+}
+
+// attacks checks if a piece on the square src attacks dst.
+func attacks(piece uint8, src, dst int, occ Bitboard) bool {
+    df, dr := dst&7-src&7, dst>>3-src>>3
+    adf, adr := df, dr
+    if adf < 0 {
+        adf = -adf
+    }
+    if adr < 0 {
+        adr = -adr
+    }
+    switch piece & PieceMask {
+    case K:
+        return adf <= 1 && adr <= 1 && src != dst
+    case N:
+        return adf*adr == 2
+    case P:
+        if piece&ColorMask == White {
+            return dr == 1 && adf == 1
+        }
+        return dr == -1 && adf == 1
+    case R:
+        if df != 0 && dr != 0 {
+            return false
+        }
+    case B:
+        if adf != adr {
+            return false
+        }
+    case Q:
+        if df != 0 && dr != 0 && adf != adr {
+            return false
+        }
+    }
+    if src == dst {
+        return false
+    }
+    step := sign(dr)*8 + sign(df)
+    for sq := src + step; sq != dst; sq += step {
+        if occ&(1<<uint(sq)) != 0 {
+            return false
+        }
+    }
+    return true
+}
+
+func sign(x int) int {
+    switch {
+    case x > 0:
+        return 1
+    case x < 0:
+        return -1
+    }
+    return 0
+}
+
+// attacked checks if the king of the given color is attacked.
+func (p *egPos) attacked(color uint8) bool {
+    king := -1
+    for i := 0; i < p.n; i++ {
+        if p.pieces[i] == K|color {
+            king = p.sqs[i]
+        }
+    }
+    occ := p.occupied()
+    for i := 0; i < p.n; i++ {
+        if p.pieces[i]&ColorMask != color && attacks(p.pieces[i], p.sqs[i], king, occ) {
+            return true
+        }
+    }
+    return false
+}
+
+// legal checks if the position can occur in a game: all pieces are on
+// different squares, no pawn is on the first or last rank, the player who
+// isn't to move isn't in check and the en passant flag is possible.
+func (p *egPos) legal() bool {
+    var occ Bitboard
+    for i := 0; i < p.n; i++ {
+        sq := p.sqs[i]
+        if occ&(1<<uint(sq)) != 0 ||
+            (p.pieces[i]&PieceMask == P && (sq>>3 == 0 || sq>>3 == 7)) {
+            return false
+        }
+        occ |= 1 << uint(sq)
+    }
+    if p.ep && !p.epPossible() {
+        return false
+    }
+    return !p.attacked(p.stm ^ ColorMask)
+}
+
+// epPossible checks if the opponent's pawn might have just advanced two
+// squares and can be captured by a pawn of the player to move.
+func (p *egPos) epPossible() bool {
+    pawn, rank, dir := -1, 4, 8
+    if p.stm == Black {
+        rank, dir = 3, -8
+    }
+    for i := 0; i < p.n; i++ {
+        if p.pieces[i] == P|(p.stm^ColorMask) {
+            pawn = i
+        }
+    }
+    if pawn < 0 || p.sqs[pawn]>>3 != rank {
+        return false
+    }
+    sq, occ := p.sqs[pawn], p.occupied()
+    return occ&(1<<uint(sq+dir)) == 0 && occ&(1<<uint(sq+2*dir)) == 0 &&
+        p.epCapturer(sq)
+}
+
+// epCapturer checks if a pawn of the player to move stands next to sq.
+func (p *egPos) epCapturer(sq int) bool {
+    for i := 0; i < p.n; i++ {
+        if p.pieces[i] == P|p.stm && p.sqs[i]>>3 == sq>>3 &&
+            (p.sqs[i]-sq == 1 || p.sqs[i]-sq == -1) {
+            return true
+        }
+    }
+    return false
+}
+
+// egMove is a move in an endgame position.
+type egMove struct {
+    piece    int   // index of the moving piece
+    dst      int   // target square
+    captured int   // index of the captured piece or -1
+    promote  uint8 // piece type of a promotion or 0
+}
+
+var (
+    kingSteps   = [][2]int{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+    knightSteps = [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+)
+
+// targets calls f for all squares the non-pawn piece i can reach, which
+// are either empty or occupied by another piece. Captures of own pieces
+// are filtered later.
+func (p *egPos) targets(i int, occ Bitboard, f func(dst int)) {
+    piece, src := p.pieces[i]&PieceMask, p.sqs[i]
+    steps, slide := kingSteps, false
+    switch piece {
+    case N:
+        steps = knightSteps
+    case R:
+        steps, slide = []([2]int){{1, 0}, {0, 1}, {-1, 0}, {0, -1}}, true
+    case B:
+        steps, slide = []([2]int){{1, 1}, {-1, 1}, {-1, -1}, {1, -1}}, true
+    case Q:
+        slide = true
+    }
+    for _, s := range steps {
+        file, rank := src&7, src>>3
+        for {
+            file, rank = file+s[0], rank+s[1]
+            if file < 0 || file > 7 || rank < 0 || rank > 7 {
+                break
+            }
+            dst := rank<<3 + file
+            f(dst)
+            if !slide || occ&(1<<uint(dst)) != 0 {
+                break
+            }
+        }
+    }
+}
+
+// moves returns all legal moves of the player to move.
+func (p *egPos) moves(moves []egMove) []egMove {
+    moves = moves[:0]
+    occ := p.occupied()
+    add := func(i, dst int) {
+        m := egMove{piece: i, dst: dst, captured: p.at(dst)}
+        if m.captured >= 0 && p.pieces[m.captured]&ColorMask == p.stm {
+            return
+        }
+        if p.pieces[i]&PieceMask == P && (dst>>3 == 0 || dst>>3 == 7) {
+            for _, promote := range []uint8{Q, R, B, N} {
+                m.promote = promote
+                moves = append(moves, m)
+            }
+            return
+        }
+        moves = append(moves, m)
+    }
+    for i := 0; i < p.n; i++ {
+        if p.pieces[i]&ColorMask != p.stm {
+            continue
+        }
+        if p.pieces[i]&PieceMask != P {
+            p.targets(i, occ, func(dst int) { add(i, dst) })
+            continue
+        }
+        src, dir, start := p.sqs[i], 8, 1
+        if p.stm == Black {
+            dir, start = -8, 6
+        }
+        if occ&(1<<uint(src+dir)) == 0 {
+            add(i, src+dir)
+            if src>>3 == start && occ&(1<<uint(src+2*dir)) == 0 {
+                add(i, src+2*dir)
+            }
+        }
+        for _, df := range []int{-1, 1} {
+            if f := src&7 + df; f >= 0 && f <= 7 {
+                dst := src + dir + df
+                if j := p.at(dst); j >= 0 {
+                    add(i, dst)
+                } else if p.ep && p.at(dst-dir) >= 0 &&
+                    p.pieces[p.at(dst-dir)] == P|(p.stm^ColorMask) {
+                    moves = append(moves, egMove{piece: i, dst: dst,
+                        captured: p.at(dst - dir)})
+                }
+            }
+        }
+    }
+
+    // remove moves which leave the king in check
+    legal := moves[:0]
+    for _, m := range moves {
+        q := p.apply(m)
+        if !q.attacked(p.stm) {
+            legal = append(legal, m)
+        }
+    }
+    return legal
+}
+
+// apply returns the position after the move m.
+func (p *egPos) apply(m egMove) (q egPos) {
+    q = *p
+    q.sqs[m.piece] = m.dst
+    if m.promote != 0 {
+        q.pieces[m.piece] = m.promote | p.stm
+    }
+    if m.captured >= 0 {
+        q.n--
+        for i := m.captured; i < q.n; i++ {
+            q.pieces[i], q.sqs[i] = q.pieces[i+1], q.sqs[i+1]
+        }
+    }
+    q.stm ^= ColorMask
+    q.ep = false
+    if p.pieces[m.piece]&PieceMask == P && (m.dst-p.sqs[m.piece] == 16 ||
+        m.dst-p.sqs[m.piece] == -16) {
+        q.ep = q.epCapturer(m.dst)
+    }
+    return q
+}
+
+// egGenerator generates endgame tables together with the tables they
+// depend on.
+type egGenerator struct {
+    tables map[string]*EndgameTable
+}
+
+// value returns the entry of the position p, which must be contained in
+// one of the generated tables or consist of the kings only.
+func (g *egGenerator) value(p *egPos) int8 {
+    if p.n == 2 {
+        return 0
+    }
+    white, black := p.signature(White), p.signature(Black)
+    if t := g.tables[white+"v"+black]; t != nil {
+        return t.dtm[t.index(p, false)]
+    }
+    t := g.tables[black+"v"+white]
+    return t.dtm[t.index(p, true)]
+}
+
+// successors returns the materials which can arise from name by a capture
+// or a promotion, excluding bare kings.
+func successors(name string) (materials []string) {
+    sides := strings.Split(name, "v")
+    add := func(a, b string) {
+        if len(a)+len(b) > 2 {
+            materials = append(materials, canonicalMaterial(sortSide(a), sortSide(b)))
+        }
+    }
+    for c := 0; c < 2; c++ {
+        own, other := sides[c], sides[1-c]
+        // captures of the other side's pieces
+        for i := 1; i < len(other); i++ {
+            rest := other[:i] + other[i+1:]
+            add(own, rest)
+            // promotions with capture
+            for j := range own {
+                if own[j] == 'P' {
+                    for _, r := range "QRBN" {
+                        add(own[:j]+string(r)+own[j+1:], rest)
+                    }
+                }
+            }
+        }
+        for j := range own {
+            if own[j] == 'P' {
+                for _, r := range "QRBN" {
+                    add(own[:j]+string(r)+own[j+1:], other)
+                }
+            }
+        }
+    }
+    return
+}
+
+// sortSide orders the pieces of one side like KQRBNP.
+func sortSide(side string) string {
+    var count [7]int
+    for _, r := range side {
+        count[strings.IndexRune(" PNBRQK", r)]++
+    }
+    return countSignature(&count)
+}
+
+// generate generates the table of the canonical material name and all
+// tables it depends on.
+func (g *egGenerator) generate(name string) (*EndgameTable, error) {
+    if t := g.tables[name]; t != nil {
+        return t, nil
+    }
+    for _, m := range successors(name) {
+        if _, err := g.generate(m); err != nil {
+            return nil, err
+        }
+    }
+    t := newEndgameTable(name)
+    if err := g.retrograde(t, t.dtm, false); err != nil {
+        return nil, err
+    }
+    g.tables[name] = t
+    return t, nil
+}
+
+// Markers of the pending results during the generation.
+const (
+    egEscape = 0xff // a move reaches a draw in another table
+    egWin    = 0x80 // flag: a move wins in another table
+)
+
+// retrograde computes the entries dst of all positions of t. First, all
+// moves of each position are counted and the ones which capture or promote
+// are looked up in the smaller tables. Then, starting at the mates, the
+// results are propagated backwards one half-move after the other: the
+// predecessors of positions lost in n half-moves are won in n+1, and once
+// all moves of a position have been found to lose, it is lost too.
+//
+// If zeroing is set, the half-moves to the next capture, pawn move or mate
+// are counted instead, like in the DTZ tables of Syzygy. These moves end
+// the game with the result of the position they reach, which is looked up
+// in the finished tables, including t itself.
+func (g *egGenerator) retrograde(t *EndgameTable, dst []int8, zeroing bool) error {
+    size := len(dst)
+    count := make([]uint8, size) // moves within the table, not yet lost
+    pending := make([]uint8, size)
+    var p egPos
+    var moves []egMove
+    last := 0 // highest level with results so far
+    for idx := 0; idx < size; idx++ {
+        t.decode(idx, &p)
+        if !p.legal() {
+            continue
+        }
+        moves = p.moves(moves)
+        win, loss, escape, n := 0, 0, false, 0
+        for _, m := range moves {
+            pawn := p.pieces[m.piece]&PieceMask == P
+            if m.captured < 0 && m.promote == 0 && !(zeroing && pawn) {
+                n++
+                continue
+            }
+            q := p.apply(m)
+            switch v := int(g.value(&q)); {
+            case zeroing && v < 0:
+                win = 1
+            case zeroing && v > 0:
+                loss = 1
+            case v < 0 && (win == 0 || -v < win):
+                win = -v
+            case v > 0 && v+1 > loss:
+                loss = v + 1
+            case v == 0:
+                escape = true
+            }
+        }
+        count[idx] = uint8(n)
+        switch {
+        case win > egMaxDTM || loss > egMaxDTM:
+            return ErrDistanceToMate
+        case len(moves) == 0 && p.attacked(p.stm):
+            dst[idx] = -1 // checkmate
+        case len(moves) == 0:
+            // stalemate
+        case win > 0:
+            pending[idx] = egWin | uint8(win)
+        case escape:
+            pending[idx] = egEscape
+        case n == 0:
+            dst[idx] = int8(-loss - 1)
+        default:
+            pending[idx] = uint8(loss)
+        }
+        if win > last {
+            last = win
+        }
+        if loss > last {
+            last = loss
+        }
+    }
+
+    var preds []int
+    for level := 1; level <= last+1; level++ {
+        if level > egMaxDTM {
+            return ErrDistanceToMate
+        }
+        for idx := 0; idx < size; idx++ {
+            v := int(dst[idx])
+            switch {
+            case v == -level:
+                // all predecessors of a loss are won
+                preds = t.predecessors(idx, &p, preds, !zeroing)
+                for _, pi := range preds {
+                    if dst[pi] == 0 {
+                        dst[pi], last = int8(level), level
+                    }
+                }
+            case v == 0 && pending[idx] == egWin|uint8(level):
+                dst[idx], last = int8(level), level
+            case v > 0 && v == level-1:
+                preds = t.predecessors(idx, &p, preds, !zeroing)
+                for _, pi := range preds {
+                    if dst[pi] != 0 || pending[pi]&egWin != 0 {
+                        continue
+                    }
+                    if count[pi]--; count[pi] == 0 && pending[pi] != egEscape {
+                        loss := int(pending[pi])
+                        if loss < level {
+                            loss = level
+                        }
+                        if loss > last {
+                            last = loss
+                        }
+                        dst[pi] = int8(-loss - 1)
+                    }
+                }
+            }
+        }
+    }
+    return nil
+}
+
+// predecessors returns the indices of all legal positions from which the
+// position with index idx can be reached by a move, which neither
+// captures nor promotes. Pawn moves are only included if pawns is set.
+func (t *EndgameTable) predecessors(idx int, p *egPos, preds []int,
+    pawns bool) []int {
+    preds = preds[:0]
+    t.decode(idx, p)
+    occ := p.occupied()
+    mover := p.stm ^ ColorMask
+    add := func(i, src int) {
+        q := *p
+        q.sqs[i], q.stm, q.ep = src, mover, false
+        if q.legal() {
+            preds = append(preds, t.index(&q, false))
+        }
+        if t.ep {
+            if q.ep = true; q.legal() {
+                preds = append(preds, t.index(&q, false))
+            }
+        }
+    }
+    for i := 0; i < p.n; i++ {
+        if p.pieces[i]&ColorMask != mover {
+            continue
+        }
+        sq := p.sqs[i]
+        if p.pieces[i]&PieceMask != P {
+            if !p.ep {
+                p.targets(i, occ, func(src int) {
+                    if occ&(1<<uint(src)) == 0 {
+                        add(i, src)
+                    }
+                })
+            }
+            continue
+        } else if !pawns {
+            continue
+        }
+        dir, double := -8, 3
+        if mover == Black {
+            dir, double = 8, 4
+        }
+        back := sq + dir
+        if back < 8 || back >= 56 || occ&(1<<uint(back)) != 0 {
+            continue
+        }
+        if !p.ep {
+            add(i, back)
+        }
+        // a double step leads to the position with en passant flag, if
+        // a capture is possible
+        if sq>>3 == double && occ&(1<<uint(back+dir)) == 0 &&
+            p.ep == (t.ep && p.epCapturer(sq)) {
+            add(i, back+dir)
+        }
+    }
+    return preds
+}
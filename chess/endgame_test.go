@@ -0,0 +1,176 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "bytes"
+    "testing"
+)
+
+func TestEndgameMaterial(t *testing.T) {
+    tests := []struct {
+        in, out string
+    }{
+        {"KQK", "KQvK"},
+        {"KvKR", "KRvK"},
+        {"KBNK", "KBNvK"},
+        {"KPvKQ", "KQvKP"},
+        {"KPKP", "KPvKP"},
+    }
+    for _, test := range tests {
+        if name, err := parseMaterial(test.in); err != nil || name != test.out {
+            t.Errorf("parseMaterial(%q) = %q, %v, want %q", test.in, name, err, test.out)
+        }
+    }
+    for _, m := range []string{"KK", "KQRvKR", "KQ", "QvK", "KXvK", "KQvKvK"} {
+        if _, err := parseMaterial(m); err == nil {
+            t.Errorf("parseMaterial(%q) should fail", m)
+        }
+    }
+    succ := successors("KPvKR")
+    want := map[string]bool{"KRvK": true, "KvKP": false, "KPvK": true,
+        "KQvKR": true, "KRvKR": true, "KBvKR": false, "KRvKB": true,
+        "KRvKN": true, "KQvK": true, "KBvK": true, "KNvK": true}
+    for _, m := range succ {
+        if !want[m] {
+            t.Errorf("unexpected successor %q of KPvKR", m)
+        }
+    }
+}
+
+// maxDTM returns the longest mate of the player to move in a table.
+func maxDTM(t *EndgameTable) (max int) {
+    for _, v := range t.dtm {
+        if int(v) > max {
+            max = int(v)
+        }
+    }
+    return
+}
+
+func TestEndgameGenerate(t *testing.T) {
+    tables, err := GenerateEndgames("KQK", "KRK", "KPK")
+    if err != nil {
+        t.Fatal(err)
+    }
+    // the longest mates take 10 and 16 moves
+    if dtm := maxDTM(tables[0]); dtm != 19 {
+        t.Errorf("longest KQvK mate takes %d half-moves, want 19", dtm)
+    }
+    if dtm := maxDTM(tables[1]); dtm != 31 {
+        t.Errorf("longest KRvK mate takes %d half-moves, want 31", dtm)
+    }
+
+    tests := []struct {
+        fen string
+        wdl WDL
+        dtm int
+    }{
+        {"k7/8/1K6/8/8/8/8/6Q1 w - - 0 1", WDLWin, 1},
+        {"k6Q/8/1K6/8/8/8/8/8 b - - 0 1", WDLLoss, 0},
+        {"8/8/8/8/8/2k5/3Q4/7K b - - 0 1", WDLDraw, 0},
+        {"k7/2Q5/K7/8/8/8/8/8 b - - 0 1", WDLDraw, 0},
+        {"8/8/8/8/4k3/8/8/R3K3 b - - 0 1", WDLLoss, -1},
+        {"4k3/8/4K3/4P3/8/8/8/8 w - - 0 1", WDLWin, -1},
+        {"4k3/8/4K3/4P3/8/8/8/8 b - - 0 1", WDLLoss, -1},
+        // the defender has the opposition
+        {"8/8/8/8/8/4k3/4P3/4K3 w - - 0 1", WDLDraw, 0},
+        {"8/8/8/8/4p3/4k3/8/4K3 b - - 0 1", WDLWin, -1},
+    }
+    for _, test := range tests {
+        b, err := ParseFEN(test.fen)
+        if err != nil {
+            t.Fatal(err)
+        }
+        var wdl WDL
+        var dtm int
+        err = ErrNotInTablebases
+        for _, table := range tables {
+            if w, d, e := table.Probe(b); e == nil {
+                wdl, dtm, err = w, d, e
+            }
+        }
+        if err != nil || wdl != test.wdl || (test.dtm >= 0 && dtm != test.dtm) {
+            t.Errorf("Probe(%q) = %v, %d, %v, want %v, %d", test.fen, wdl, dtm,
+                err, test.wdl, test.dtm)
+        }
+    }
+    if _, _, err := tables[0].Probe(NewBoard()); err != ErrNotInTablebases {
+        t.Errorf("expected ErrNotInTablebases, got %v", err)
+    }
+}
+
+func TestEndgamePlay(t *testing.T) {
+    tables, err := GenerateEndgames("KRvK")
+    if err != nil {
+        t.Fatal(err)
+    }
+    table := tables[0]
+
+    // following the table mates in the announced number of moves
+    b, _ := ParseFEN("8/8/8/4k3/8/8/8/R3K3 w - - 0 1")
+    wdl, dtm, _ := table.Probe(b)
+    if wdl != WDLWin {
+        t.Fatalf("expected a win, got %v", wdl)
+    }
+    for ply := 0; ply < dtm; ply++ {
+        best, bestDTM := Move{}, 0
+        for _, m := range b.LegalMoves() {
+            c := b.Clone()
+            c.Move(m.Src, m.Dst)
+            w, d, err := table.Probe(c)
+            if err != nil {
+                t.Fatal(err)
+            }
+            // the winner mates fast, the loser can't escape but delays it
+            if ply%2 == 1 && w != WDLWin {
+                t.Fatalf("move %v changes the result to %v", m, w)
+            }
+            if ply%2 == 0 && w != WDLLoss {
+                continue
+            }
+            if best.Src == best.Dst || (ply%2 == 0 && d < bestDTM) ||
+                (ply%2 == 1 && d > bestDTM) {
+                best, bestDTM = m, d
+            }
+        }
+        if bestDTM != dtm-ply-1 {
+            t.Fatalf("best move %v has distance %d, want %d", best, bestDTM, dtm-ply-1)
+        }
+        b.Move(best.Src, best.Dst)
+    }
+    if !b.Checkmate() {
+        t.Errorf("expected checkmate after %d half-moves", dtm)
+    }
+}
+
+func TestEndgameReadWrite(t *testing.T) {
+    tables, err := GenerateEndgames("KNvK")
+    if err != nil {
+        t.Fatal(err)
+    }
+    var buf bytes.Buffer
+    if _, err := tables[0].WriteTo(&buf); err != nil {
+        t.Fatal(err)
+    }
+    table, err := ReadEndgameTable(&buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if table.Material() != "KNvK" || !bytes.Equal(int8Bytes(table.dtm),
+        int8Bytes(tables[0].dtm)) {
+        t.Errorf("the table changed")
+    }
+    if _, err := ReadEndgameTable(bytes.NewBufferString("KNvK")); err != ErrInvalidEndgameTable {
+        t.Errorf("expected ErrInvalidEndgameTable, got %v", err)
+    }
+}
+
+func int8Bytes(v []int8) []byte {
+    b := make([]byte, len(v))
+    for i := range v {
+        b[i] = byte(v[i])
+    }
+    return b
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "context"
+    "math/rand"
+    "time"
+)
+
+// An Engine chooses the moves of an AI player.
+type Engine interface {
+    // BestMove returns the move the engine wants to play in the current
+    // position of b, together with some statistics about the search. The
+    // engine must not modify b and should respect the limits. If there
+    // is no legal move, the returned move is invalid (-1, -1).
+    BestMove(ctx context.Context, b *Board, limits SearchLimits) (Move, Info)
+}
+
+// Info contains statistics about a search and the principal variation,
+// i.e. the line of best play which was found.
+type Info struct {
+    Depth    int           // depth of the search in half-moves
+    SelDepth int           // maximum depth including the quiescence search
+    Score    int           // centipawns from the point of view of the player
+    Mate     int           // moves until mate, negative if getting mated
+    Nodes    int           // number of visited positions
+    NPS      int           // nodes per second
+    Time     time.Duration // time spent searching
+    PV       []Move        // principal variation, starting with the best move
+    MultiPV  int           // rank of this line in MultiPV mode, starting at 1
+
+    // The result of the position according to the endgame tablebases,
+    // if TB is set. See ProbeWDL and ProbeDTZ.
+    TB  bool
+    WDL WDL
+    DTZ int
+}
+
+// Engines maps the names of the available engines to their
+// implementations. It contains the built-in engines, from the weakest
+// "random" to the strongest "search", and external engines can be added.
+var Engines = map[string]Engine{
+    "random":  RandomEngine{},
+    "greedy":  GreedyEngine{},
+    "negamax": NegaMaxEngine{Depth: 4},
+    "search":  SearchEngine{},
+}
+
+// DefaultEngine is the name of the engine used if no other was selected.
+const DefaultEngine = "search"
+
+// RandomEngine plays a random legal move.
+type RandomEngine struct{}
+
+// BestMove implements Engine. Neither the limits nor ctx are used, since
+// the move is picked immediately.
+func (RandomEngine) BestMove(ctx context.Context, b *Board,
+    limits SearchLimits) (Move, Info) {
+    moves := b.LegalMoves()
+    if len(moves) == 0 {
+        return Move{-1, -1}, Info{}
+    }
+    return moves[rand.Intn(len(moves))], Info{Nodes: len(moves)}
+}
+
+// GreedyEngine grabs as much material as possible without looking ahead.
+// Moves which lead to the same material balance are chosen randomly.
+type GreedyEngine struct{}
+
+// BestMove implements Engine. The reported score is the material balance
+// after the move.
+func (GreedyEngine) BestMove(ctx context.Context, b *Board,
+    limits SearchLimits) (Move, Info) {
+    best, max, n := Move{-1, -1}, -infinity, 0
+    for _, m := range b.LegalMoves() {
+        q := b.Position
+        q.move(m.Src, m.Dst)
+        score := -q.material()
+        if score > max {
+            best, max, n = m, score, 1
+        } else if score == max {
+            // reservoir sampling among all equally good moves
+            if n++; rand.Intn(n) == 0 {
+                best = m
+            }
+        }
+    }
+    return best, Info{Depth: 1, Score: max}
+}
+
+// NegaMaxEngine performs a plain minimax search of a fixed depth without
+// any pruning and only counts the material at the leaves. The clock is
+// ignored, but a smaller depth limit is respected.
+type NegaMaxEngine struct {
+    Depth int
+}
+
+// BestMove implements Engine by searching all lines up to e.Depth or the
+// depth limit, whichever is smaller.
+func (e NegaMaxEngine) BestMove(ctx context.Context, b *Board,
+    limits SearchLimits) (Move, Info) {
+    depth := e.Depth
+    if limits.Depth > 0 && limits.Depth < depth {
+        depth = limits.Depth
+    }
+    start, nodes := time.Now(), 0
+    rnd := rand.New(rand.NewSource(rand.Int63()))
+    m, score := b.Position.negaMaxPlain(ctx, depth, rnd, &nodes)
+    return m, Info{Depth: depth, Score: score, Nodes: nodes,
+        Time: time.Since(start)}
+}
+
+// negaMaxPlain searches all moves up to the given depth. If ctx is
+// cancelled, the best move among the completely searched ones is returned.
+func (p *Position) negaMaxPlain(ctx context.Context, depth int,
+    rnd *rand.Rand, nodes *int) (best Move, max int) {
+    *nodes++
+    if depth <= 0 {
+        return Move{-1, -1}, p.material()
+    }
+    best, max = Move{-1, -1}, -infinity
+    for _, m := range p.randomMoves(Move{-1, -1}, rnd) {
+        q := *p
+        q.move(m.Src, m.Dst)
+        if q.inCheck(p.color) {
+            continue
+        }
+        _, score := q.negaMaxPlain(ctx, depth-1, rnd, nodes)
+        if ctx.Err() != nil {
+            if best.Src < 0 {
+                best = m
+            }
+            return
+        }
+        if score = -score; score > max {
+            best, max = m, score
+        }
+    }
+    return
+}
+
+// material returns the material balance in centipawns from the point of
+// view of the player to move.
+func (p *Position) material() (score int) {
+    for sq := Square(0); sq < 64; sq++ {
+        if piece := p.board[sq]; piece&ColorMask == p.color {
+            score += pieceValues[piece&PieceMask].mg
+        } else if piece != 0 {
+            score -= pieceValues[piece&PieceMask].mg
+        }
+    }
+    return
+}
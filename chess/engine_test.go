@@ -0,0 +1,76 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+func TestEngines(t *testing.T) {
+    for name, engine := range Engines {
+        for _, fen := range []string{
+            "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+            "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 1",
+            "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+        } {
+            b, err := ParseFEN(fen)
+            if err != nil {
+                t.Fatal(err)
+            }
+            m, _ := engine.BestMove(context.Background(), b,
+                SearchLimits{Depth: 2})
+            if !b.Legal(m) {
+                t.Errorf("%s: illegal move %v in %q", name, m, fen)
+            }
+            if b.String() != fen {
+                t.Errorf("%s: the board was modified", name)
+            }
+        }
+
+        // fool's mate
+        b, _ := ParseFEN("rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3")
+        if m, _ := engine.BestMove(context.Background(), b,
+            SearchLimits{Depth: 2}); m.Src >= 0 {
+            t.Errorf("%s: returned the move %v although white is mated",
+                name, m)
+        }
+    }
+}
+
+func TestGreedyEngine(t *testing.T) {
+    b, _ := ParseFEN("4k3/8/8/3q4/8/2N5/8/4K3 w - - 0 1")
+    m, info := GreedyEngine{}.BestMove(context.Background(), b, SearchLimits{})
+    if m != (Move{Sq("c3"), Sq("d5")}) || info.Score != pieceValues[N].mg {
+        t.Errorf("expected Nxd5, got %v (score %d)", m, info.Score)
+    }
+}
+
+func TestEngineCancel(t *testing.T) {
+    b, _ := ParseFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+    engines := map[string]Engine{
+        "search":   SearchEngine{},
+        "parallel": SearchEngine{},
+        "negamax":  NegaMaxEngine{Depth: 8},
+        "level":    LevelEngine(9),
+    }
+    for name, engine := range engines {
+        limits := SearchLimits{Depth: maxDepth}
+        if name == "parallel" {
+            limits.Threads = 4
+        }
+        ctx, cancel := context.WithTimeout(context.Background(),
+            50*time.Millisecond)
+        start := time.Now()
+        m, _ := engine.BestMove(ctx, b, limits)
+        cancel()
+        if d := time.Since(start); d > 500*time.Millisecond {
+            t.Errorf("%s: search took %v after cancellation", name, d)
+        }
+        if !b.Legal(m) {
+            t.Errorf("%s: illegal move %v", name, m)
+        }
+    }
+}
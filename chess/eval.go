@@ -0,0 +1,347 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "fmt"
+)
+
+// A score is a pair of middlegame and endgame values in centipawns. The
+// final evaluation interpolates between them depending on the game phase.
+type score struct {
+    mg, eg int
+}
+
+func (s score) add(t score) score {
+    return score{s.mg + t.mg, s.eg + t.eg}
+}
+
+func (s score) mul(n int) score {
+    return score{s.mg * n, s.eg * n}
+}
+
+// taper interpolates between the middlegame and endgame value.
+func (s score) taper(phase int) int {
+    return (s.mg*phase + s.eg*(maxPhase-phase)) / maxPhase
+}
+
+// A trace records how often each weight contributes to an evaluation, so
+// that the evaluation can be expressed as a linear function of the weights.
+// A nil trace records nothing.
+type trace map[*score]int
+
+// weigh returns the weight w multiplied by n and records its use.
+func (t trace) weigh(w *score, n int) score {
+    if t != nil {
+        t[w] += n
+    }
+    return w.mul(n)
+}
+
+// Contribution of each piece kind to the game phase. The phase is maxPhase
+// with all pieces on the board and 0 if only kings and pawns are left.
+var phaseWeights = [7]int{0, 0, 1, 1, 2, 4, 0}
+
+const maxPhase = 24
+
+// material values of all pieces
+var pieceValues = [7]score{
+    {0, 0}, {100, 120}, {320, 300}, {330, 320}, {500, 520}, {900, 920}, {0, 0},
+}
+
+// Piece-square tables from white's point of view. The first row is the 8th
+// rank, so that the tables look like a board from white's side.
+var psqt = [7][64]score{}
+
+var psqtMg = [7][64]int{
+    P: {
+        0, 0, 0, 0, 0, 0, 0, 0,
+        50, 50, 50, 50, 50, 50, 50, 50,
+        10, 10, 20, 30, 30, 20, 10, 10,
+        5, 5, 10, 25, 25, 10, 5, 5,
+        0, 0, 0, 20, 20, 0, 0, 0,
+        5, -5, -10, 0, 0, -10, -5, 5,
+        5, 10, 10, -20, -20, 10, 10, 5,
+        0, 0, 0, 0, 0, 0, 0, 0,
+    },
+    N: {
+        -50, -40, -30, -30, -30, -30, -40, -50,
+        -40, -20, 0, 0, 0, 0, -20, -40,
+        -30, 0, 10, 15, 15, 10, 0, -30,
+        -30, 5, 15, 20, 20, 15, 5, -30,
+        -30, 0, 15, 20, 20, 15, 0, -30,
+        -30, 5, 10, 15, 15, 10, 5, -30,
+        -40, -20, 0, 5, 5, 0, -20, -40,
+        -50, -40, -30, -30, -30, -30, -40, -50,
+    },
+    B: {
+        -20, -10, -10, -10, -10, -10, -10, -20,
+        -10, 0, 0, 0, 0, 0, 0, -10,
+        -10, 0, 5, 10, 10, 5, 0, -10,
+        -10, 5, 5, 10, 10, 5, 5, -10,
+        -10, 0, 10, 10, 10, 10, 0, -10,
+        -10, 10, 10, 10, 10, 10, 10, -10,
+        -10, 5, 0, 0, 0, 0, 5, -10,
+        -20, -10, -10, -10, -10, -10, -10, -20,
+    },
+    R: {
+        0, 0, 0, 0, 0, 0, 0, 0,
+        5, 10, 10, 10, 10, 10, 10, 5,
+        -5, 0, 0, 0, 0, 0, 0, -5,
+        -5, 0, 0, 0, 0, 0, 0, -5,
+        -5, 0, 0, 0, 0, 0, 0, -5,
+        -5, 0, 0, 0, 0, 0, 0, -5,
+        -5, 0, 0, 0, 0, 0, 0, -5,
+        0, 0, 0, 5, 5, 0, 0, 0,
+    },
+    Q: {
+        -20, -10, -10, -5, -5, -10, -10, -20,
+        -10, 0, 0, 0, 0, 0, 0, -10,
+        -10, 0, 5, 5, 5, 5, 0, -10,
+        -5, 0, 5, 5, 5, 5, 0, -5,
+        0, 0, 5, 5, 5, 5, 0, -5,
+        -10, 5, 5, 5, 5, 5, 0, -10,
+        -10, 0, 5, 0, 0, 0, 0, -10,
+        -20, -10, -10, -5, -5, -10, -10, -20,
+    },
+    K: {
+        -30, -40, -40, -50, -50, -40, -40, -30,
+        -30, -40, -40, -50, -50, -40, -40, -30,
+        -30, -40, -40, -50, -50, -40, -40, -30,
+        -30, -40, -40, -50, -50, -40, -40, -30,
+        -20, -30, -30, -40, -40, -30, -30, -20,
+        -10, -20, -20, -20, -20, -20, -20, -10,
+        20, 20, 0, 0, 0, 0, 20, 20,
+        20, 30, 10, 0, 0, 10, 30, 20,
+    },
+}
+
+// In the endgame, pawns should advance and the king should centralize.
+// All other pieces use the same table as in the middlegame.
+var psqtEg = [7][64]int{
+    P: {
+        0, 0, 0, 0, 0, 0, 0, 0,
+        80, 80, 80, 80, 80, 80, 80, 80,
+        50, 50, 50, 50, 50, 50, 50, 50,
+        30, 30, 30, 30, 30, 30, 30, 30,
+        15, 15, 15, 15, 15, 15, 15, 15,
+        5, 5, 5, 5, 5, 5, 5, 5,
+        0, 0, 0, 0, 0, 0, 0, 0,
+        0, 0, 0, 0, 0, 0, 0, 0,
+    },
+    K: {
+        -50, -40, -30, -20, -20, -30, -40, -50,
+        -30, -20, -10, 0, 0, -10, -20, -30,
+        -30, -10, 20, 30, 30, 20, -10, -30,
+        -30, -10, 30, 40, 40, 30, -10, -30,
+        -30, -10, 30, 40, 40, 30, -10, -30,
+        -30, -10, 20, 30, 30, 20, -10, -30,
+        -30, -30, 0, 0, 0, 0, -30, -30,
+        -50, -30, -30, -30, -30, -30, -30, -50,
+    },
+}
+
+func init() {
+    for piece := P; piece <= K; piece++ {
+        eg := psqtEg[piece]
+        if piece != P && piece != K {
+            eg = psqtMg[piece]
+        }
+        for sq := 0; sq < 64; sq++ {
+            psqt[piece][sq] = score{psqtMg[piece][sq], eg[sq]}
+        }
+    }
+}
+
+// Weights of the remaining evaluation terms.
+var (
+    mobilityBonus = [7]score{N: {4, 4}, B: {5, 5}, R: {2, 4}, Q: {1, 2}}
+    doubledPawn   = score{-10, -20}
+    isolatedPawn  = score{-10, -15}
+    passedPawn    = [8]score{{0, 0}, {5, 10}, {10, 20}, {15, 35},
+        {25, 60}, {40, 90}, {60, 130}, {0, 0}}
+    pawnShield      = score{15, 0}
+    openKingFile    = score{-25, 0}
+    bishopPairBonus = score{30, 50}
+)
+
+// An Evaluation lists the individual terms of the static evaluation of a
+// position. All values are given in centipawns from white's point of view
+// and are already interpolated according to the game phase.
+type Evaluation struct {
+    Material    int
+    PieceSquare int
+    Mobility    int
+    Pawns       int
+    KingSafety  int
+    BishopPair  int
+    Phase       int // game phase from 0 (endgame) to 24 (opening)
+    Total       int // sum of all terms
+}
+
+// String formats the evaluation as a small table.
+func (e Evaluation) String() string {
+    return fmt.Sprintf("Material     %6d\nPiece-Square %6d\nMobility     %6d\n"+
+        "Pawns        %6d\nKing Safety  %6d\nBishop Pair  %6d\n"+
+        "Phase        %6d\nTotal        %6d\n", e.Material, e.PieceSquare,
+        e.Mobility, e.Pawns, e.KingSafety, e.BishopPair, e.Phase, e.Total)
+}
+
+// EvalBreakdown returns the individual terms of the static evaluation of
+// the current position for debugging purposes.
+func (b *Board) EvalBreakdown() Evaluation {
+    return b.Position.breakdown()
+}
+
+// evaluate returns the static evaluation of the position in centipawns from
+// the point of view of the player to move.
+func (p *Position) evaluate() int {
+    if p.color == Black {
+        return -p.breakdown().Total
+    }
+    return p.breakdown().Total
+}
+
+// breakdown calculates all terms of the static evaluation.
+func (p *Position) breakdown() Evaluation {
+    return p.eval(nil)
+}
+
+// eval calculates all terms of the static evaluation and records the
+// weights used in t.
+func (p *Position) eval(t trace) (e Evaluation) {
+    var material, pst, mobility, pawns, king, pair score
+    var bishops [2]int
+    var pawnFiles [2][8]int
+    var kings [2]Square
+
+    for sq := Square(0); sq < 64; sq++ {
+        piece := p.board[sq]
+        if piece == 0 {
+            continue
+        }
+        kind, c, sign := piece&PieceMask, piece>>4, 1
+        idx := int(7-sq.Rank())*8 + int(sq.File())
+        if c == 1 {
+            idx, sign = int(sq), -1
+        }
+        e.Phase += phaseWeights[kind]
+        material = material.add(t.weigh(&pieceValues[kind], sign))
+        pst = pst.add(t.weigh(&psqt[kind][idx], sign))
+
+        switch kind {
+        case P:
+            pawnFiles[c][sq.File()]++
+        case B:
+            bishops[c]++
+        case K:
+            kings[c] = sq
+        }
+        if kind >= N && kind <= Q {
+            n := 0
+            for dst := Square(0); dst < 64; dst++ {
+                if dst != sq && p.mayMove(sq, dst) {
+                    n++
+                }
+            }
+            mobility = mobility.add(t.weigh(&mobilityBonus[kind], n*sign))
+        }
+    }
+    if e.Phase > maxPhase {
+        e.Phase = maxPhase
+    }
+
+    for c, sign := 0, 1; c < 2; c, sign = c+1, -1 {
+        if bishops[c] >= 2 {
+            pair = pair.add(t.weigh(&bishopPairBonus, sign))
+        }
+        pawns = pawns.add(p.pawnStructure(c, sign, &pawnFiles, t))
+        king = king.add(p.kingSafety(c, sign, kings[c], &pawnFiles, t))
+    }
+
+    e.Material = material.taper(e.Phase)
+    e.PieceSquare = pst.taper(e.Phase)
+    e.Mobility = mobility.taper(e.Phase)
+    e.Pawns = pawns.taper(e.Phase)
+    e.KingSafety = king.taper(e.Phase)
+    e.BishopPair = pair.taper(e.Phase)
+    e.Total = e.Material + e.PieceSquare + e.Mobility + e.Pawns +
+        e.KingSafety + e.BishopPair
+    return
+}
+
+// pawnStructure rates doubled, isolated and passed pawns of the color c
+// (0 for white, 1 for black). The score is multiplied by sign.
+func (p *Position) pawnStructure(c, sign int, files *[2][8]int,
+    t trace) (s score) {
+    pawn := P | White
+    if c == 1 {
+        pawn = P | Black
+    }
+    for f := 0; f < 8; f++ {
+        if files[c][f] > 1 {
+            s = s.add(t.weigh(&doubledPawn, (files[c][f]-1)*sign))
+        }
+        if files[c][f] > 0 && (f == 0 || files[c][f-1] == 0) &&
+            (f == 7 || files[c][f+1] == 0) {
+            s = s.add(t.weigh(&isolatedPawn, files[c][f]*sign))
+        }
+    }
+    for sq := Square(0); sq < 64; sq++ {
+        if p.board[sq] != pawn {
+            continue
+        }
+        if p.passed(sq) {
+            rank := sq.Rank()
+            if c == 1 {
+                rank = 7 - rank
+            }
+            s = s.add(t.weigh(&passedPawn[rank], sign))
+        }
+    }
+    return
+}
+
+// passed checks if no enemy pawns can stop the pawn on sq.
+func (p *Position) passed(sq Square) bool {
+    pawn := p.board[sq]
+    enemy, dir := P|Black, 8
+    if pawn&ColorMask == Black {
+        enemy, dir = P|White, -8
+    }
+    for r := int(sq) + dir; r >= 0 && r < 64; r += dir {
+        for f := Square(r).File() - 1; f <= Square(r).File()+1; f++ {
+            if f >= 0 && f < 8 && p.board[r&^7+f] == enemy {
+                return false
+            }
+        }
+    }
+    return true
+}
+
+// kingSafety rewards pawns in front of the king on sq and penalizes open
+// files next to it. The score is multiplied by sign.
+func (p *Position) kingSafety(c, sign int, sq Square, files *[2][8]int,
+    t trace) (s score) {
+    pawn, dir := P|White, 8
+    if c == 1 {
+        pawn, dir = P|Black, -8
+    }
+    for f := sq.File() - 1; f <= sq.File()+1; f++ {
+        if f < 0 || f > 7 {
+            continue
+        }
+        if files[c][f] == 0 {
+            s = s.add(t.weigh(&openKingFile, sign))
+        }
+        for i := 1; i <= 2; i++ {
+            r := int(sq)&^7 + i*dir
+            if r >= 0 && r < 64 && p.board[r+f] == pawn {
+                s = s.add(t.weigh(&pawnShield, sign))
+                break
+            }
+        }
+    }
+    return
+}
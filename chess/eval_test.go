@@ -0,0 +1,72 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "testing"
+)
+
+// mirror flips the board vertically and swaps the colors of all pieces.
+func mirror(p Position) (q Position) {
+    for sq := Square(0); sq < 64; sq++ {
+        if piece := p.board[sq]; piece != 0 {
+            q.board[sq^56] = piece ^ ColorMask
+            q.occupied |= 1 << uint(sq^56)
+        }
+    }
+    q.color = p.color ^ ColorMask
+    return q
+}
+
+func TestEvalSymmetry(t *testing.T) {
+    for _, fen := range []string{
+        "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+        "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+        "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+        "r1bq1rk1/pp2bppp/2n1pn2/3p4/2PP4/2N2N2/PP2BPPP/R2QKB1R b KQ - 0 1",
+    } {
+        b, err := ParseFEN(fen)
+        if err != nil {
+            t.Fatal(err)
+        }
+        p, q := b.Position, mirror(b.Position)
+        if p.breakdown() != negate(q.breakdown()) {
+            t.Errorf("asymmetric evaluation of %q:\n%v\n%v", fen,
+                p.breakdown(), q.breakdown())
+        }
+        if p.evaluate() != q.evaluate() {
+            t.Errorf("evaluate(%q) = %d, mirrored = %d", fen, p.evaluate(),
+                q.evaluate())
+        }
+    }
+}
+
+func negate(e Evaluation) Evaluation {
+    return Evaluation{-e.Material, -e.PieceSquare, -e.Mobility, -e.Pawns,
+        -e.KingSafety, -e.BishopPair, e.Phase, -e.Total}
+}
+
+func TestEvalBreakdown(t *testing.T) {
+    b := NewBoard()
+    if e := b.EvalBreakdown(); e.Total != 0 || e.Phase != maxPhase {
+        t.Errorf("unexpected evaluation of the start position:\n%v", e)
+    }
+
+    // white has doubled, isolated pawns and black a passed pawn
+    b, _ = ParseFEN("4k3/p7/8/8/8/2P5/2P5/4K3 w - - 0 1")
+    if e := b.EvalBreakdown(); e.Pawns >= 0 || e.Phase != 0 {
+        t.Errorf("expected bad pawn structure for white:\n%v", e)
+    }
+
+    b, _ = ParseFEN("2b1kb2/8/8/8/8/8/8/2B1K1N1 w - - 0 1")
+    if e := b.EvalBreakdown(); e.BishopPair != -bishopPairBonus.taper(e.Phase) {
+        t.Errorf("expected bishop pair for black:\n%v", e)
+    }
+
+    // the black king lost its pawn shield in the middlegame
+    b, _ = ParseFEN("rnbq1rk1/ppppbp2/8/8/8/8/PPPPPPPP/RNBQKBNR w KQ - 0 1")
+    if e := b.EvalBreakdown(); e.KingSafety <= 0 {
+        t.Errorf("expected the white king to be safer:\n%v", e)
+    }
+}
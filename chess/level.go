@@ -0,0 +1,121 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "context"
+    "math/rand"
+    "time"
+)
+
+// A level describes how the strength of the search engine is limited.
+type level struct {
+    depth   int // maximum search depth or 0
+    nodes   int // maximum number of nodes or 0
+    noise   int // maximum random error of the evaluation in centipawns
+    blunder int // probability of a deliberate suboptimal move in percent
+}
+
+// Difficulty levels of the AI, each one stronger than the one before. The
+// comments give their approximate Elo above the random mover, measured by
+// TestLevelGauntlet in 40 games between neighboring levels, with about one
+// second per move at full strength, which gets stronger with more time.
+// Each step is accurate to about 100 Elo. Self-play exaggerates the
+// differences, so the ratings can't be compared with the ones of human
+// players.
+var levels = [...]level{
+    1:  {depth: 1, nodes: 200, noise: 300, blunder: 40},  // 550, beginner
+    2:  {depth: 1, nodes: 500, noise: 200, blunder: 30},  // 750
+    3:  {depth: 2, nodes: 1000, noise: 150, blunder: 20}, // 1150
+    4:  {depth: 2, nodes: 3000, noise: 100, blunder: 15}, // 1350, casual
+    5:  {depth: 3, nodes: 10000, noise: 60, blunder: 10}, // 1650
+    6:  {depth: 3, nodes: 30000, noise: 40, blunder: 5},  // 1850
+    7:  {depth: 4, nodes: 100000, noise: 20, blunder: 2}, // 2200, club
+    8:  {depth: 5, nodes: 300000, noise: 10},             // 2500
+    9:  {depth: 6, nodes: 1000000},                       // 2650
+    10: {},                                               // 2700, full strength
+}
+
+// MaxLevel is the strongest difficulty level.
+const MaxLevel = len(levels) - 1
+
+// Moves which are worse than the best move by more than blunderMargin
+// centipawns are never played deliberately.
+const blunderMargin = 300
+
+// A LevelEngine is a search engine whose strength is limited to one of the
+// difficulty levels from 1 (weakest) to MaxLevel (full strength). Only the
+// strongest level uses more than one thread.
+type LevelEngine int
+
+// BestMove implements Engine. The limits are reduced to those of the level
+// and the result may be replaced by a deliberate mistake.
+func (e LevelEngine) BestMove(ctx context.Context, b *Board,
+    limits SearchLimits) (Move, Info) {
+    l := levels[MaxLevel]
+    if e >= 1 && int(e) <= MaxLevel {
+        l = levels[e]
+    }
+    if l.depth > 0 && (limits.Depth <= 0 || limits.Depth > l.depth) {
+        limits.Depth = l.depth
+    }
+    if l.nodes > 0 && (limits.Nodes <= 0 || limits.Nodes > l.nodes) {
+        limits.Nodes = l.nodes
+    }
+    limited := e >= 1 && int(e) < MaxLevel
+    if limited {
+        // helper threads would multiply the node budget, so the strength
+        // would depend on the hardware
+        limits.Threads = 1
+    }
+
+    s := newSearcher(ctx, limits)
+    s.game = b.gameKeys()
+    if limited {
+        // the deeper results of other games in the shared table would make
+        // the level stronger, and noisy results must not end up there
+        s.tt = NewTransTable(1)
+    }
+    if l.noise > 0 {
+        // weak levels don't play perfect endgames
+        s.tb = nil
+        s.noise, s.seed = l.noise, uint64(rand.Int63())
+    }
+    s.tt.newSearch()
+    m := s.searchParallel(&b.Position)
+    if l.blunder > 0 && rand.Intn(100) < l.blunder {
+        m = s.suboptimal(&b.Position, m)
+    }
+    return m, s.info
+}
+
+// suboptimal picks a random move other than best whose quiescence score is
+// not much worse than the one of the best move. The limits of the search
+// don't apply, since the main search has usually used them up.
+func (s *searcher) suboptimal(p *Position, best Move) Move {
+    if s.ctx.Err() != nil {
+        return best
+    }
+    s.limits.Nodes, s.deadline, s.stop, s.stopped = 0, time.Time{}, nil, false
+    moves := p.LegalMoves()
+    scores := make([]int, len(moves))
+    max := -infinity
+    for i, m := range moves {
+        q := p.Apply(m)
+        scores[i] = -s.quiesce(&q, 1, -infinity, infinity)
+        if m == best {
+            max = scores[i]
+        }
+    }
+    candidates := make([]Move, 0, len(moves))
+    for i, m := range moves {
+        if m != best && scores[i] >= max-blunderMargin {
+            candidates = append(candidates, m)
+        }
+    }
+    if len(candidates) == 0 {
+        return best
+    }
+    return candidates[rand.Intn(len(candidates))]
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "context"
+    "flag"
+    "math"
+    "testing"
+)
+
+func TestLevelEngine(t *testing.T) {
+    b, _ := ParseFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+    for level := 1; level <= 6; level++ {
+        for i := 0; i < 2; i++ {
+            // the node budget doesn't grow with the number of threads
+            m, info := LevelEngine(level).BestMove(context.Background(), b,
+                SearchLimits{Threads: 4})
+            if !b.Legal(m) {
+                t.Fatalf("level %d: illegal move %v", level, m)
+            }
+            if l := levels[level]; info.Depth > l.depth || info.Nodes > l.nodes {
+                t.Errorf("level %d: searched depth %d with %d nodes",
+                    level, info.Depth, info.Nodes)
+            }
+        }
+    }
+}
+
+func TestLevelSharedTable(t *testing.T) {
+    // the levels neither use nor fill the table shared by other games
+    defer func(tt *TransTable) { transTable = tt }(transTable)
+    transTable = NewTransTable(1)
+    b := NewBoard()
+    for level := MaxLevel - 1; level >= 1; level-- {
+        LevelEngine(level).BestMove(context.Background(), b, SearchLimits{})
+        if _, ok := transTable.probe(b.Hash()); ok {
+            t.Fatalf("level %d stored the root in the shared table", level)
+        }
+    }
+    LevelEngine(MaxLevel).BestMove(context.Background(), b,
+        SearchLimits{Depth: 2})
+    if _, ok := transTable.probe(b.Hash()); !ok {
+        t.Errorf("full strength didn't use the shared table")
+    }
+}
+
+func TestLevelNoBlunders(t *testing.T) {
+    // even deliberate mistakes must not hang the queen
+    b, _ := ParseFEN("4k3/8/4p3/3p4/8/8/8/3QK3 w - - 0 1")
+    for i := 0; i < 20; i++ {
+        m, _ := LevelEngine(3).BestMove(context.Background(), b, SearchLimits{})
+        if m == (Move{Sq("d1"), Sq("d5")}) {
+            t.Fatalf("level 3 played Qxd5")
+        }
+    }
+}
+
+func TestLevelSuboptimal(t *testing.T) {
+    // capturing the queen is much better than any other move
+    b, _ := ParseFEN("4k3/8/8/3q4/4P3/8/8/4K3 w - - 0 1")
+    best := Move{Sq("e4"), Sq("d5")}
+    for i := 0; i < 10; i++ {
+        s := newSearcher(context.Background(), SearchLimits{Nodes: 50})
+        s.tt = NewTransTable(1)
+        s.searchParallel(&b.Position)
+        if !s.stopped {
+            t.Fatalf("the node limit wasn't reached")
+        }
+        if m := s.suboptimal(&b.Position, best); m != best {
+            t.Fatalf("deliberate mistake %v after the node limit", m)
+        }
+    }
+}
+
+// The gauntlet which calibrates the levels takes a long time and only runs
+// if the number of games is given, e.g.:
+//
+//	go test -run LevelGauntlet -levels=40 -v
+var levelGames = flag.Int("levels", 0,
+    "number of games per pair of neighboring levels played by TestLevelGauntlet")
+var levelNodes = flag.Int("levels.nodes", 100000,
+    "maximum number of nodes searched per move in TestLevelGauntlet")
+
+// levelGame plays a game between two engines from the position given in
+// FEN and returns the result from white's point of view. Games are
+// adjudicated as draws by threefold repetition, the fifty-move rule or
+// after 300 half-moves.
+func levelGame(t *testing.T, fen string, white, black Engine) float64 {
+    b, err := ParseFEN(fen)
+    if err != nil {
+        t.Fatal(err)
+    }
+    seen := make(map[uint64]int)
+    for i := 0; i < 300 && b.halfmove < 100; i++ {
+        if seen[b.Hash()]++; seen[b.Hash()] >= 3 {
+            return 0.5
+        }
+        if len(b.LegalMoves()) == 0 {
+            switch {
+            case !b.isCheck():
+                return 0.5
+            case b.color == White:
+                return 0
+            default:
+                return 1
+            }
+        }
+        e := white
+        if b.color == Black {
+            e = black
+        }
+        m, _ := e.BestMove(context.Background(), b,
+            SearchLimits{Nodes: *levelNodes, Threads: 1})
+        if !b.Move(m.Src, m.Dst) {
+            t.Fatalf("illegal move %v in %v", m, b.Position)
+        }
+    }
+    return 0.5
+}
+
+// TestLevelGauntlet plays matches between neighboring levels, starting
+// with the random mover against level 1, and rates the levels relative to
+// the random mover. All moves are limited to the same number of nodes,
+// which only restricts the strongest levels; by default full strength takes
+// about a second per move on a single core. The test fails if a level isn't
+// stronger than the one before.
+func TestLevelGauntlet(t *testing.T) {
+    if *levelGames <= 0 {
+        t.Skip("use -levels=n to play n games per pair of levels")
+    }
+    rating, n := 0.0, *levelGames
+    var weaker Engine = RandomEngine{}
+    for level := 1; level <= MaxLevel; level++ {
+        stronger, score := LevelEngine(level), 0.0
+        for i := 0; i < n; i++ {
+            fen := selfPlayOpenings[i/2%len(selfPlayOpenings)]
+            if i%2 == 0 {
+                score += levelGame(t, fen, stronger, weaker)
+            } else {
+                score += 1 - levelGame(t, fen, weaker, stronger)
+            }
+        }
+        // half a draw on each side keeps the difference finite
+        frac := (score + 0.5) / float64(n+1)
+        stderr := math.Sqrt(frac * (1 - frac) / float64(n))
+        rating += elo(frac)
+        t.Logf("level %2d: %+5.0f Elo (%.1f/%d against the level before)",
+            level, rating, score, n)
+        if frac+2*stderr < 0.5 {
+            t.Errorf("level %d isn't stronger than the level before: %.1f/%d",
+                level, score, n)
+        }
+        weaker = stronger
+    }
+}
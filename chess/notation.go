@@ -0,0 +1,240 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "bytes"
+    "fmt"
+    "strings"
+)
+
+// A Notation describes how moves are written down. Besides the standard
+// algebraic notation (SAN), the long algebraic notation, figurine notation,
+// the ICCF numeric notation and many localized variants are supported.
+type Notation struct {
+    // Pieces contains the symbols for each kind of piece, indexed by the
+    // piece constants P to K. The symbol for pawns is usually empty.
+    Pieces [7]string
+
+    // Long enables the long algebraic notation which always includes the
+    // source square of a move, e.g. "Ng1-f3".
+    Long bool
+
+    // Numeric enables the ICCF numeric notation, e.g. "7163" for Ng1-f3.
+    Numeric bool
+
+    // Coordinate enables the pure coordinate notation used by the UCI
+    // protocol, e.g. "g1f3" or "e7e8q".
+    Coordinate bool
+}
+
+var (
+    // SAN is the standard algebraic notation using English piece letters.
+    SAN = localized("N", "B", "R", "Q", "K")
+
+    // LAN is the long algebraic notation using English piece letters.
+    LAN = Notation{Pieces: SAN.Pieces, Long: true}
+
+    // FAN is the figurine algebraic notation, e.g. "♘f3".
+    FAN = localized("♘", "♗", "♖", "♕", "♔")
+
+    // ICCF is the numeric notation used in international correspondence
+    // chess, e.g. "7163".
+    ICCF = Notation{Numeric: true}
+
+    // UCI is the pure coordinate notation used by chess engines, e.g.
+    // "g1f3" and "e1g1" for castling kingside.
+    UCI = Notation{Coordinate: true}
+)
+
+// Notations contains all supported notations indexed by a short name.
+// Localized variants of the standard algebraic notation are indexed by their
+// ISO 639-1 language code.
+var Notations = map[string]Notation{
+    "san":  SAN,
+    "lan":  LAN,
+    "fan":  FAN,
+    "iccf": ICCF,
+    "uci":  UCI,
+    "en":   SAN,
+    "cs":   localized("J", "S", "V", "D", "K"),
+    "da":   localized("S", "L", "T", "D", "K"),
+    "de":   localized("S", "L", "T", "D", "K"),
+    "es":   localized("C", "A", "T", "D", "R"),
+    "fr":   localized("C", "F", "T", "D", "R"),
+    "hu":   localized("H", "F", "B", "V", "K"),
+    "it":   localized("C", "A", "T", "D", "R"),
+    "nl":   localized("P", "L", "T", "D", "K"),
+    "no":   localized("S", "L", "T", "D", "K"),
+    "pl":   localized("S", "G", "W", "H", "K"),
+    "pt":   localized("C", "B", "T", "D", "R"),
+    "ru":   localized("К", "С", "Л", "Ф", "Кр"),
+    "sv":   localized("S", "L", "T", "D", "K"),
+}
+
+// localized creates a new variant of the standard algebraic notation using
+// the given symbols for knights, bishops, rooks, queens and kings.
+func localized(n, b, r, q, k string) Notation {
+    return Notation{Pieces: [7]string{N: n, B: b, R: r, Q: q, K: k}}
+}
+
+// localPieces translates figurines and all localized piece letters which
+// stand for the same piece in every language and can not be confused with
+// the English ones. S (a knight in German, but a bishop in Czech) and H (a
+// queen in Polish, but a knight in Hungarian) are left to MoveText.
+var localPieces = strings.NewReplacer(
+    "♙", "P", "♘", "N", "♗", "B", "♖", "R", "♕", "Q", "♔", "K",
+    "♟", "P", "♞", "N", "♝", "B", "♜", "R", "♛", "Q", "♚", "K",
+    "C", "N", "L", "B", "F", "B", "A", "B", "G", "B",
+    "T", "R", "W", "R", "D", "Q",
+    "Кр", "K", "К", "N", "С", "B", "Л", "R", "Ф", "Q",
+)
+
+// MoveText applies a move given in the notation n.
+func (b *Board) MoveText(text string, n Notation) error {
+    if n.Numeric {
+        return b.moveNumeric(text)
+    }
+    if n.Coordinate {
+        m, err := ParseMove(text)
+        if err != nil {
+            return err
+        }
+        if !b.Move(m.Src, m.Dst) {
+            return fmt.Errorf("The move %q is invalid.", text)
+        }
+        return nil
+    }
+
+    // kings are replaced first, because the Russian "Кр" starts with "К"
+    var pairs []string
+    for p := K; p >= N; p-- {
+        if n.Pieces[p] != "" {
+            pairs = append(pairs, n.Pieces[p], SAN.Pieces[p])
+        }
+    }
+    return b.MoveSAN(strings.NewReplacer(pairs...).Replace(text))
+}
+
+// moveNumeric applies a move given in the ICCF numeric notation.
+func (b *Board) moveNumeric(text string) error {
+    if len(text) != 4 && len(text) != 5 {
+        return fmt.Errorf("invalid move text %q. Please use ICCF.", text)
+    }
+    var sq [2]Square
+    for i := range sq {
+        file, rank := text[2*i]-'1', text[2*i+1]-'1'
+        if file > 7 || rank > 7 {
+            return fmt.Errorf("invalid move text %q. Please use ICCF.", text)
+        }
+        sq[i] = Square(rank<<3 + file)
+    }
+    if len(text) == 5 && text[4] != '1' {
+        return fmt.Errorf("underpromotion is not supported")
+    }
+    if !b.Move(sq[0], sq[1]) {
+        return fmt.Errorf("The move %q is invalid.", text)
+    }
+    return nil
+}
+
+// ParseMove parses a move given in the pure coordinate notation, e.g. "g1f3"
+// or "e7e8q". Since pawns are always promoted to queens, other promotion
+// pieces are rejected.
+func ParseMove(text string) (Move, error) {
+    if len(text) != 4 && len(text) != 5 {
+        return Move{-1, -1}, fmt.Errorf("invalid move text %q", text)
+    }
+    var sq [2]Square
+    for i := range sq {
+        file, rank := text[2*i]-'a', text[2*i+1]-'1'
+        if file > 7 || rank > 7 {
+            return Move{-1, -1}, fmt.Errorf("invalid move text %q", text)
+        }
+        sq[i] = Square(rank<<3 + file)
+    }
+    if len(text) == 5 && text[4] != 'q' {
+        return Move{-1, -1}, fmt.Errorf("underpromotion is not supported")
+    }
+    return Move{sq[0], sq[1]}, nil
+}
+
+// FormatMove formats the legal move m using the notation n, without
+// applying it.
+func (p *Position) FormatMove(m Move, n Notation) string {
+    r := p.notate(m.Src, m.Dst)
+    q := p.Apply(m)
+    r.status = q.formatStatus()
+    return r.format(n)
+}
+
+// A record stores everything which is required to format a move in any
+// notation after it has been applied.
+type record struct {
+    piece      uint8  // piece kind without color
+    src, dst   Square // source and target square (of the king if castling)
+    file, rank bool   // source file or rank needed to dissolve ambiguity
+    capture    bool   // whetever a piece was captured
+    castle     bool   // whetever the move was a castling move
+    promote    uint8  // piece kind of a promoted pawn
+    status     string // check or checkmate annotation
+}
+
+// iccfPromotion contains the ICCF digits for promoted pieces.
+var iccfPromotion = [7]byte{Q: '1', R: '2', B: '3', N: '4'}
+
+// format formats the recorded move using the notation n.
+func (r *record) format(n Notation) string {
+    buf := &bytes.Buffer{}
+    if n.Numeric {
+        buf.Write([]byte{byte('1' + r.src&7), byte('1' + r.src>>3),
+            byte('1' + r.dst&7), byte('1' + r.dst>>3)})
+        if r.promote != 0 {
+            buf.WriteByte(iccfPromotion[r.promote])
+        }
+        return buf.String()
+    }
+    if n.Coordinate {
+        buf.WriteString(r.src.String())
+        buf.WriteString(r.dst.String())
+        if r.promote != 0 {
+            buf.WriteByte(" pnbrqk"[r.promote])
+        }
+        return buf.String()
+    }
+
+    switch {
+    case r.castle && r.dst > r.src:
+        buf.WriteString("0-0")
+    case r.castle:
+        buf.WriteString("0-0-0")
+    case n.Long:
+        buf.WriteString(n.Pieces[r.piece])
+        buf.WriteString(r.src.String())
+        if r.capture {
+            buf.WriteByte('x')
+        } else {
+            buf.WriteByte('-')
+        }
+        buf.WriteString(r.dst.String())
+    default:
+        buf.WriteString(n.Pieces[r.piece])
+        if r.file {
+            buf.WriteByte('a' + byte(r.src&7))
+        }
+        if r.rank {
+            buf.WriteByte('1' + byte(r.src>>3))
+        }
+        if r.capture {
+            buf.WriteByte('x')
+        }
+        buf.WriteString(r.dst.String())
+    }
+    if r.promote != 0 {
+        buf.WriteByte('=')
+        buf.WriteString(n.Pieces[r.promote])
+    }
+    buf.WriteString(r.status)
+    return buf.String()
+}
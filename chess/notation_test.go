@@ -0,0 +1,147 @@
+package chess
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestNotations(t *testing.T) {
+    b := NewBoard()
+    for _, mv := range strings.Fields("e4 e5 Nf3 Nc6 Bb5 a6 Bxc6 dxc6 O-O Qd4") {
+        if err := b.MoveSAN(mv); err != nil {
+            t.Fatalf("the move %q failed: %v", mv, err)
+        }
+    }
+    tests := []struct {
+        notation string
+        moves    string
+    }{
+        {"san", "e4 e5 Nf3 Nc6 Bb5 a6 Bxc6 dxc6 0-0 Qd4"},
+        {"lan", "e2-e4 e7-e5 Ng1-f3 Nb8-c6 Bf1-b5 a7-a6 Bb5xc6 d7xc6 0-0 Qd8-d4"},
+        {"fan", "e4 e5 ♘f3 ♘c6 ♗b5 a6 ♗xc6 dxc6 0-0 ♕d4"},
+        {"iccf", "5254 5755 7163 2836 6125 1716 2536 4736 5171 4844"},
+        {"de", "e4 e5 Sf3 Sc6 Lb5 a6 Lxc6 dxc6 0-0 Dd4"},
+        {"fr", "e4 e5 Cf3 Cc6 Fb5 a6 Fxc6 dxc6 0-0 Dd4"},
+        {"ru", "e4 e5 Кf3 Кc6 Сb5 a6 Сxc6 dxc6 0-0 Фd4"},
+    }
+    for _, test := range tests {
+        n := Notations[test.notation]
+        if got := strings.Join(b.History(n), " "); got != test.moves {
+            t.Errorf("unexpected %s history. want=%q, got=%q", test.notation,
+                test.moves, got)
+        }
+
+        // the moves must be parsed again by MoveText
+        c := NewBoard()
+        for _, mv := range strings.Fields(test.moves) {
+            if err := c.MoveText(mv, n); err != nil {
+                t.Fatalf("the %s move %q failed: %v", test.notation, mv, err)
+            }
+        }
+        if c.String() != b.String() {
+            t.Errorf("unexpected position after %s moves. want=%q, got=%q",
+                test.notation, b, c)
+        }
+    }
+}
+
+func TestNotationKing(t *testing.T) {
+    b := NewBoard()
+    for i, mv := range strings.Fields("e4 e5 Re2 Крe7") {
+        n := Notations["fr"]
+        if i%2 == 1 {
+            n = Notations["ru"]
+        }
+        if err := b.MoveText(mv, n); err != nil {
+            t.Fatalf("the move %q failed: %v", mv, err)
+        }
+    }
+    if got := strings.Join(b.History(SAN), " "); got != "e4 e5 Ke2 Ke7" {
+        t.Errorf("unexpected history %q", got)
+    }
+}
+
+func TestMoveSANLocalized(t *testing.T) {
+    b := NewBoard()
+    for _, mv := range strings.Fields("e4 ♞c6 Lc4 Ce5 Ke2") {
+        if err := b.MoveSAN(mv); err != nil {
+            t.Errorf("the move %q failed: %v", mv, err)
+        }
+    }
+    if got := strings.Join(b.History(SAN), " "); got != "e4 Nc6 Bc4 Ne5 Ke2" {
+        t.Errorf("unexpected history %q", got)
+    }
+
+    // S and H stand for different pieces in different languages
+    b = NewBoard()
+    for _, mv := range strings.Fields("Sf3 Hf3 Sc4 Hh4") {
+        if err := b.MoveSAN(mv); err == nil {
+            t.Errorf("the ambiguous move %q was accepted", mv)
+        }
+    }
+    b.MoveSAN("e4")
+    b.MoveSAN("e5")
+    tests := []struct {
+        mv, lang, want string
+    }{
+        {"Sc4", "cs", "Bc4"}, {"Hc6", "hu", "Nc6"},
+        {"Sf3", "de", "Nf3"}, {"Hh4", "pl", "Qh4"},
+    }
+    for _, test := range tests {
+        if err := b.MoveText(test.mv, Notations[test.lang]); err != nil {
+            t.Fatalf("the move %q (%s) failed: %v", test.mv, test.lang, err)
+        }
+        if got := b.LastMove(); got != test.want {
+            t.Errorf("%q (%s) was played as %q, want %q", test.mv, test.lang,
+                got, test.want)
+        }
+    }
+}
+
+func TestPromotion(t *testing.T) {
+    b, err := ParseFEN("8/P6k/8/8/8/8/8/K7 w - - 0 1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := b.MoveSAN("a8=Q"); err != nil {
+        t.Fatalf("promotion failed: %v", err)
+    }
+    if b.LastMove() != "a8=Q" || b.LastMoveIn(ICCF) != "17181" ||
+        b.LastMoveIn(Notations["de"]) != "a8=D" || b.LastMoveIn(UCI) != "a7a8q" {
+        t.Errorf("unexpected promotion %q", b.History(SAN))
+    }
+}
+
+func TestCoordinateNotation(t *testing.T) {
+    b := NewBoard()
+    for _, mv := range strings.Fields("e2e4 e7e5 g1f3 b8c6 f1c4 g8f6 e1g1") {
+        if err := b.MoveText(mv, UCI); err != nil {
+            t.Fatalf("the move %q failed: %v", mv, err)
+        }
+    }
+    if got := strings.Join(b.History(SAN), " "); got != "e4 e5 Nf3 Nc6 Bc4 Nf6 0-0" {
+        t.Errorf("unexpected history %q", got)
+    }
+    if got := b.LastMoveIn(UCI); got != "e1g1" {
+        t.Errorf("castling formatted as %q", got)
+    }
+    for _, mv := range []string{"e2e5", "e9e4", "i2i4", "e7e8n", "e2"} {
+        if err := b.MoveText(mv, UCI); err == nil {
+            t.Errorf("expected the move %q to fail", mv)
+        }
+    }
+}
+
+func TestFormatMove(t *testing.T) {
+    b, _ := ParseFEN("6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1")
+    m := Move{Sq("a1"), Sq("a8")}
+    if got := b.FormatMove(m, SAN); got != "Ra8#" {
+        t.Errorf("FormatMove(%v, SAN) = %q, want %q", m, got, "Ra8#")
+    }
+    if got := b.FormatMove(m, UCI); got != "a1a8" {
+        t.Errorf("FormatMove(%v, UCI) = %q, want %q", m, got, "a1a8")
+    }
+    if b.LastMove() != "" {
+        t.Errorf("FormatMove must not modify the board")
+    }
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+// Scores of the different stages of the move ordering. Moves of earlier
+// stages are searched first. Within each stage, moves are ordered by the
+// remaining part of the score.
+const (
+    orderHash    = 1 << 30  // the best move from the transposition table
+    orderCapture = 1 << 28  // winning and equal captures, by MVV-LVA
+    orderKiller  = 1 << 27  // quiet moves which caused cutoffs at this ply
+    orderCounter = 1 << 26  // the refutation of the previous move
+    orderLosing  = -1 << 20 // captures which lose material, after all others
+)
+
+// maximum value of history scores, before all of them are halved
+const maxHistory = 1 << 20
+
+// A scoredMove is a move together with its priority in the move ordering.
+type scoredMove struct {
+    Move
+    score int
+}
+
+// orderMoves generates all pseudo-legal moves of p and assigns the scores
+// for the move ordering.
+func (s *searcher) orderMoves(p *Position, first Move, ply int) []scoredMove {
+    moves := p.randomMoves(first, s.rand)
+    scored := make([]scoredMove, len(moves))
+    for i, m := range moves {
+        scored[i].Move = m
+        if s.noOrder {
+            continue
+        }
+        switch {
+        case m == first:
+            scored[i].score = orderHash
+        case !p.quiet(m):
+            mvvlva := 8*int(p.board[m.Dst]&PieceMask) -
+                int(p.board[m.Src]&PieceMask)
+            if p.see(m) >= 0 {
+                scored[i].score = orderCapture + mvvlva
+            } else {
+                scored[i].score = orderLosing + mvvlva
+            }
+        case m == s.killers[ply][0]:
+            scored[i].score = orderKiller + 1
+        case m == s.killers[ply][1]:
+            scored[i].score = orderKiller
+        case ply > 0 && s.path[ply-1].Src >= 0 &&
+            m == s.counter[s.path[ply-1].Src][s.path[ply-1].Dst]:
+            scored[i].score = orderCounter
+        default:
+            scored[i].score = s.history[p.color>>4][m.Src][m.Dst]
+        }
+    }
+    if s.noOrder && len(scored) > 0 && scored[0].Move == first {
+        scored[0].score = orderHash
+    }
+    return scored
+}
+
+// nextMove selects the move with the highest score of moves[i:] and swaps
+// it to position i. Only as many moves as necessary are sorted, since most
+// nodes are cut off after a few moves.
+func nextMove(moves []scoredMove, i int) Move {
+    best := i
+    for j := i + 1; j < len(moves); j++ {
+        if moves[j].score > moves[best].score {
+            best = j
+        }
+    }
+    moves[i], moves[best] = moves[best], moves[i]
+    return moves[i].Move
+}
+
+// cutoff remembers a quiet move which caused a beta cutoff as killer move,
+// counter move and in the history table.
+func (s *searcher) cutoff(p *Position, m Move, depth, ply int) {
+    if !p.quiet(m) {
+        return
+    }
+    if s.killers[ply][0] != m {
+        s.killers[ply][1], s.killers[ply][0] = s.killers[ply][0], m
+    }
+    if ply > 0 && s.path[ply-1].Src >= 0 {
+        s.counter[s.path[ply-1].Src][s.path[ply-1].Dst] = m
+    }
+    h := &s.history[p.color>>4]
+    if h[m.Src][m.Dst] += depth * depth; h[m.Src][m.Dst] > maxHistory {
+        for i := range h {
+            for j := range h[i] {
+                h[i][j] /= 2
+            }
+        }
+    }
+}
+
+// quiet checks if a move neither captures a piece nor promotes a pawn.
+func (p *Position) quiet(m Move) bool {
+    if p.board[m.Dst] != 0 {
+        return false
+    }
+    return p.board[m.Src]&PieceMask != P ||
+        (m.Dst != p.eps && m.Dst>>3 != 0 && m.Dst>>3 != 7)
+}
+
+// see performs a static exchange evaluation of the capture m. It returns
+// the material gained by the player to move, if both players keep
+// capturing on the destination square with their least valuable piece as
+// long as it's profitable. The receiver is used as scratch space.
+func (p Position) see(m Move) int {
+    var gain [32]int
+    gain[0] = pieceValues[p.board[m.Dst]&PieceMask].mg
+    attacker, d := m.Src, 0
+    for attacker >= 0 && d < len(gain)-1 {
+        d++
+        gain[d] = pieceValues[p.board[attacker]&PieceMask].mg - gain[d-1]
+        p.board[m.Dst], p.board[attacker] = p.board[attacker], 0
+        p.occupied &^= 1 << uint(attacker)
+        p.color ^= ColorMask
+        attacker = p.leastValuableAttacker(m.Dst)
+    }
+    for d--; d > 0; d-- {
+        if gain[d] > -gain[d-1] {
+            gain[d-1] = -gain[d]
+        }
+    }
+    return gain[0]
+}
+
+// leastValuableAttacker returns the square of the cheapest piece of the
+// current player which attacks sq, or -1 if there is none.
+func (p *Position) leastValuableAttacker(sq Square) Square {
+    best, value := Square(-1), K+1
+    for src := Square(0); src < 64; src++ {
+        piece := p.board[src]
+        if piece&ColorMask == p.color && piece&PieceMask < value &&
+            p.mayMove(src, sq) {
+            best, value = src, piece&PieceMask
+        }
+    }
+    return best
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "context"
+    "testing"
+)
+
+func TestSEE(t *testing.T) {
+    tests := []struct {
+        fen      string
+        src, dst string
+        see      int
+    }{
+        // undefended pawn
+        {"4k3/8/8/3p4/8/8/8/3QK3 w - - 0 1", "d1", "d5", 100},
+        // pawn defended by a pawn
+        {"4k3/8/4p3/3p4/8/8/8/3QK3 w - - 0 1", "d1", "d5", -800},
+        // knight takes a defended knight
+        {"4k3/8/4p3/3n4/8/2N5/8/4K3 w - - 0 1", "c3", "d5", 0},
+        // rook backed up by another rook (x-ray)
+        {"3rk3/8/8/3p4/8/8/3R4/3RK3 w - - 0 1", "d2", "d5", 100},
+        // the defender is the king
+        {"8/8/4k3/3p4/8/8/8/3QK3 w - - 0 1", "d1", "d5", -800},
+    }
+    for _, test := range tests {
+        b, err := ParseFEN(test.fen)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if see := b.Position.see(Move{Sq(test.src), Sq(test.dst)}); see != test.see {
+            t.Errorf("see(%s%s) in %q = %d, want %d", test.src, test.dst,
+                test.fen, see, test.see)
+        }
+    }
+}
+
+// A fixed set of positions for measuring the number of searched nodes.
+var orderingPositions = []string{
+    "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+    "r1bq1rk1/pp2bppp/2n1pn2/3p4/2PP4/2N2N2/PP2BPPP/R2QKB1R w KQ - 0 1",
+    "2rq1rk1/pb1nbppp/1p2pn2/2pp4/2PP4/1PNBPN2/PB3PPP/2RQ1RK1 w - - 0 1",
+    "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+}
+
+// searchNodes searches all positions of the set to a fixed depth and
+// returns the total number of nodes.
+func searchNodes(t testing.TB, depth int, noOrder bool) (nodes int) {
+    for _, fen := range orderingPositions {
+        b, err := ParseFEN(fen)
+        if err != nil {
+            t.Fatal(err)
+        }
+        s := newSearcher(context.Background(), SearchLimits{Depth: depth})
+        s.tt, s.noOrder = NewTransTable(4), noOrder
+        s.search(&b.Position)
+        nodes += s.nodes
+    }
+    return
+}
+
+func TestMoveOrdering(t *testing.T) {
+    ordered, unordered := searchNodes(t, 3, false), searchNodes(t, 3, true)
+    if ordered >= unordered {
+        t.Errorf("move ordering didn't reduce the number of nodes: %d >= %d",
+            ordered, unordered)
+    }
+}
+
+func benchmarkOrdering(b *testing.B, noOrder bool) {
+    nodes := 0
+    for i := 0; i < b.N; i++ {
+        nodes += searchNodes(b, 4, noOrder)
+    }
+    b.ReportMetric(float64(nodes)/float64(b.N), "nodes/op")
+}
+
+func BenchmarkOrdering(b *testing.B)   { benchmarkOrdering(b, false) }
+func BenchmarkNoOrdering(b *testing.B) { benchmarkOrdering(b, true) }
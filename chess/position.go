@@ -0,0 +1,639 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "bytes"
+    "fmt"
+    "strings"
+)
+
+// A Move describes a half-move from the square Src to the square Dst.
+// Castling moves are described by the movement of the king.
+type Move struct {
+    Src, Dst Square
+}
+
+// String formats the move using the pure coordinate notation, e.g. "g1f3".
+func (m Move) String() string {
+    return m.Src.String() + m.Dst.String()
+}
+
+// Position stores a full chess position. In addition to the placement of all
+// pieces, some additional information is required, including the side to
+// move, castling rights and a possible en passant target.
+//
+// Positions are immutable values. None of the methods modifies the position
+// it is called on and applying a move returns a new position instead. Since
+// a position is small, it is cheap to copy and can be shared between
+// goroutines without any synchronization.
+type Position struct {
+
+    // board is a square centric representation of all pieces.
+    board [64]uint8
+
+    // occupied is a piece centric representation of all occupied squares.
+    occupied Bitboard
+
+    // moved tracks the corners of rooks which lost their castling rights
+    // (see movedSquares)
+    moved Bitboard
+
+    // color of the current side to move
+    color uint8
+
+    // possible square for en-passant captures
+    eps Square
+
+    // is the current player in check or stalemate? Both flags are only
+    // maintained by Apply, the search works with the raw move method.
+    check, stalemate bool
+
+    // number of half-moves since the last capture or pawn advance
+    halfmove int
+
+    // number of half-moves played since the start of the game
+    ply int
+}
+
+// String returns a compact textual representation of the position using
+// FEN (Forsythe-Edwards Notation).
+func (p Position) String() string {
+    buf := &bytes.Buffer{}
+    for rank := 7; rank >= 0; rank-- {
+        empty := 0
+        for file := 0; file <= 7; file++ {
+            if piece := p.board[file+rank<<3]; piece != 0 {
+                if empty > 0 {
+                    buf.WriteByte(byte('0' + empty))
+                    empty = 0
+                }
+                switch piece & ColorMask {
+                case White:
+                    buf.WriteByte(" PNBRQK"[piece&PieceMask])
+                case Black:
+                    buf.WriteByte(" pnbrqk"[piece&PieceMask])
+                }
+            } else {
+                empty++
+            }
+        }
+        if empty > 0 {
+            buf.WriteByte(byte('0' + empty))
+        }
+        if rank != 0 {
+            buf.WriteByte('/')
+        }
+    }
+    switch p.color {
+    case White:
+        buf.WriteString(" w ")
+    case Black:
+        buf.WriteString(" b ")
+    }
+    rights := p.castling()
+    for i := uint(0); i < 4; i++ {
+        if rights&(1<<i) != 0 {
+            buf.WriteByte("KQkq"[i])
+        }
+    }
+    if rights == 0 {
+        buf.WriteByte('-')
+    }
+    if p.eps >= 0 {
+        fmt.Fprintf(buf, " %v", p.eps)
+    } else {
+        buf.WriteString(" -")
+    }
+    fmt.Fprintf(buf, " %d %d", p.halfmove, p.ply/2+1)
+    return buf.String()
+}
+
+// ParsePosition parses a position given in FEN (Forsyth-Edwards Notation).
+// Only the piece placement is mandatory, missing fields default to white to
+// move, no castling rights and no en passant target square.
+func ParsePosition(fen string) (Position, error) {
+    fields := strings.Fields(fen)
+    if len(fields) == 0 || len(fields) > 6 {
+        return Position{}, fmt.Errorf("invalid FEN %q", fen)
+    }
+    p := Position{color: White, eps: -1, moved: 0x91 | 0x91<<56}
+
+    ranks := strings.Split(fields[0], "/")
+    if len(ranks) != 8 {
+        return Position{}, fmt.Errorf("invalid FEN %q: expected 8 ranks", fen)
+    }
+    kings := [2]int{}
+    for i, row := range ranks {
+        rank, file := 7-i, 0
+        for _, c := range row {
+            if c >= '1' && c <= '8' {
+                file += int(c - '0')
+                continue
+            }
+            piece := uint8(strings.IndexRune(" PNBRQK", c)) | White
+            if c >= 'a' && c <= 'z' {
+                piece = uint8(strings.IndexRune(" pnbrqk", c)) | Black
+            }
+            if piece&PieceMask == 0 || piece&PieceMask > K || file > 7 {
+                return Position{}, fmt.Errorf("invalid FEN %q: bad rank %q", fen, row)
+            }
+            if piece&PieceMask == K {
+                kings[piece>>4]++
+            }
+            p.board[rank<<3+file] = piece
+            p.occupied |= Bitboard(1) << uint(rank<<3+file)
+            file++
+        }
+        if file != 8 {
+            return Position{}, fmt.Errorf("invalid FEN %q: bad rank %q", fen, row)
+        }
+    }
+    if kings[0] != 1 || kings[1] != 1 {
+        return Position{}, fmt.Errorf("invalid FEN %q: each side needs one king", fen)
+    }
+
+    if len(fields) > 1 {
+        switch fields[1] {
+        case "w":
+        case "b":
+            p.color = Black
+        default:
+            return Position{}, fmt.Errorf("invalid FEN %q: bad color %q", fen, fields[1])
+        }
+    }
+    if len(fields) > 2 && fields[2] != "-" {
+        for _, c := range fields[2] {
+            switch c {
+            case 'K':
+                p.moved &^= 0x90
+            case 'Q':
+                p.moved &^= 0x11
+            case 'k':
+                p.moved &^= 0x90 << 56
+            case 'q':
+                p.moved &^= 0x11 << 56
+            default:
+                return Position{}, fmt.Errorf("invalid FEN %q: bad castling rights", fen)
+            }
+        }
+    }
+    if len(fields) > 3 && fields[3] != "-" {
+        v := fields[3]
+        if len(v) != 2 || v[0] < 'a' || v[0] > 'h' || (v[1] != '3' && v[1] != '6') {
+            return Position{}, fmt.Errorf("invalid FEN %q: bad en passant square", fen)
+        }
+        p.eps = Square((v[1]-'1')*8 + v[0] - 'a')
+    }
+    if len(fields) > 4 {
+        if _, err := fmt.Sscan(fields[4], &p.halfmove); err != nil || p.halfmove < 0 {
+            return Position{}, fmt.Errorf("invalid FEN %q: bad halfmove clock", fen)
+        }
+    }
+    if len(fields) > 5 {
+        fullmove := 0
+        if _, err := fmt.Sscan(fields[5], &fullmove); err != nil || fullmove < 1 {
+            return Position{}, fmt.Errorf("invalid FEN %q: bad move number", fen)
+        }
+        p.ply = 2 * (fullmove - 1)
+    }
+    if p.color == Black {
+        p.ply++
+    }
+
+    p.moved = movedSquares(p.castling())
+    p.check, p.stalemate = p.isCheck(), p.isStalemate()
+    return p, nil
+}
+
+// castling returns the remaining castling rights as a bitmask. The bits
+// 0 to 3 are set if white can castle kingside or queenside and if black can
+// castle kingside or queenside respectively.
+func (p *Position) castling() (rights uint8) {
+    if p.moved&0x90 == 0 && p.board[4] == K|White && p.board[7] == R|White {
+        rights |= 1
+    }
+    if p.moved&0x11 == 0 && p.board[4] == K|White && p.board[0] == R|White {
+        rights |= 2
+    }
+    if p.moved&(0x90<<56) == 0 && p.board[60] == K|Black && p.board[63] == R|Black {
+        rights |= 4
+    }
+    if p.moved&(0x11<<56) == 0 && p.board[60] == K|Black && p.board[56] == R|Black {
+        rights |= 8
+    }
+    return
+}
+
+// movedSquares returns the canonical bitboard of moved squares for the given
+// castling rights. Only the corner of each rook which lost its right to
+// castle is marked, so that equal positions are also equal values.
+func movedSquares(rights uint8) (moved Bitboard) {
+    if rights&1 == 0 {
+        moved |= 1 << 7
+    }
+    if rights&2 == 0 {
+        moved |= 1 << 0
+    }
+    if rights&4 == 0 {
+        moved |= 1 << 63
+    }
+    if rights&8 == 0 {
+        moved |= 1 << 56
+    }
+    return
+}
+
+// Hash returns a Zobrist hash of the position. Positions which are equal
+// with regard to the placement of all pieces, the side to move, castling
+// rights and possible en passant captures share the same hash, regardless of
+// the move order which lead to them.
+func (p *Position) Hash() (h uint64) {
+    for sq := Square(0); sq < 64; sq++ {
+        if piece := p.board[sq]; piece != 0 {
+            h ^= zobrist.pieces[piece>>4][piece&PieceMask][sq]
+        }
+    }
+    h ^= zobrist.castling[p.castling()]
+    if p.epCapture() {
+        h ^= zobrist.eps[p.eps&7]
+    }
+    if p.color == Black {
+        h ^= zobrist.color
+    }
+    return
+}
+
+// epCapture checks if a pawn of the current player stands next to the
+// pawn which has just advanced two squares. The en passant square only
+// matters for hashing if such a capture is possible.
+func (p *Position) epCapture() bool {
+    if p.eps < 0 {
+        return false
+    }
+    pawn, rank := P|p.color, p.eps&^7-8
+    if p.color == Black {
+        rank = p.eps&^7 + 8
+    }
+    return (p.eps&7 > 0 && p.board[rank+p.eps&7-1] == pawn) ||
+        (p.eps&7 < 7 && p.board[rank+p.eps&7+1] == pawn)
+}
+
+// zobrist contains the random keys used for hashing positions. The keys are
+// generated with a fixed seed, so that hashes are stable between runs.
+var zobrist struct {
+    pieces   [2][7][64]uint64
+    castling [16]uint64
+    eps      [8]uint64
+    color    uint64
+}
+
+// init generates the keys of the zobrist table using the SplitMix64
+// generator.
+func init() {
+    seed := uint64(0x43686573734275)
+    next := func() uint64 {
+        seed += 0x9e3779b97f4a7c15
+        z := seed
+        z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+        z = (z ^ z>>27) * 0x94d049bb133111eb
+        return z ^ z>>31
+    }
+    for c := range zobrist.pieces {
+        for p := range zobrist.pieces[c] {
+            for sq := range zobrist.pieces[c][p] {
+                zobrist.pieces[c][p][sq] = next()
+            }
+        }
+    }
+    for i := range zobrist.castling {
+        zobrist.castling[i] = next()
+    }
+    zobrist.castling[0] = 0
+    for i := range zobrist.eps {
+        zobrist.eps[i] = next()
+    }
+    zobrist.color = next()
+}
+
+// Legal checks if the move m is legal in this position.
+func (p *Position) Legal(m Move) bool {
+    if m.Src < 0 || m.Src >= 64 || m.Dst < 0 || m.Dst >= 64 ||
+        p.board[m.Src]&ColorMask != p.color {
+        return false
+    }
+    home := Square(4)
+    if p.color == Black {
+        home = 60
+    }
+    if p.board[m.Src]&PieceMask == K && m.Src == home {
+        switch m.Dst - m.Src {
+        case 2:
+            return p.canCastle(m.Src, m.Src+3)
+        case -2:
+            return p.canCastle(m.Src, m.Src-4)
+        }
+    }
+    return p.canMove(m.Src, m.Dst)
+}
+
+// Apply returns the position after the move m has been played. The
+// position p itself is not modified. Illegal moves are ignored and the
+// unchanged position is returned instead.
+func (p Position) Apply(m Move) Position {
+    if !p.Legal(m) {
+        return p
+    }
+    p.move(m.Src, m.Dst)
+    p.check, p.stalemate = p.isCheck(), p.isStalemate()
+    return p
+}
+
+// Moves generates a list of all possible target squares for a specific piece
+// located at the square src.
+func (p *Position) Moves(src Square) (moves []Square) {
+    for dst := Square(0); dst < 64; dst++ {
+        if p.Legal(Move{src, dst}) {
+            moves = append(moves, dst)
+        }
+    }
+    return
+}
+
+// LegalMoves generates a list of all legal moves in this position. The moves
+// are ordered by their source and target squares.
+func (p *Position) LegalMoves() (moves []Move) {
+    for src := Square(0); src < 64; src++ {
+        if p.board[src]&ColorMask != p.color {
+            continue
+        }
+        for dst := Square(0); dst < 64; dst++ {
+            if m := (Move{src, dst}); p.Legal(m) {
+                moves = append(moves, m)
+            }
+        }
+    }
+    return
+}
+
+// move applies a move from src to dst without checking if the move is legal.
+// The check and stalemate flags are not updated.
+func (p *Position) move(src, dst Square) {
+    piece := p.board[src]
+    p.halfmove++
+    if piece&PieceMask == P || p.board[dst] != 0 {
+        p.halfmove = 0
+    }
+    p.board[dst], p.board[src] = piece, 0
+    p.occupied &^= Bitboard(1) << uint(src)
+    p.occupied |= Bitboard(1) << uint(dst)
+
+    // additional rules for castling and en-passant captures
+    switch {
+    case piece&PieceMask == K && dst-src == 2:
+        p.board[dst-1], p.board[dst+1] = p.board[dst+1], 0
+        p.occupied &^= Bitboard(1) << uint(dst+1)
+        p.occupied |= Bitboard(1) << uint(dst-1)
+    case piece&PieceMask == K && src-dst == 2:
+        p.board[dst+1], p.board[dst-2] = p.board[dst-2], 0
+        p.occupied &^= Bitboard(1) << uint(dst-2)
+        p.occupied |= Bitboard(1) << uint(dst+1)
+    case piece == P|White && dst == p.eps:
+        p.board[dst-8] = 0
+        p.occupied &^= Bitboard(1) << uint(dst-8)
+    case piece == P|Black && dst == p.eps:
+        p.board[dst+8] = 0
+        p.occupied &^= Bitboard(1) << uint(dst+8)
+    }
+    p.eps = -1
+    if piece == P|White && dst-src == 16 {
+        p.eps = dst - 8
+    } else if piece == P|Black && dst-src == -16 {
+        p.eps = dst + 8
+    }
+
+    // promotion
+    if piece&PieceMask == P && (dst>>3 == 0 || dst>>3 == 7) {
+        p.board[dst] = Q | (piece & ColorMask)
+    }
+
+    p.moved |= (Bitboard(1) << uint(src)) | (Bitboard(1) << uint(dst))
+    p.moved = movedSquares(p.castling())
+    p.color ^= ColorMask
+    p.ply++
+}
+
+// nullMove passes the turn to the opponent without moving a piece. It's
+// used by the search only and isn't a legal move.
+func (p *Position) nullMove() {
+    p.eps = -1
+    p.halfmove++
+    p.color ^= ColorMask
+    p.ply++
+}
+
+// mayMove checks whetever it might be possible to move from src to dst. This
+// method ignores castling rules and might report pseud-legal moves.
+func (p *Position) mayMove(src, dst Square) bool {
+    piece, victim := p.board[src], p.board[dst]
+
+    // must not capture own pieces
+    if piece&ColorMask == victim&ColorMask {
+        return false
+    }
+
+    // check basic movement patterns
+    x88diff := int(dst - src + (dst | 7) - (src | 7) + 120)
+    occ := p.occupied>>Bitboard(src) | p.occupied<<Bitboard(64-src)
+    if blockers[piece&PieceMask][x88diff]&occ != 0 {
+        return false
+    }
+
+    // additional rules for pawn movements and captures
+    if piece&PieceMask == P &&
+        ((p.board[dst] == 0 && src&7 != dst&7 && dst != p.eps) ||
+            (piece == P|White && (src > dst || (x88diff == 152 && src>>3 != 1))) ||
+            (piece == P|Black && (src < dst || (x88diff == 88 && src>>3 != 6)))) {
+        return false
+    }
+
+    return true
+}
+
+// canMove checks if its possible to move from src to dst. This method ignores
+// castling rules. The receiver is a copy which is used as scratch space.
+func (p Position) canMove(src, dst Square) bool {
+    if !p.mayMove(src, dst) {
+        return false
+    }
+    if p.board[src]&PieceMask == P && dst == p.eps {
+        p.board[dst&7|src&^7] = 0
+        p.occupied &^= Bitboard(1) << uint(dst&7|src&^7)
+    }
+    p.board[dst], p.board[src] = p.board[src], 0
+    p.occupied &^= Bitboard(1) << uint(src)
+    p.occupied |= Bitboard(1) << uint(dst)
+    return !p.isCheck()
+}
+
+// canCastle checks if its possible to castle with the given king and
+// rook position. The receiver is a copy which is used as scratch space.
+func (p Position) canCastle(king, rook Square) bool {
+    right := uint8(1)
+    if rook < king {
+        right = 2
+    }
+    if p.color == Black {
+        right <<= 2
+    }
+    if p.castling()&right == 0 {
+        return false
+    }
+    nking, step := king+2, Square(1)
+    if rook < king {
+        nking, step = king-2, Square(-1)
+    }
+
+    // all squares between the king and the rook must be empty
+    for sq := king + step; sq != rook; sq += step {
+        if p.board[sq] != 0 {
+            return false
+        }
+    }
+
+    // one cannot castle out of, through, or into check
+    if p.isCheck() {
+        return false
+    }
+    for sq := king; sq != nking; sq += step {
+        p.board[sq+step], p.board[sq] = p.board[sq], 0
+        p.occupied &^= Bitboard(1) << uint(sq)
+        p.occupied |= Bitboard(1) << uint(sq+step)
+        if p.isCheck() {
+            return false
+        }
+    }
+    return true
+}
+
+// isCheck returns true if the current player is in check.
+func (p *Position) isCheck() bool {
+    return p.inCheck(p.color)
+}
+
+// inCheck returns true if the king of the given color is attacked.
+func (p *Position) inCheck(color uint8) bool {
+    dst, piece := Square(0), K|color
+    for sq := Square(0); sq < 64; sq++ {
+        if p.board[sq] == piece {
+            dst = sq
+            break
+        }
+    }
+    opponent := color ^ ColorMask
+    for src := Square(0); src < 64; src++ {
+        if p.board[src]&ColorMask == opponent && p.mayMove(src, dst) {
+            return true
+        }
+    }
+    return false
+}
+
+// isStalemate returns true if the current player can not make any moves
+// anymore.
+func (p *Position) isStalemate() bool {
+    for src := Square(0); src < 64; src++ {
+        if p.board[src]&ColorMask != p.color {
+            continue
+        }
+        for dst := Square(0); dst < 64; dst++ {
+            if p.canMove(src, dst) {
+                return false
+            }
+        }
+    }
+    return true
+}
+
+// notate records a move from src to dst, so that it can be formatted later.
+// This method must be called before the move was applied to dissolve
+// ambiguity and to detect captures properly.
+func (p *Position) notate(src, dst Square) (r record) {
+    r.piece, r.src, r.dst = p.board[src]&PieceMask, src, dst
+    if r.piece == K && (dst-src == 2 || src-dst == 2) {
+        r.castle = true
+        return
+    }
+
+    // check if the rank or file is ambigous
+    for sq := Square(0); sq < 64; sq++ {
+        if p.board[sq] == p.board[src] && sq != src && p.canMove(sq, dst) {
+            if sq&7 != src&7 {
+                r.file = true
+            } else {
+                r.rank = true
+            }
+        }
+    }
+    // pawn captures always include the file, even if not ambigous
+    r.capture = p.board[dst] != 0 || (r.piece == P && p.eps == dst)
+    if r.piece == P {
+        r.file, r.rank = r.capture, false
+        if dst>>3 == 0 || dst>>3 == 7 {
+            r.promote = Q
+        }
+    }
+    return
+}
+
+// formatStatus returns the proper SAN annotations for moves which result
+// in a check or checkmate.
+func (p *Position) formatStatus() string {
+    if p.check {
+        if p.stalemate {
+            return "#"
+        } else {
+            return "+"
+        }
+    }
+    return ""
+}
+
+// Checkmate returns true if the current player is checkmate.
+func (p *Position) Checkmate() bool {
+    return p.check && p.stalemate
+}
+
+// Stalemate returns true if the current player is stalemate.
+func (p *Position) Stalemate() bool {
+    return !p.check && p.stalemate
+}
+
+// Check returns true if the current player is in check only. This method
+// returns false if the player is checkmate.
+func (p *Position) Check() bool {
+    return p.check && !p.stalemate
+}
+
+// Color returns the color of the current side to play.
+func (p *Position) Color() uint8 {
+    return p.color
+}
+
+// Turn returns the current halfturn number starting by one.
+func (p *Position) Turn() int {
+    return p.ply + 1
+}
+
+// HalfMoveClock returns the number of half-moves since the last capture or
+// pawn advance, which is used for the fifty-move rule.
+func (p *Position) HalfMoveClock() int {
+    return p.halfmove
+}
+
+// Piece returns the piece (including its color) which is located at the
+// square sq or zero if the square is empty.
+func (p *Position) Piece(sq Square) uint8 {
+    return p.board[sq]
+}
@@ -0,0 +1,129 @@
+package chess
+
+import (
+    "sync"
+    "testing"
+)
+
+func perft(p Position, depth int) int {
+    if depth == 0 {
+        return 1
+    }
+    nodes := 0
+    for _, m := range p.LegalMoves() {
+        nodes += perft(p.Apply(m), depth-1)
+    }
+    return nodes
+}
+
+func TestPerft(t *testing.T) {
+    tests := []struct {
+        fen   string
+        depth int
+        nodes int
+    }{
+        {"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", 3, 8902},
+        {"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", 2, 2039},
+        {"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", 3, 2812},
+    }
+    for _, test := range tests {
+        p, err := ParsePosition(test.fen)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if nodes := perft(p, test.depth); nodes != test.nodes {
+            t.Errorf("perft(%q, %d) = %d, want %d", test.fen, test.depth,
+                nodes, test.nodes)
+        }
+    }
+}
+
+func TestApply(t *testing.T) {
+    p := NewBoard().Position
+    q := p.Apply(Move{Sq("e2"), Sq("e4")})
+    if p.String() != "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1" {
+        t.Errorf("Apply modified the original position: %v", p)
+    }
+    if q.String() != "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1" {
+        t.Errorf("unexpected position after e4: %v", q)
+    }
+    if r := q.Apply(Move{Sq("e4"), Sq("e5")}); r != q {
+        t.Errorf("Apply should ignore illegal moves: %v", r)
+    }
+}
+
+func TestCastling(t *testing.T) {
+    tests := []struct {
+        fen   string
+        move  Move
+        legal bool
+    }{
+        {"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", Move{Sq("e1"), Sq("g1")}, true},
+        {"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", Move{Sq("e1"), Sq("c1")}, true},
+        {"r3k2r/8/8/8/8/8/8/R3K2R w Qkq - 0 1", Move{Sq("e1"), Sq("g1")}, false},
+        {"r3k2r/8/8/8/8/8/8/R3K1nR w KQkq - 0 1", Move{Sq("e1"), Sq("g1")}, false},
+        {"r3k2r/8/8/8/8/8/8/Rn2K2R w KQkq - 0 1", Move{Sq("e1"), Sq("c1")}, false},
+        {"r3k2r/8/8/8/8/8/8/R3K2b w Qkq - 0 1", Move{Sq("e1"), Sq("g1")}, false},
+        {"r3k2r/8/8/8/8/8/5r2/R3K2R w KQkq - 0 1", Move{Sq("e1"), Sq("g1")}, false},
+        {"r3k2r/8/8/8/8/8/4r3/R3K2R w KQkq - 0 1", Move{Sq("e1"), Sq("c1")}, false},
+        {"r3k2r/8/8/8/8/8/1r6/R3K2R w KQkq - 0 1", Move{Sq("e1"), Sq("c1")}, true},
+        {"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", Move{Sq("e8"), Sq("c8")}, true},
+        // only kings on their home squares can castle
+        {"4k3/8/8/8/4K2R/8/8/8 w - - 0 1", Move{Sq("e4"), Sq("g4")}, false},
+        {"4k3/8/8/8/R3K3/8/8/8 w - - 0 1", Move{Sq("e4"), Sq("c4")}, false},
+        {"8/8/8/8/4k2r/8/8/4K3 b - - 0 1", Move{Sq("e4"), Sq("g4")}, false},
+        {"4k3/8/8/8/8/8/8/4K2R w - - 0 1", Move{Sq("e1"), Sq("g1")}, false},
+    }
+    for _, test := range tests {
+        p, err := ParsePosition(test.fen)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if p.Legal(test.move) != test.legal {
+            t.Errorf("Legal(%v) in %q should be %v", test.move, test.fen,
+                test.legal)
+        }
+    }
+
+    // capturing a rook removes the castling rights
+    b, _ := ParseFEN("r3k2r/8/8/8/8/8/6b1/R3K2R b KQkq - 0 1")
+    if err := b.MoveSAN("Bxh1"); err != nil {
+        t.Fatal(err)
+    }
+    if b.String() != "r3k2r/8/8/8/8/8/8/R3K2b w Qkq - 0 2" {
+        t.Errorf("unexpected castling rights: %v", b)
+    }
+}
+
+func TestPositionConcurrent(t *testing.T) {
+    b := NewBoard()
+    for _, mv := range []string{"e4", "e5", "Nf3", "Nc6", "Bc4", "Nf6"} {
+        if err := b.MoveSAN(mv); err != nil {
+            t.Fatal(err)
+        }
+    }
+    p := b.Position
+    want, moves := p.String(), p.LegalMoves()
+
+    var wg sync.WaitGroup
+    for i := 0; i < 8; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for j := 0; j < 10; j++ {
+                for _, m := range p.LegalMoves() {
+                    q := p.Apply(m)
+                    q.Moves(m.Dst)
+                    q.Hash()
+                }
+                p.Hash()
+                if p.String() != want || len(p.LegalMoves()) != len(moves) {
+                    t.Errorf("position changed during concurrent queries")
+                }
+            }
+        }()
+    }
+    // the board can be modified while others are analyzing a snapshot
+    b.MoveSAN("0-0")
+    wg.Wait()
+}
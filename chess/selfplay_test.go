@@ -0,0 +1,130 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "context"
+    "flag"
+    "math"
+    "testing"
+)
+
+// The self-play regression test takes a long time and only runs if the
+// number of games is given, e.g.:
+//
+//	go test -run SelfPlay -selfplay=40 -v
+var selfPlayGames = flag.Int("selfplay", 0,
+    "number of self-play games per technique played by TestSelfPlay")
+var selfPlayNodes = flag.Int("selfplay.nodes", 5000,
+    "number of nodes searched per move in TestSelfPlay")
+
+// Balanced positions after a few opening moves, which are played with
+// both colors.
+var selfPlayOpenings = []string{
+    "rnbqkbnr/pppp1ppp/8/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2",
+    "rnbqkbnr/pp1ppppp/8/2p5/4P3/8/PPPP1PPP/RNBQKBNR w KQkq c6 0 2",
+    "rnbqkb1r/pppppp1p/5np1/8/2PP4/8/PP2PPPP/RNBQKBNR w KQkq - 0 3",
+    "rnbqkbnr/ppp2ppp/4p3/3p4/3PP3/8/PPP2PPP/RNBQKBNR w KQkq d6 0 3",
+    "r1bqkbnr/pppp1ppp/2n5/1B2p3/4P3/5N2/PPPP1PPP/RNBQK2R b KQkq - 3 3",
+    "rnbqkbnr/pp2pppp/2p5/3p4/2PP4/8/PP2PPPP/RNBQKBNR w KQkq - 0 3",
+    "rnbqkb1r/pppp1ppp/4pn2/8/2PP4/2N5/PP2PPPP/R1BQKBNR b KQkq - 1 3",
+    "rnbqkbnr/ppp1pppp/8/3p4/3P4/5N2/PPP1PPPP/RNBQKB1R b KQkq - 1 2",
+}
+
+// A player of a self-play game, which keeps its transposition table.
+type selfPlayer struct {
+    disabled technique
+    tt       *TransTable
+    depth    int // sum of the depths reached
+    moves    int
+}
+
+func (pl *selfPlayer) move(p *Position) Move {
+    s := newSearcher(context.Background(), SearchLimits{Nodes: *selfPlayNodes})
+    s.tt, s.disabled = pl.tt, pl.disabled
+    s.tt.newSearch()
+    m := s.search(p)
+    pl.depth += s.info.Depth
+    pl.moves++
+    return m
+}
+
+// selfPlayGame plays a game from the position given in FEN and returns
+// the result from white's point of view. Games are adjudicated as draws
+// by the fifty-move rule or after 300 half-moves.
+func selfPlayGame(t *testing.T, fen string, white, black *selfPlayer) float64 {
+    b, err := ParseFEN(fen)
+    if err != nil {
+        t.Fatal(err)
+    }
+    p := b.Position
+    for i := 0; i < 300 && p.halfmove < 100; i++ {
+        if len(p.LegalMoves()) == 0 {
+            switch {
+            case !p.isCheck():
+                return 0.5
+            case p.color == White:
+                return 0
+            default:
+                return 1
+            }
+        }
+        pl := white
+        if p.color == Black {
+            pl = black
+        }
+        p = p.Apply(pl.move(&p))
+    }
+    return 0.5
+}
+
+// TestSelfPlay plays matches of the full search against versions with one
+// selective search technique disabled. All players search the same number
+// of nodes, so a technique has to make up for the errors it introduces by
+// reaching a higher depth. The test fails if a technique loses strength
+// significantly.
+func TestSelfPlay(t *testing.T) {
+    if *selfPlayGames <= 0 {
+        t.Skip("use -selfplay=n to play n games per technique")
+    }
+    techniques := []struct {
+        name string
+        t    technique
+    }{
+        {"null-move pruning", nullMovePruning},
+        {"late move reductions", lateMoveReductions},
+        {"check extensions", checkExtensions},
+        {"futility pruning", futilityPruning},
+        {"aspiration windows", aspirationWindows},
+    }
+    for _, tech := range techniques {
+        with := &selfPlayer{tt: NewTransTable(4)}
+        without := &selfPlayer{disabled: tech.t, tt: NewTransTable(4)}
+        score, n := 0.0, *selfPlayGames
+        for i := 0; i < n; i++ {
+            fen := selfPlayOpenings[i/2%len(selfPlayOpenings)]
+            if i%2 == 0 {
+                score += selfPlayGame(t, fen, with, without)
+            } else {
+                score += 1 - selfPlayGame(t, fen, without, with)
+            }
+        }
+        frac := score / float64(n)
+        stderr := math.Sqrt(frac * (1 - frac) / float64(n))
+        t.Logf("%-20s %+6.0f Elo (%.1f/%d), depth %.2f vs %.2f", tech.name,
+            elo(frac), score, n, float64(with.depth)/float64(with.moves),
+            float64(without.depth)/float64(without.moves))
+        if frac+2*stderr < 0.5 {
+            t.Errorf("%s loses strength: %.1f/%d", tech.name, score, n)
+        }
+    }
+}
+
+// elo converts a score fraction into an Elo difference.
+func elo(frac float64) float64 {
+    if frac <= 0 || frac >= 1 {
+        return math.Copysign(math.Inf(1), frac-0.5)
+    }
+    return -400 * math.Log10(1/frac-1)
+}
@@ -0,0 +1,1050 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+)
+
+// WDL is the result of a position with perfect play according to the
+// endgame tablebases, from the point of view of the player to move. Cursed
+// wins and blessed losses are drawn by the fifty-move rule.
+type WDL int
+
+const (
+    WDLLoss        WDL = iota - 2 // the player loses
+    WDLBlessedLoss                // the player loses, but can claim a draw
+    WDLDraw                       // the game is drawn
+    WDLCursedWin                  // the player wins, but the opponent can claim a draw
+    WDLWin                        // the player wins
+)
+
+func (w WDL) String() string {
+    switch w {
+    case WDLLoss:
+        return "loss"
+    case WDLBlessedLoss:
+        return "blessed loss"
+    case WDLDraw:
+        return "draw"
+    case WDLCursedWin:
+        return "cursed win"
+    case WDLWin:
+        return "win"
+    }
+    return fmt.Sprintf("WDL(%d)", int(w))
+}
+
+// ErrNotInTablebases is returned if no tablebase contains the position.
+var ErrNotInTablebases = errors.New("chess: position not in the tablebases")
+
+// ErrInvalidTablebase is returned if a file isn't a valid Syzygy table.
+var ErrInvalidTablebase = errors.New("chess: invalid syzygy tablebase")
+
+// tablebases are the Syzygy endgame tablebases, which contain all
+// positions with a few pieces. Every material combination is stored in
+// two files, e.g. KQvK.rtbw and KQvK.rtbz. The WDL file stores the result
+// of each position for both sides to move, the DTZ file the distance to
+// the next capture or pawn move (which zeroes the fifty-move counter)
+// with optimal play, usually for one side to move only. Positions with
+// castling rights aren't contained. The stored values of positions in
+// which a capture is the best move might be wrong, so captures are always
+// resolved by a small search first.
+//
+// Both files start with a magic number, which is followed by the
+// parameters for encoding positions into indices and by the values,
+// which are compressed with Huffman codes and recursive pairing. The
+// files are read into memory when they are needed first.
+type tablebases struct {
+    tables map[string]*tbTable // by file name, e.g. "KQvK.rtbw"
+    pieces int                 // maximum number of pieces of all tables
+}
+
+// tablebases used by ProbeWDL, ProbeDTZ and the search, or nil
+var syzygy *tablebases
+
+// SetSyzygyPath loads the Syzygy tablebases of all directories in path,
+// which are separated like in the PATH environment variable. An empty path
+// disables the tablebases.
+func SetSyzygyPath(path string) error {
+    if path == "" {
+        syzygy = nil
+        return nil
+    }
+    tb := &tablebases{tables: make(map[string]*tbTable)}
+    for _, dir := range filepath.SplitList(path) {
+        files, err := ioutil.ReadDir(dir)
+        if err != nil {
+            return err
+        }
+        for _, fi := range files {
+            name := fi.Name()
+            ext := filepath.Ext(name)
+            if (ext != ".rtbw" && ext != ".rtbz") || tb.tables[name] != nil {
+                continue
+            }
+            t := newTable(strings.TrimSuffix(name, ext))
+            if t == nil {
+                continue
+            }
+            t.path, t.dtz = filepath.Join(dir, name), ext == ".rtbz"
+            tb.tables[name] = t
+            if t.pieces > tb.pieces {
+                tb.pieces = t.pieces
+            }
+        }
+    }
+    if len(tb.tables) == 0 {
+        return fmt.Errorf("chess: no syzygy tablebases found in %q", path)
+    }
+    syzygy = tb
+    return nil
+}
+
+// ProbeWDL looks up the current position of b in the tablebases loaded
+// with SetSyzygyPath. The fifty-move counter is ignored, i.e. the result
+// is only exact if it's zero.
+func ProbeWDL(b *Board) (WDL, error) {
+    return syzygy.probeWDL(&b.Position)
+}
+
+// ProbeDTZ looks up the number of half-moves to the next capture or pawn
+// move with optimal play, which is positive if the player to move wins
+// and negative if the player loses. Cursed wins and blessed losses count
+// 100 half-moves more and draws return 0. A win is only certain, if the
+// DTZ plus the fifty-move counter doesn't exceed 100.
+func ProbeDTZ(b *Board) (int, error) {
+    return syzygy.probeDTZ(&b.Position)
+}
+
+// contains checks if the tablebases might contain p.
+func (tb *tablebases) contains(p *Position) bool {
+    if tb == nil || p.castling() != 0 {
+        return false
+    }
+    n := 0
+    for occ := p.occupied; occ != 0; occ &= occ - 1 {
+        n++
+    }
+    return n <= tb.pieces
+}
+
+// table returns the WDL or DTZ table for the material of p. If the table
+// stores the position with swapped colors, flip is set.
+func (tb *tablebases) table(p *Position, dtz bool) (t *tbTable, flip bool,
+    err error) {
+    white, black := p.signature(White), p.signature(Black)
+    ext := ".rtbw"
+    if dtz {
+        ext = ".rtbz"
+    }
+    if t = tb.tables[white+"v"+black+ext]; t != nil {
+        flip = t.symmetric && p.color == Black
+    } else if t = tb.tables[black+"v"+white+ext]; t != nil {
+        flip = true
+    } else {
+        return nil, false, ErrNotInTablebases
+    }
+    t.once.Do(func() { t.err = t.load() })
+    return t, flip, t.err
+}
+
+// signature describes the pieces of the given color in the format of the
+// table names, e.g. "KRP".
+func (p *Position) signature(color uint8) string {
+    var count [7]int
+    for sq := Square(0); sq < 64; sq++ {
+        if p.board[sq]&ColorMask == color {
+            count[p.board[sq]&PieceMask]++
+        }
+    }
+    buf := make([]byte, 0, 8)
+    for _, piece := range []uint8{K, Q, R, B, N, P} {
+        for i := 0; i < count[piece]; i++ {
+            buf = append(buf, " PNBRQK"[piece])
+        }
+    }
+    return string(buf)
+}
+
+// probeTable looks up the value of p in the WDL or DTZ table. DTZ values
+// depend on the result wdl of the position. If the DTZ table only stores
+// the other side to move, changed is set.
+func (tb *tablebases) probeTable(p *Position, dtz bool, wdl WDL) (v int,
+    changed bool, err error) {
+    if occ := p.occupied & (p.occupied - 1); occ&(occ-1) == 0 {
+        // bare kings aren't stored anywhere
+        return int(WDLDraw), false, nil
+    }
+    t, flip, err := tb.table(p, dtz)
+    if err != nil {
+        return 0, false, err
+    }
+    v, changed = t.probe(p, flip, wdl)
+    return v, changed, nil
+}
+
+// probeWDL returns the result of p, resolving all captures first.
+func (tb *tablebases) probeWDL(p *Position) (WDL, error) {
+    if !tb.contains(p) {
+        return WDLDraw, ErrNotInTablebases
+    }
+    v, _, err := tb.search(p, false)
+    return v, err
+}
+
+// search resolves the captures of p, or all zeroing moves including pawn
+// moves if zeroing is set. best reports if one of these moves is the best
+// move, since the stored value can't be used then.
+func (tb *tablebases) search(p *Position, zeroing bool) (v WDL, best bool,
+    err error) {
+    moves := p.LegalMoves()
+    max, n := WDLLoss, 0
+    for _, m := range moves {
+        pawn := p.board[m.Src]&PieceMask == P
+        if p.board[m.Dst] == 0 && !(pawn && (zeroing || m.Src&7 != m.Dst&7)) {
+            continue
+        }
+        n++
+        q := *p
+        q.move(m.Src, m.Dst)
+        v, _, err := tb.search(&q, false)
+        if err != nil {
+            return WDLDraw, false, err
+        }
+        if -v > max {
+            max = -v
+            if max == WDLWin {
+                return max, true, nil
+            }
+        }
+    }
+
+    // the table isn't needed if all moves have been searched
+    all := n > 0 && n == len(moves)
+    if all {
+        v = max
+    } else {
+        i, _, err := tb.probeTable(p, false, WDLDraw)
+        if err != nil {
+            return WDLDraw, false, err
+        }
+        v = WDL(i)
+    }
+    if max >= v {
+        return max, max > WDLDraw || all, nil
+    }
+    return v, false, nil
+}
+
+// probeDTZ returns the distance to zeroing of p as described at ProbeDTZ.
+func (tb *tablebases) probeDTZ(p *Position) (int, error) {
+    if !tb.contains(p) {
+        return 0, ErrNotInTablebases
+    }
+    wdl, best, err := tb.search(p, true)
+    if err != nil || wdl == WDLDraw {
+        return 0, err
+    }
+    if best {
+        return dtzBeforeZeroing(wdl), nil
+    }
+    dtz, changed, err := tb.probeTable(p, true, wdl)
+    if err != nil {
+        return 0, err
+    }
+    if !changed {
+        if wdl == WDLCursedWin || wdl == WDLBlessedLoss {
+            dtz += 100
+        }
+        if wdl < WDLDraw {
+            dtz = -dtz
+        }
+        return dtz, nil
+    }
+
+    // the table stores the other side to move, so the best move is
+    // searched one ply deep
+    min := 0xffff
+    for _, m := range p.LegalMoves() {
+        pawn := p.board[m.Src]&PieceMask == P
+        zero := pawn || p.board[m.Dst] != 0
+        q := *p
+        q.move(m.Src, m.Dst)
+        d := 0
+        if zero {
+            v, _, err := tb.search(&q, false)
+            if err != nil {
+                return 0, err
+            }
+            d = -dtzBeforeZeroing(v)
+        } else {
+            if d, err = tb.probeDTZ(&q); err != nil {
+                return 0, err
+            }
+            d = -d
+            if d > 0 {
+                d++
+            } else if d < 0 {
+                d--
+            }
+        }
+        if d == 2 && q.isCheck() && q.isStalemate() {
+            d = 1 // checkmate
+        }
+        if d != 0 && (d > 0) == (wdl > WDLDraw) && d < min {
+            min = d
+        }
+    }
+    if min == 0xffff {
+        return -1, nil // checkmate
+    }
+    return min, nil
+}
+
+// dtzBeforeZeroing returns the DTZ of a position with the given result,
+// whose best move zeroes the fifty-move counter.
+func dtzBeforeZeroing(wdl WDL) int {
+    switch wdl {
+    case WDLWin:
+        return 1
+    case WDLCursedWin:
+        return 101
+    case WDLBlessedLoss:
+        return -101
+    case WDLLoss:
+        return -1
+    }
+    return 0
+}
+
+// Magic numbers of the table files.
+const (
+    tbMagicWDL = 0x5d23e871
+    tbMagicDTZ = 0xa50c66d7
+)
+
+// maximum number of pieces of a table
+const tbMaxPieces = 7
+
+// Flags of the parts of a table.
+const (
+    tbSTM         = 1   // side to move of DTZ tables
+    tbMapped      = 2   // DTZ values are mapped
+    tbWinPlies    = 4   // DTZ values of wins are given in plies
+    tbLossPlies   = 8   // DTZ values of losses are given in plies
+    tbWide        = 16  // the DTZ map uses 16 bit values
+    tbSingleValue = 128 // all positions have the same value
+)
+
+// A tbTable is a single WDL or DTZ file. Its data is loaded on first use.
+type tbTable struct {
+    path string
+    dtz  bool
+
+    once sync.Once
+    err  error
+    data []byte
+
+    pieces    int    // total number of pieces
+    pawns     [2]int // pawns of the leading color and of the other color
+    unique    bool   // pawnless and at least one piece besides the kings is unique
+    symmetric bool   // both sides have the same material
+
+    // parts of the table by the file of the leading pawn (a to d) and by
+    // the side to move. DTZ tables and symmetric tables only have one side.
+    parts  [4][2]*tbPairs
+    dtzMap int // offset of the DTZ value maps
+}
+
+// newTable creates a table for the material given by name, e.g. "KRPvKR".
+// It returns nil if the name is invalid.
+func newTable(name string) *tbTable {
+    sides := strings.Split(name, "v")
+    if len(sides) != 2 {
+        return nil
+    }
+    t := &tbTable{symmetric: sides[0] == sides[1]}
+    var count [2][7]int
+    for c, side := range sides {
+        for _, r := range side {
+            piece := strings.IndexRune(" PNBRQK", r)
+            if piece <= 0 {
+                return nil
+            }
+            count[c][piece]++
+            t.pieces++
+        }
+        if count[c][K] != 1 || side[0] != 'K' {
+            return nil
+        }
+    }
+    if t.pieces > tbMaxPieces {
+        return nil
+    }
+    for c := range count {
+        for piece := P; piece < K; piece++ {
+            if count[c][piece] == 1 {
+                t.unique = true
+            }
+        }
+    }
+
+    // the leading pawns are the ones of the side with less pawns
+    white, black := count[0][P], count[1][P]
+    if black == 0 || (white > 0 && black >= white) {
+        t.pawns = [2]int{white, black}
+    } else {
+        t.pawns = [2]int{black, white}
+    }
+    if t.pawns[0] > 0 {
+        t.unique = false
+    }
+    return t
+}
+
+// load reads the file and the parameters of all parts of the table.
+func (t *tbTable) load() (err error) {
+    data, err := ioutil.ReadFile(t.path)
+    if err != nil {
+        return err
+    }
+    magic := uint32(tbMagicWDL)
+    if t.dtz {
+        magic = tbMagicDTZ
+    }
+    if len(data) < 8 || len(data)%64 != 16 ||
+        binary.LittleEndian.Uint32(data) != magic ||
+        (data[4]&2 != 0) != (t.pawns[0] > 0) {
+        return ErrInvalidTablebase
+    }
+    defer func() {
+        // offsets of a corrupted file may point anywhere
+        if recover() != nil {
+            err = ErrInvalidTablebase
+        }
+    }()
+    t.data = data
+
+    sides, files := 2, 1
+    if t.dtz || t.symmetric {
+        sides = 1
+    }
+    if t.pawns[0] > 0 {
+        files = 4
+    }
+    bothPawns := t.pawns[1] > 0
+    pos := 5
+    for f := 0; f < files; f++ {
+        // the order in which the groups are encoded
+        order := [2][2]int{{int(data[pos] & 15), 15}, {int(data[pos] >> 4), 15}}
+        pos++
+        if bothPawns {
+            order[0][1], order[1][1] = int(data[pos]&15), int(data[pos]>>4)
+            pos++
+        }
+        for i := 0; i < sides; i++ {
+            t.parts[f][i] = &tbPairs{}
+        }
+        for k := 0; k < t.pieces; k++ {
+            t.parts[f][0].pieces[k] = data[pos] & 15
+            if sides > 1 {
+                t.parts[f][1].pieces[k] = data[pos] >> 4
+            }
+            pos++
+        }
+        for i := 0; i < sides; i++ {
+            t.setGroups(t.parts[f][i], order[i], f)
+        }
+    }
+
+    pos += pos & 1
+    for f := 0; f < files; f++ {
+        for i := 0; i < sides; i++ {
+            pos = t.parts[f][i].setSizes(data, pos)
+        }
+    }
+    if t.dtz {
+        pos = t.setMaps(pos, files)
+    }
+    for f := 0; f < files; f++ {
+        for i := 0; i < sides; i++ {
+            d := t.parts[f][i]
+            d.sparse = data[pos : pos+6*d.sparseSize]
+            pos += 6 * d.sparseSize
+        }
+    }
+    for f := 0; f < files; f++ {
+        for i := 0; i < sides; i++ {
+            d := t.parts[f][i]
+            d.blockLen = data[pos : pos+2*d.blockLenSize]
+            pos += 2 * d.blockLenSize
+        }
+    }
+    for f := 0; f < files; f++ {
+        for i := 0; i < sides; i++ {
+            d := t.parts[f][i]
+            // the decoder might read a few bytes beyond the last block
+            pos = (pos + 63) &^ 63
+            d.blocks = data[pos:]
+            pos += d.numBlocks * d.blockSize
+        }
+    }
+    return nil
+}
+
+// setGroups splits the pieces of a part into groups of equal pieces. The
+// first group are the leading pawns, or the kings and possibly another
+// unique piece of pawnless tables. The index of a position combines the
+// indices of all groups like the digits of a number, but the order of the
+// groups is a parameter of the part.
+func (t *tbTable) setGroups(d *tbPairs, order [2]int, f int) {
+    n, first := 0, 0
+    if t.pawns[0] == 0 {
+        first = 2
+        if t.unique {
+            first = 3
+        }
+    }
+    d.groupLen[0] = 1
+    for i := 1; i < t.pieces; i++ {
+        if first--; first > 0 || d.pieces[i] == d.pieces[i-1] {
+            d.groupLen[n]++
+        } else {
+            n++
+            d.groupLen[n] = 1
+        }
+    }
+    n++
+    d.groupLen[n] = 0
+
+    next, free := 1, 64-d.groupLen[0]
+    if t.pawns[1] > 0 {
+        next, free = 2, free-d.groupLen[1]
+    }
+    idx := uint64(1)
+    for k := 0; next < n || k == order[0] || k == order[1]; k++ {
+        switch {
+        case k == order[0]:
+            d.groupIdx[0] = idx
+            switch {
+            case t.pawns[0] > 0:
+                idx *= uint64(leadPawnsSize[d.groupLen[0]][f])
+            case t.unique:
+                idx *= 31332
+            default:
+                idx *= 462
+            }
+        case k == order[1]:
+            // the remaining pawns can't be on the first and last rank
+            d.groupIdx[1] = idx
+            idx *= binomial[d.groupLen[1]][48-d.groupLen[0]]
+        default:
+            d.groupIdx[next] = idx
+            idx *= binomial[d.groupLen[next]][free]
+            free -= d.groupLen[next]
+            next++
+        }
+    }
+    d.groupIdx[n] = idx
+}
+
+// setMaps reads the tables which map the values of DTZ tables.
+func (t *tbTable) setMaps(pos, files int) int {
+    t.dtzMap = pos
+    for f := 0; f < files; f++ {
+        d := t.parts[f][0]
+        if d.flags&tbMapped == 0 {
+            continue
+        }
+        for i := range d.mapIdx {
+            if d.flags&tbWide != 0 {
+                pos += pos & 1
+                d.mapIdx[i] = (pos-t.dtzMap)/2 + 1
+                pos += 2*int(binary.LittleEndian.Uint16(t.data[pos:])) + 2
+            } else {
+                d.mapIdx[i] = pos - t.dtzMap + 1
+                pos += int(t.data[pos]) + 1
+            }
+        }
+    }
+    return pos + pos&1
+}
+
+// probe looks up the value of p. If flip is set, the colors are swapped
+// and the board is mirrored vertically. DTZ tables map the value using the
+// result wdl of the position and report if they store the other side only.
+func (t *tbTable) probe(p *Position, flip bool, wdl WDL) (v int, changed bool) {
+    d, idx := t.index(p, flip)
+    if d == nil {
+        return 0, true
+    }
+    v = d.decompress(idx)
+    if !t.dtz {
+        return v - 2, false
+    }
+    return t.mapDTZ(d, v, wdl), false
+}
+
+// index returns the part of the table which contains p and the index of p
+// within it, or no part if the DTZ table only stores the other side to
+// move. flip is the same as for probe.
+func (t *tbTable) index(p *Position, flip bool) (d *tbPairs, idx uint64) {
+    var sqs [tbMaxPieces]int
+    var pieces [tbMaxPieces]uint8
+    flipColor, flipSq, stm := uint8(0), 0, 0
+    if p.color == Black {
+        stm = 1
+    }
+    if flip {
+        flipColor, flipSq, stm = 8, 56, stm^1
+    }
+
+    // tables with pawns are split by the file of the leading pawn, which
+    // is the one nearest to the edge and with the lowest rank
+    n, lead, f := 0, 0, 0
+    leadPawn := uint8(0)
+    if t.pawns[0] > 0 {
+        leadPawn = P | White
+        if (t.parts[0][0].pieces[0]^flipColor)&8 != 0 {
+            leadPawn = P | Black
+        }
+        for sq := 0; sq < 64; sq++ {
+            if p.board[sq] == leadPawn {
+                sqs[n] = sq ^ flipSq
+                n++
+            }
+        }
+        lead = n
+        for i := 1; i < lead; i++ {
+            if mapPawns[sqs[i]] > mapPawns[sqs[0]] {
+                sqs[0], sqs[i] = sqs[i], sqs[0]
+            }
+        }
+        if f = sqs[0] & 7; f > 3 {
+            f = 7 - f
+        }
+    }
+
+    d = t.parts[f][stm]
+    if t.dtz {
+        d = t.parts[f][0]
+        if int(d.flags&tbSTM) != stm && (!t.symmetric || t.pawns[0] > 0) {
+            return nil, 0
+        }
+    }
+
+    for sq := 0; sq < 64; sq++ {
+        if piece := p.board[sq]; piece != 0 && piece != leadPawn {
+            sqs[n] = sq ^ flipSq
+            pieces[n] = piece&PieceMask | (piece>>1)&8 ^ flipColor
+            n++
+        }
+    }
+
+    // sort the pieces in the order of the part
+    for i := lead; i < n-1; i++ {
+        for j := i + 1; j < n; j++ {
+            if d.pieces[i] == pieces[j] {
+                pieces[i], pieces[j] = pieces[j], pieces[i]
+                sqs[i], sqs[j] = sqs[j], sqs[i]
+                break
+            }
+        }
+    }
+
+    // mirror the board, so that the first piece is on the files a to d
+    if sqs[0]&7 > 3 {
+        for i := 0; i < n; i++ {
+            sqs[i] ^= 7
+        }
+    }
+
+    if t.pawns[0] > 0 {
+        // the other leading pawns by ascending mapPawns values
+        for i := 2; i < lead; i++ {
+            for j := i; j > 1 && mapPawns[sqs[j]] < mapPawns[sqs[j-1]]; j-- {
+                sqs[j], sqs[j-1] = sqs[j-1], sqs[j]
+            }
+        }
+        idx = uint64(leadPawnIdx[lead][sqs[0]])
+        for i := 1; i < lead; i++ {
+            idx += binomial[i][mapPawns[sqs[i]]]
+        }
+    } else {
+        idx = t.leadingPieces(&sqs, n, d.groupLen[0])
+    }
+    idx *= d.groupIdx[0]
+
+    // the remaining groups, each sorted by square. Squares of earlier
+    // groups are skipped.
+    start, pawns := d.groupLen[0], t.pawns[1] > 0
+    for g := 1; d.groupLen[g] != 0; g++ {
+        group := sqs[start : start+d.groupLen[g]]
+        sort.Ints(group)
+        var m uint64
+        for i, sq := range group {
+            s := sq
+            for _, prev := range sqs[:start] {
+                if sq > prev {
+                    s--
+                }
+            }
+            if pawns {
+                s -= 8
+            }
+            m += binomial[i+1][s]
+        }
+        pawns = false
+        idx += m * d.groupIdx[g]
+        start += d.groupLen[g]
+    }
+    return d, idx
+}
+
+// leadingPieces mirrors the board of a pawnless table, so that the first
+// piece is in the triangle a1-d1-d4 and the first piece not on the a1-h8
+// diagonal is below it. It returns the index of the leading group, which
+// contains either both kings or three unique pieces.
+func (t *tbTable) leadingPieces(sqs *[tbMaxPieces]int, n, size int) uint64 {
+    if sqs[0]>>3 > 3 {
+        for i := 0; i < n; i++ {
+            sqs[i] ^= 56
+        }
+    }
+    for i := 0; i < size; i++ {
+        if o := offDiagonal(sqs[i]); o > 0 {
+            for j := i; j < n; j++ {
+                sqs[j] = (sqs[j]>>3 | sqs[j]<<3) & 63
+            }
+            break
+        } else if o < 0 {
+            break
+        }
+    }
+    if !t.unique {
+        return uint64(mapKK[mapA1D1D4[sqs[0]]][sqs[1]])
+    }
+
+    s0, s1, s2 := sqs[0], sqs[1], sqs[2]
+    adjust1, adjust2 := 0, 0
+    if s1 > s0 {
+        adjust1++
+    }
+    if s2 > s0 {
+        adjust2++
+    }
+    if s2 > s1 {
+        adjust2++
+    }
+    switch {
+    case offDiagonal(s0) != 0:
+        return uint64((mapA1D1D4[s0]*63+s1-adjust1)*62 + s2 - adjust2)
+    case offDiagonal(s1) != 0:
+        return uint64((6*63+(s0>>3)*28+mapB1H1H7[s1])*62 + s2 - adjust2)
+    case offDiagonal(s2) != 0:
+        return uint64(6*63*62 + 4*28*62 + (s0>>3)*7*28 +
+            ((s1>>3)-adjust1)*28 + mapB1H1H7[s2])
+    }
+    return uint64(6*63*62 + 4*28*62 + 4*7*28 + (s0>>3)*7*6 +
+        ((s1>>3)-adjust1)*6 + (s2 >> 3) - adjust2)
+}
+
+// mapDTZ converts the stored value v of a DTZ table into half-moves.
+func (t *tbTable) mapDTZ(d *tbPairs, v int, wdl WDL) int {
+    if d.flags&tbMapped != 0 {
+        i := d.mapIdx[[5]int{1, 3, 0, 2, 0}[wdl+2]] + v
+        if d.flags&tbWide != 0 {
+            v = int(binary.LittleEndian.Uint16(t.data[t.dtzMap+2*i:]))
+        } else {
+            v = int(t.data[t.dtzMap+i])
+        }
+    }
+    if (wdl == WDLWin && d.flags&tbWinPlies == 0) ||
+        (wdl == WDLLoss && d.flags&tbLossPlies == 0) ||
+        wdl == WDLCursedWin || wdl == WDLBlessedLoss {
+        v *= 2
+    }
+    return v + 1
+}
+
+// tbPairs is a part of a table. It describes the encoding of positions and
+// contains the compressed values. The values are stored in blocks of
+// Huffman coded symbols, and each symbol expands recursively into a pair
+// of other symbols or a single value.
+type tbPairs struct {
+    pieces   [tbMaxPieces]uint8      // order of the pieces
+    groupLen [tbMaxPieces + 1]int    // sizes of the groups, zero terminated
+    groupIdx [tbMaxPieces + 1]uint64 // factors of the groups in the index
+
+    flags        uint8
+    blockSize    int
+    span         uint64 // number of values per sparse index entry
+    sparseSize   int
+    blockLenSize int
+    numBlocks    int
+    sparse       []byte // first block and offset of every span, 6 bytes each
+    blockLen     []byte // number of values per block minus one, 2 bytes each
+    blocks       []byte
+
+    minSymLen int      // or the single value
+    lowestSym []byte   // lowest symbol of each code length, 2 bytes each
+    base      []uint64 // lowest code of each length, left-aligned
+    symLen    []int    // number of values of each symbol minus one
+    tree      []byte   // children of each symbol, 3 bytes each
+    mapIdx    [4]int   // DTZ maps of the results
+}
+
+// setSizes reads the parameters of the compression, which start at pos,
+// and returns the position after them.
+func (d *tbPairs) setSizes(data []byte, pos int) int {
+    d.flags = data[pos]
+    if d.flags&tbSingleValue != 0 {
+        d.minSymLen = int(data[pos+1])
+        return pos + 2
+    }
+    d.blockSize = 1 << data[pos+1]
+    d.span = 1 << data[pos+2]
+    d.sparseSize = int((d.size() + d.span - 1) / d.span)
+    d.numBlocks = int(binary.LittleEndian.Uint32(data[pos+4:]))
+    d.blockLenSize = d.numBlocks + int(data[pos+3])
+    maxSymLen, minSymLen := int(data[pos+8]), int(data[pos+9])
+    pos += 10
+
+    // canonical Huffman codes: longer codes have lower values
+    lens := maxSymLen - minSymLen + 1
+    d.minSymLen, d.lowestSym = minSymLen, data[pos:pos+2*lens]
+    d.base = make([]uint64, lens)
+    for i := lens - 2; i >= 0; i-- {
+        d.base[i] = (d.base[i+1] + uint64(d.lowest(i)) -
+            uint64(d.lowest(i+1))) / 2
+    }
+    for i := range d.base {
+        d.base[i] <<= uint(64 - i - minSymLen)
+    }
+    pos += 2 * lens
+
+    syms := int(binary.LittleEndian.Uint16(data[pos:]))
+    pos += 2
+    d.tree = data[pos : pos+3*syms]
+    d.symLen = make([]int, syms)
+    visited := make([]bool, syms)
+    for s := range d.symLen {
+        if !visited[s] {
+            d.symLen[s] = d.setSymLen(s, visited)
+        }
+    }
+    return pos + 3*syms + syms&1
+}
+
+// size returns the number of indices of the part.
+func (d *tbPairs) size() uint64 {
+    n := 0
+    for d.groupLen[n] != 0 {
+        n++
+    }
+    return d.groupIdx[n]
+}
+
+// setSymLen computes the number of values of the symbol s minus one.
+func (d *tbPairs) setSymLen(s int, visited []bool) int {
+    visited[s] = true
+    left, right := d.children(s)
+    if right == 0xfff {
+        return 0
+    }
+    if !visited[left] {
+        d.symLen[left] = d.setSymLen(left, visited)
+    }
+    if !visited[right] {
+        d.symLen[right] = d.setSymLen(right, visited)
+    }
+    return d.symLen[left] + d.symLen[right] + 1
+}
+
+// children returns the pair of symbols the symbol s expands to. Symbols
+// which stand for a single value store it as left child.
+func (d *tbPairs) children(s int) (left, right int) {
+    n := d.tree[3*s:]
+    return int(n[1]&15)<<8 | int(n[0]), int(n[2])<<4 | int(n[1]>>4)
+}
+
+func (d *tbPairs) lowest(i int) int {
+    return int(binary.LittleEndian.Uint16(d.lowestSym[2*i:]))
+}
+
+func (d *tbPairs) blockLength(i int) int {
+    return int(binary.LittleEndian.Uint16(d.blockLen[2*i:]))
+}
+
+// decompress returns the value with the given index.
+func (d *tbPairs) decompress(idx uint64) int {
+    if d.flags&tbSingleValue != 0 {
+        return d.minSymLen
+    }
+
+    // the sparse index points to the value in the middle of each span,
+    // the blocks are walked from there
+    e := d.sparse[6*(idx/d.span):]
+    block := int(binary.LittleEndian.Uint32(e))
+    offset := int(binary.LittleEndian.Uint16(e[4:])) +
+        int(idx%d.span) - int(d.span/2)
+    for offset < 0 {
+        block--
+        offset += d.blockLength(block) + 1
+    }
+    for offset > d.blockLength(block) {
+        offset -= d.blockLength(block) + 1
+        block++
+    }
+
+    // read the symbols of the block until the one containing the value
+    data := d.blocks[block*d.blockSize:]
+    buf, next, bits := binary.BigEndian.Uint64(data), 8, 64
+    sym := 0
+    for {
+        l := 0
+        for buf < d.base[l] {
+            l++
+        }
+        sym = int((buf-d.base[l])>>uint(64-l-d.minSymLen)) + d.lowest(l)
+        if offset < d.symLen[sym]+1 {
+            break
+        }
+        offset -= d.symLen[sym] + 1
+        l += d.minSymLen
+        buf <<= uint(l)
+        if bits -= l; bits <= 32 {
+            bits += 32
+            buf |= uint64(binary.BigEndian.Uint32(data[next:])) << uint(64-bits)
+            next += 4
+        }
+    }
+
+    // expand the pairs until a single value remains
+    for d.symLen[sym] != 0 {
+        left, right := d.children(sym)
+        if offset < d.symLen[left]+1 {
+            sym = left
+        } else {
+            offset -= d.symLen[left] + 1
+            sym = right
+        }
+    }
+    left, _ := d.children(sym)
+    return left
+}
+
+// offDiagonal returns a positive number for squares above the a1-h8
+// diagonal, a negative one for squares below it and 0 on the diagonal.
+func offDiagonal(sq int) int {
+    return sq>>3 - sq&7
+}
+
+// Tables for the encoding of positions.
+var (
+    mapB1H1H7     [64]int     // squares below the a1-h8 diagonal to 0..27
+    mapA1D1D4     [64]int     // the triangle a1-d1-d4 to 0..9, diagonal last
+    mapKK         [10][64]int // legal placements of both kings to 0..461
+    mapPawns      [64]int     // squares of pawns to 0..47, leading pawn highest
+    leadPawnIdx   [6][64]int  // first index of leading pawns by count and square
+    leadPawnsSize [6][4]int   // number of indices by count and file
+    binomial      [tbMaxPieces][64]uint64
+)
+
+func init() {
+    code := 0
+    for sq := 0; sq < 64; sq++ {
+        if offDiagonal(sq) < 0 {
+            mapB1H1H7[sq] = code
+            code++
+        }
+    }
+
+    code = 0
+    var diagonal []int
+    for sq := 0; sq < 64; sq++ {
+        mapA1D1D4[sq] = -1
+    }
+    for sq := 0; sq <= 27; sq++ {
+        if offDiagonal(sq) < 0 && sq&7 <= 3 {
+            mapA1D1D4[sq] = code
+            code++
+        } else if offDiagonal(sq) == 0 && sq&7 <= 3 {
+            diagonal = append(diagonal, sq)
+        }
+    }
+    for _, sq := range diagonal {
+        mapA1D1D4[sq] = code
+        code++
+    }
+
+    // if the first king is on the diagonal, the second one must not be
+    // above it. Placements with both kings on the diagonal come last.
+    code = 0
+    var both [][2]int
+    for i := 0; i < 10; i++ {
+        for s1 := 0; s1 <= 27; s1++ {
+            if mapA1D1D4[s1] != i {
+                continue
+            }
+            for s2 := 0; s2 < 64; s2++ {
+                dr, df := s1>>3-s2>>3, s1&7-s2&7
+                switch {
+                case dr >= -1 && dr <= 1 && df >= -1 && df <= 1:
+                    // the kings would touch each other
+                case offDiagonal(s1) == 0 && offDiagonal(s2) > 0:
+                case offDiagonal(s1) == 0 && offDiagonal(s2) == 0:
+                    both = append(both, [2]int{i, s2})
+                default:
+                    mapKK[i][s2] = code
+                    code++
+                }
+            }
+        }
+    }
+    for _, b := range both {
+        mapKK[b[0]][b[1]] = code
+        code++
+    }
+
+    binomial[0][0] = 1
+    for n := 1; n < 64; n++ {
+        for k := 0; k < tbMaxPieces && k <= n; k++ {
+            if k > 0 {
+                binomial[k][n] += binomial[k-1][n-1]
+            }
+            if k < n {
+                binomial[k][n] += binomial[k][n-1]
+            }
+        }
+    }
+
+    // the more squares are available for the other pawns, the higher is
+    // the value of the leading pawn
+    available := 47
+    for lead := 1; lead < 6; lead++ {
+        for f := 0; f < 4; f++ {
+            idx := 0
+            for r := 1; r <= 6; r++ {
+                sq := r<<3 + f
+                if lead == 1 {
+                    mapPawns[sq] = available
+                    mapPawns[sq^7] = available - 1
+                    available -= 2
+                }
+                leadPawnIdx[lead][sq] = idx
+                idx += int(binomial[lead-1][mapPawns[sq]])
+            }
+            leadPawnsSize[lead][f] = idx
+        }
+    }
+}
@@ -0,0 +1,294 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "context"
+    "flag"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// The probing tests use the tablebases in testdata/syzygy, see the README
+// there, or any other directory, e.g.:
+//
+//	go test -run Syzygy -syzygy=/usr/share/syzygy
+var syzygyDir = flag.String("syzygy", "testdata/syzygy",
+    "directory containing Syzygy tablebases used by the tests")
+
+func TestSyzygyEncoding(t *testing.T) {
+    seen := make(map[int]bool)
+    for i := range mapKK {
+        for _, code := range mapKK[i] {
+            if code != 0 {
+                seen[code] = true
+            }
+        }
+    }
+    // code 0 is the first legal placement: king on b1, other king on d1
+    if mapKK[0][3] != 0 || len(seen) != 461 {
+        t.Errorf("expected 462 king placements, got %d", len(seen)+1)
+    }
+    if mapA1D1D4[Sq("b1")] != 0 || mapA1D1D4[Sq("d3")] != 5 ||
+        mapA1D1D4[Sq("a1")] != 6 || mapA1D1D4[Sq("d4")] != 9 {
+        t.Errorf("unexpected triangle codes %v", mapA1D1D4[:32])
+    }
+    pawns := make(map[int]bool)
+    for sq := 8; sq < 56; sq++ {
+        pawns[mapPawns[sq]] = true
+    }
+    if len(pawns) != 48 || mapPawns[Sq("a2")] != 47 || mapPawns[Sq("h2")] != 46 {
+        t.Errorf("mapPawns isn't a permutation of 0..47")
+    }
+    for f := 0; f < 4; f++ {
+        if leadPawnsSize[1][f] != 6 {
+            t.Errorf("leadPawnsSize[1][%d] = %d, want 6", f, leadPawnsSize[1][f])
+        }
+    }
+    if binomial[3][10] != 120 || binomial[0][63] != 1 {
+        t.Errorf("unexpected binomial coefficients")
+    }
+
+    // the leading group contains the kings and a unique piece, if any
+    tests := []struct {
+        name   string
+        pieces []uint8
+        groups []int
+        size   uint64
+    }{
+        {"KRvK", []uint8{6, 14, 4}, []int{3}, 31332},
+        {"KQQvK", []uint8{6, 14, 5, 5}, []int{2, 2}, 462 * 1891},
+        {"KRvKR", []uint8{6, 14, 4, 12}, []int{3, 1}, 31332 * 61},
+        {"KPvK", []uint8{1, 6, 14}, []int{1, 1, 1}, 6 * 63 * 62},
+    }
+    for _, test := range tests {
+        d := &tbPairs{}
+        copy(d.pieces[:], test.pieces)
+        newTable(test.name).setGroups(d, [2]int{0, 15}, 0)
+        for i, n := range append(test.groups, 0) {
+            if d.groupLen[i] != n {
+                t.Errorf("%s: groups %v, want %v", test.name, d.groupLen,
+                    test.groups)
+                break
+            }
+        }
+        if d.size() != test.size {
+            t.Errorf("%s: %d indices, want %d", test.name, d.size(), test.size)
+        }
+    }
+}
+
+func TestSyzygyNames(t *testing.T) {
+    tb := newTable("KRPvKR")
+    if tb == nil || tb.pieces != 5 || tb.pawns != [2]int{1, 0} ||
+        tb.symmetric || tb.unique {
+        t.Errorf("unexpected table %+v", tb)
+    }
+    tb = newTable("KPvKPP")
+    if tb == nil || tb.pawns != [2]int{1, 2} {
+        t.Errorf("unexpected table %+v", tb)
+    }
+    tb = newTable("KNNvKN")
+    if tb == nil || !tb.unique || tb.pawns != [2]int{0, 0} {
+        t.Errorf("unexpected table %+v", tb)
+    }
+    tb = newTable("KBBvKBB")
+    if tb == nil || tb.unique || !tb.symmetric {
+        t.Errorf("unexpected table %+v", tb)
+    }
+    for _, name := range []string{"KQK", "QvK", "KKvK", "KXvK", "KQQQQQvKQ"} {
+        if newTable(name) != nil {
+            t.Errorf("newTable(%q) should fail", name)
+        }
+    }
+}
+
+func TestSyzygyInvalid(t *testing.T) {
+    defer SetSyzygyPath("")
+    dir, err := ioutil.TempDir("", "syzygy")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    if err := SetSyzygyPath(dir); err == nil {
+        t.Errorf("expected an error for an empty directory")
+    }
+    err = ioutil.WriteFile(filepath.Join(dir, "KQvK.rtbw"), make([]byte, 80), 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := SetSyzygyPath(dir); err != nil {
+        t.Fatal(err)
+    }
+    b, _ := ParseFEN("8/8/8/8/8/8/8/K1k4Q w - - 0 1")
+    if _, err := ProbeWDL(b); err != ErrInvalidTablebase {
+        t.Errorf("expected ErrInvalidTablebase, got %v", err)
+    }
+    b, _ = ParseFEN("8/8/8/8/8/8/8/K1k4R w - - 0 1")
+    if _, err := ProbeWDL(b); err != ErrNotInTablebases {
+        t.Errorf("expected ErrNotInTablebases, got %v", err)
+    }
+    if _, err := ProbeDTZ(NewBoard()); err != ErrNotInTablebases {
+        t.Errorf("expected ErrNotInTablebases, got %v", err)
+    }
+}
+
+// loadSyzygy loads the tablebases used by the tests or skips the test.
+func loadSyzygy(t *testing.T) {
+    if _, err := os.Stat(filepath.Join(*syzygyDir, "KRvK.rtbw")); err != nil {
+        t.Skip("tablebases not found, use -syzygy=dir")
+    }
+    if err := SetSyzygyPath(*syzygyDir); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestSyzygyProbe(t *testing.T) {
+    loadSyzygy(t)
+    defer SetSyzygyPath("")
+    tests := []struct {
+        fen string
+        wdl WDL
+        dtz int
+    }{
+        // bare kings
+        {"8/8/8/3k4/8/3K4/8/8 w - - 0 1", WDLDraw, 0},
+        // mate in one: Qh8#
+        {"k7/8/1K6/8/8/8/8/6Q1 w - - 0 1", WDLWin, 1},
+        // mated
+        {"k6Q/8/1K6/8/8/8/8/8 b - - 0 1", WDLLoss, -1},
+        // the unprotected queen is captured
+        {"8/8/8/8/8/2k5/3Q4/7K b - - 0 1", WDLDraw, 0},
+        // the king in front of its pawn on the sixth rank always wins
+        {"4k3/8/4K3/4P3/8/8/8/8 w - - 0 1", WDLWin, 0},
+        {"4k3/8/4K3/4P3/8/8/8/8 b - - 0 1", WDLLoss, 0},
+        // black to move, the same as above with colors swapped
+        {"8/8/8/8/4p3/4k3/8/4K3 b - - 0 1", WDLWin, 0},
+        // the rooks are exchanged
+        {"8/8/3k4/3r4/8/3R4/3K4/8 w - - 0 1", WDLDraw, 0},
+    }
+    for _, test := range tests {
+        b, err := ParseFEN(test.fen)
+        if err != nil {
+            t.Fatal(err)
+        }
+        wdl, err := ProbeWDL(b)
+        if err != nil || wdl != test.wdl {
+            t.Errorf("ProbeWDL(%q) = %v, %v, want %v", test.fen, wdl, err, test.wdl)
+        }
+        dtz, err := ProbeDTZ(b)
+        if err != nil || (test.dtz != 0 && dtz != test.dtz) ||
+            (dtz > 0) != (wdl > WDLDraw) || (dtz < 0) != (wdl < WDLDraw) {
+            t.Errorf("ProbeDTZ(%q) = %d, %v, want %d", test.fen, dtz, err, test.dtz)
+        }
+    }
+}
+
+func TestSyzygySearch(t *testing.T) {
+    loadSyzygy(t)
+    defer SetSyzygyPath("")
+
+    // Qb7# and Qc8# win, but most other moves are stalemate
+    b, _ := ParseFEN("k7/2Q5/K7/8/8/8/8/8 w - - 0 1")
+    m, info := SearchEngine{}.BestMove(context.Background(), b,
+        SearchLimits{Depth: 1})
+    if !info.TB || info.WDL != WDLWin || info.DTZ != 1 {
+        t.Errorf("expected a tablebase win, got %+v", info)
+    }
+    if b.Move(m.Src, m.Dst); !b.Checkmate() {
+        t.Errorf("expected checkmate, got %v", m)
+    }
+
+    // wins within the fifty-move rule are converted
+    b, _ = ParseFEN("8/8/8/4k3/8/8/8/4K2R w - - 0 1")
+    for i := 0; i < 100 && !b.Checkmate(); i++ {
+        m, _ := SearchEngine{}.BestMove(context.Background(), b,
+            SearchLimits{Depth: 3})
+        b.Move(m.Src, m.Dst)
+    }
+    if !b.Checkmate() {
+        t.Errorf("KRvK wasn't won: %v", b.Position)
+    }
+}
+
+// egFEN returns the position p of an endgame table in FEN.
+func egFEN(p *egPos) string {
+    var board [64]byte
+    for i := 0; i < p.n; i++ {
+        c := " PNBRQK"[p.pieces[i]&PieceMask]
+        if p.pieces[i]&ColorMask == Black {
+            c += 'a' - 'A'
+        }
+        board[p.sqs[i]] = c
+    }
+    fen := ""
+    for rank := 7; rank >= 0; rank-- {
+        empty := 0
+        for file := 0; file < 8; file++ {
+            if c := board[rank*8+file]; c == 0 {
+                empty++
+            } else {
+                if empty > 0 {
+                    fen += string('0' + byte(empty))
+                    empty = 0
+                }
+                fen += string(c)
+            }
+        }
+        if empty > 0 {
+            fen += string('0' + byte(empty))
+        }
+        if rank > 0 {
+            fen += "/"
+        }
+    }
+    if p.stm == White {
+        return fen + " w - - 0 1"
+    }
+    return fen + " b - - 0 1"
+}
+
+// TestSyzygyEndgames compares the tablebases with the endgame tables
+// generated by retrograde analysis. Both must agree on the result of every
+// position and a mate in one is a DTZ of one.
+func TestSyzygyEndgames(t *testing.T) {
+    loadSyzygy(t)
+    defer SetSyzygyPath("")
+    tables, err := GenerateEndgames("KQvK", "KRvK", "KPvK", "KBvK")
+    if err != nil {
+        t.Fatal(err)
+    }
+    var p egPos
+    for _, table := range tables {
+        checked := 0
+        for idx := 0; idx < len(table.dtm); idx += 5 {
+            if table.decode(idx, &p); !p.legal() {
+                continue
+            }
+            fen := egFEN(&p)
+            b, err := ParseFEN(fen)
+            if err != nil {
+                t.Fatalf("%s: %v", fen, err)
+            }
+            want, dtm, _ := table.Probe(b)
+            wdl, err := ProbeWDL(b)
+            if err != nil || wdl != want {
+                t.Fatalf("ProbeWDL(%q) = %v, %v, want %v", fen, wdl, err, want)
+            }
+            dtz, err := ProbeDTZ(b)
+            if err != nil || (dtz > 0) != (want == WDLWin) ||
+                (dtz < 0) != (want == WDLLoss) ||
+                (want == WDLWin && dtm == 1 && dtz != 1) {
+                t.Fatalf("ProbeDTZ(%q) = %d, %v, want %v in %d", fen, dtz, err,
+                    want, dtm)
+            }
+            checked++
+        }
+        if checked == 0 {
+            t.Errorf("no positions of %s checked", table.Material())
+        }
+    }
+}
@@ -0,0 +1,514 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "encoding/binary"
+    "fmt"
+    "io/ioutil"
+    "path/filepath"
+    "sort"
+)
+
+// GenerateSyzygy generates the Syzygy tablebases of the given materials,
+// like "KQK" or "KRvKR", and writes their WDL and DTZ files to dir, e.g.
+// KRvKR.rtbw and KRvKR.rtbz. The results and the distances to zeroing are
+// computed by retrograde analysis like GenerateEndgames, so only tables
+// with three or four pieces are supported, and materials with results
+// which depend on the fifty-move rule are rejected. The files have the
+// format of the official tablebases and are loaded by SetSyzygyPath.
+func GenerateSyzygy(dir string, materials ...string) error {
+    g := &egGenerator{tables: make(map[string]*EndgameTable)}
+    dtz := make(map[string][]int8)
+    for _, m := range materials {
+        name, err := parseMaterial(m)
+        if err != nil {
+            return err
+        }
+        t, err := g.generate(name)
+        if err != nil {
+            return err
+        }
+        if err := g.zeroing(t, dtz); err != nil {
+            return err
+        }
+        for _, ext := range []string{".rtbw", ".rtbz"} {
+            data, err := encodeSyzygy(t, dtz[name], ext == ".rtbz")
+            if err != nil {
+                return err
+            }
+            err = ioutil.WriteFile(filepath.Join(dir, name+ext), data, 0644)
+            if err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// zeroing computes the distances to zeroing of t and of all tables it
+// depends on, unless they are contained in dtz already. Wins which take
+// more than 100 half-moves until the next capture or pawn move would be
+// cursed wins, which the generated tables don't support.
+func (g *egGenerator) zeroing(t *EndgameTable, dtz map[string][]int8) error {
+    if dtz[t.name] != nil {
+        return nil
+    }
+    for _, m := range successors(t.name) {
+        if err := g.zeroing(g.tables[m], dtz); err != nil {
+            return err
+        }
+    }
+    d := make([]int8, len(t.dtm))
+    err := g.retrograde(t, d, true)
+    for _, v := range d {
+        if v > 100 || v < -101 {
+            err = ErrDistanceToMate
+        }
+    }
+    if err != nil {
+        return fmt.Errorf("chess: the fifty-move rule changes results of %s",
+            t.name)
+    }
+    dtz[t.name] = d
+    return nil
+}
+
+// Parameters of the generated tables.
+const (
+    tbBlockBits   = 8    // log2 of the block size in bytes
+    tbMaxSymbols  = 4095 // 0xfff marks single values
+    tbMaxSymLen   = 4096 // maximum number of values of a symbol
+    tbMinPairs    = 8    // minimum number of occurrences of a new pair
+    tbMaxCodeLen  = 32   // maximum length of the Huffman codes
+    tbBlockValues = 1 << 16
+)
+
+// encodeSyzygy returns the WDL or DTZ file of the table t, whose distances
+// to zeroing are dtz. The positions are encoded by tbTable.index, so the
+// pieces of each part are ordered like setGroups expects them and the
+// groups are encoded in this order too.
+func encodeSyzygy(t *EndgameTable, dtz []int8, isDTZ bool) ([]byte, error) {
+    tb := newTable(t.name)
+    tb.dtz = isDTZ
+    sides, files := 2, 1
+    if tb.dtz || tb.symmetric {
+        sides = 1
+    }
+    if tb.pawns[0] > 0 {
+        files = 4
+    }
+    pieces := syzygyPieces(tb, t.pieces)
+    order := [2]int{0, 15}
+    if tb.pawns[1] > 0 {
+        order[1] = 1
+    }
+
+    // values of positions which can't be probed are -1
+    values := make(map[*tbPairs][]int)
+    for f := 0; f < files; f++ {
+        for i := 0; i < sides; i++ {
+            d := &tbPairs{pieces: pieces}
+            if tb.dtz {
+                d.flags = tbWinPlies | tbLossPlies
+            }
+            tb.setGroups(d, order, f)
+            tb.parts[f][i] = d
+            values[d] = make([]int, d.size())
+            for j := range values[d] {
+                values[d][j] = -1
+            }
+        }
+    }
+    var p egPos
+    var pos Position
+    for idx := range t.dtm {
+        t.decode(idx, &p)
+        if p.ep || !p.legal() || (tb.symmetric && p.stm == Black) {
+            continue
+        }
+        pos.board, pos.color = [64]uint8{}, p.stm
+        for i := 0; i < p.n; i++ {
+            pos.board[p.sqs[i]] = p.pieces[i]
+        }
+        d, i := tb.index(&pos, false)
+        if d == nil {
+            continue
+        }
+        v := 2 + 2*sign(int(t.dtm[idx]))
+        if tb.dtz {
+            // the DTZ of draws isn't looked up, mates and losses by a
+            // zeroing move are stored like a DTZ of one
+            switch z := int(dtz[idx]); {
+            case z == 0:
+                continue
+            case z > 0:
+                v = z - 1
+            case z < -2:
+                v = -z - 2
+            default:
+                v = 0
+            }
+        }
+        if values[d][i] >= 0 && values[d][i] != v {
+            return nil, fmt.Errorf("chess: %s: positions with index %d differ",
+                t.name, i)
+        }
+        values[d][i] = v
+    }
+
+    magic := uint32(tbMagicWDL)
+    if tb.dtz {
+        magic = tbMagicDTZ
+    }
+    data := make([]byte, 4, 1024)
+    binary.LittleEndian.PutUint32(data, magic)
+    flags := byte(0)
+    if !tb.symmetric {
+        flags |= 1
+    }
+    if tb.pawns[0] > 0 {
+        flags |= 2
+    }
+    data = append(data, flags)
+    for f := 0; f < files; f++ {
+        data = append(data, byte(order[0]|order[0]<<4))
+        if tb.pawns[1] > 0 {
+            data = append(data, byte(order[1]|order[1]<<4))
+        }
+        for _, piece := range pieces[:tb.pieces] {
+            data = append(data, piece|piece<<4)
+        }
+    }
+    data = tbAlign(data, 2)
+
+    var parts []tbCompressed
+    for f := 0; f < files; f++ {
+        for i := 0; i < sides; i++ {
+            d := tb.parts[f][i]
+            c := compressValues(d.flags, values[d])
+            data = append(data, c.sizes...)
+            parts = append(parts, c)
+        }
+    }
+    if tb.dtz {
+        // no maps of DTZ values
+        data = tbAlign(data, 2)
+    }
+    for _, c := range parts {
+        data = append(data, c.sparse...)
+    }
+    for _, c := range parts {
+        data = append(data, c.blockLen...)
+    }
+    for _, c := range parts {
+        data = append(tbAlign(data, 64), c.blocks...)
+    }
+    // the length of Syzygy files is 16 more than a multiple of 64
+    data = tbAlign(data, 64)
+    return append(data, make([]byte, 16)...), nil
+}
+
+// syzygyPieces returns the order of the pieces in the parts of the table
+// tb: the leading pawns and the other pawns first, or both kings and the
+// unique pieces first in pawnless tables. Equal pieces are adjacent.
+func syzygyPieces(tb *tbTable, pieces []uint8) (order [tbMaxPieces]uint8) {
+    var count [32]int
+    for _, piece := range pieces {
+        count[piece]++
+    }
+    lead := uint8(P | White)
+    if count[P|Black] > 0 &&
+        (count[P|White] == 0 || count[P|Black] < count[P|White]) {
+        lead = P | Black
+    }
+    rank := func(piece uint8) int {
+        switch {
+        case tb.pawns[0] > 0 && piece == lead:
+            return 0
+        case tb.pawns[0] > 0 && piece&PieceMask == P:
+            return 1
+        case tb.pawns[0] == 0 && piece&PieceMask == K:
+            return 0
+        case tb.pawns[0] == 0 && count[piece] == 1:
+            return 1
+        }
+        return 2
+    }
+    sorted := append([]uint8(nil), pieces...)
+    sort.SliceStable(sorted, func(i, j int) bool {
+        ri, rj := rank(sorted[i]), rank(sorted[j])
+        return ri < rj || (ri == rj && sorted[i] < sorted[j])
+    })
+    for i, piece := range sorted {
+        order[i] = piece&PieceMask | (piece>>1)&8
+    }
+    return
+}
+
+// tbAlign pads data with zeros to a multiple of n bytes.
+func tbAlign(data []byte, n int) []byte {
+    for len(data)%n != 0 {
+        data = append(data, 0)
+    }
+    return data
+}
+
+// tbCompressed are the sections of a compressed part in the file format
+// read by setSizes and decompress.
+type tbCompressed struct {
+    sizes, sparse, blockLen, blocks []byte
+}
+
+// tbSymbol is a symbol of the recursive pairing, which stands for n values.
+type tbSymbol struct {
+    left, right int // the value and 0xfff for single values
+    n           int
+}
+
+// compressValues compresses the values of a part with the given flags.
+// Values of -1 are never looked up. The values are replaced by symbols,
+// which are then paired recursively: the most frequent pair of adjacent
+// symbols is replaced by a new symbol, as long as it occurs often enough.
+// Finally, the symbols are Huffman coded and split into blocks.
+func compressValues(flags uint8, values []int) (c tbCompressed) {
+    prev := 0
+    for _, v := range values {
+        if v >= 0 {
+            prev = v
+            break
+        }
+    }
+    var syms []tbSymbol
+    leaves := make(map[int]int)
+    seq := make([]int, len(values))
+    for i, v := range values {
+        if v < 0 {
+            v = prev
+        }
+        prev = v
+        s, ok := leaves[v]
+        if !ok {
+            s = len(syms)
+            leaves[v] = s
+            syms = append(syms, tbSymbol{v, 0xfff, 1})
+        }
+        seq[i] = s
+    }
+    if len(syms) == 1 {
+        c.sizes = []byte{flags | tbSingleValue, byte(syms[0].left)}
+        return
+    }
+
+    for len(syms) < tbMaxSymbols {
+        counts := make(map[[2]int]int)
+        for i := 0; i+1 < len(seq); i++ {
+            a, b := seq[i], seq[i+1]
+            if syms[a].n+syms[b].n > tbMaxSymLen {
+                continue
+            }
+            counts[[2]int{a, b}]++
+            if a == b && i+2 < len(seq) && seq[i+2] == a {
+                i++ // pairs in runs of the same symbol don't overlap
+            }
+        }
+        var best [2]int
+        n := 0
+        for pair, count := range counts {
+            if count > n || (count == n && (pair[0] < best[0] ||
+                (pair[0] == best[0] && pair[1] < best[1]))) {
+                best, n = pair, count
+            }
+        }
+        if n < tbMinPairs {
+            break
+        }
+        s := len(syms)
+        syms = append(syms, tbSymbol{best[0], best[1],
+            syms[best[0]].n + syms[best[1]].n})
+        paired := seq[:0]
+        for i := 0; i < len(seq); i++ {
+            if i+1 < len(seq) && seq[i] == best[0] && seq[i+1] == best[1] {
+                paired = append(paired, s)
+                i++
+            } else {
+                paired = append(paired, seq[i])
+            }
+        }
+        seq = paired
+    }
+
+    // the symbols are renumbered, so that longer codes belong to lower
+    // symbols. Symbols which only occur in pairs come last.
+    freq := make([]int, len(syms))
+    for _, s := range seq {
+        freq[s]++
+    }
+    lens := huffmanLengths(freq)
+    perm := make([]int, len(syms))
+    for i := range perm {
+        perm[i] = i
+    }
+    sort.SliceStable(perm, func(i, j int) bool {
+        return lens[perm[i]] > lens[perm[j]]
+    })
+    ids := make([]int, len(syms))
+    minLen, maxLen := tbMaxCodeLen, lens[perm[0]]
+    for id, s := range perm {
+        ids[s] = id
+        if lens[s] > 0 && lens[s] < minLen {
+            minLen = lens[s]
+        }
+    }
+    lowest := make([]int, maxLen-minLen+1)
+    for _, s := range perm {
+        for l := minLen; l < lens[s]; l++ {
+            lowest[l-minLen]++
+        }
+    }
+    base := make([]uint64, len(lowest))
+    for i := len(base) - 2; i >= 0; i-- {
+        base[i] = (base[i+1] + uint64(lowest[i]-lowest[i+1])) / 2
+    }
+    codes := make([]uint64, len(syms))
+    for id, s := range perm {
+        if l := lens[s]; l > 0 {
+            codes[s] = base[l-minLen] + uint64(id-lowest[l-minLen])
+        }
+    }
+
+    // blocks of whole symbols
+    blockSize := 1 << tbBlockBits
+    var blockLens []int
+    block, bits, n := make([]byte, blockSize), 0, 0
+    for i, s := range seq {
+        l := lens[s]
+        if bits+l > 8*blockSize || n+syms[s].n > tbBlockValues {
+            c.blocks = append(c.blocks, block...)
+            blockLens = append(blockLens, n)
+            block, bits, n = make([]byte, blockSize), 0, 0
+        }
+        for b := l - 1; b >= 0; b-- {
+            if codes[s]>>uint(b)&1 != 0 {
+                block[bits/8] |= 0x80 >> uint(bits%8)
+            }
+            bits++
+        }
+        if n += syms[s].n; i == len(seq)-1 {
+            c.blocks = append(c.blocks, block...)
+            blockLens = append(blockLens, n)
+        }
+    }
+
+    // the sparse index points to the middle of every span. The entries
+    // beyond the last value point into padding blocks.
+    spanBits := 1
+    for 1<<uint(spanBits+1) <= len(values)/len(blockLens) && spanBits < 15 {
+        spanBits++
+    }
+    span := 1 << uint(spanBits)
+    padding, start, b := 0, 0, 0
+    for k := 0; k < (len(values)+span-1)/span; k++ {
+        i := k*span + span/2
+        for b < len(blockLens) && i >= start+blockLens[b] {
+            start += blockLens[b]
+            b++
+        }
+        e, offset := b, i-start
+        if b == len(blockLens) {
+            e += offset / tbBlockValues
+            offset %= tbBlockValues
+            if e-b+1 > padding {
+                padding = e - b + 1
+            }
+        }
+        c.sparse = append(c.sparse, 0, 0, 0, 0, 0, 0)
+        binary.LittleEndian.PutUint32(c.sparse[len(c.sparse)-6:], uint32(e))
+        binary.LittleEndian.PutUint16(c.sparse[len(c.sparse)-2:], uint16(offset))
+    }
+    for _, n := range blockLens {
+        c.blockLen = append(c.blockLen, byte(n-1), byte((n-1)>>8))
+    }
+    for i := 0; i < padding; i++ {
+        c.blockLen = append(c.blockLen, 0xff, 0xff)
+    }
+
+    c.sizes = []byte{flags, tbBlockBits, byte(spanBits), byte(padding),
+        0, 0, 0, 0, byte(maxLen), byte(minLen)}
+    binary.LittleEndian.PutUint32(c.sizes[4:], uint32(len(blockLens)))
+    for _, l := range lowest {
+        c.sizes = append(c.sizes, byte(l), byte(l>>8))
+    }
+    c.sizes = append(c.sizes, byte(len(syms)), byte(len(syms)>>8))
+    for _, s := range perm {
+        left, right := syms[s].left, syms[s].right
+        if right != 0xfff {
+            left, right = ids[left], ids[right]
+        }
+        c.sizes = append(c.sizes, byte(left), byte(left>>8&15|right<<4),
+            byte(right>>4))
+    }
+    if len(syms)&1 != 0 {
+        c.sizes = append(c.sizes, 0)
+    }
+    return
+}
+
+// huffmanLengths returns the lengths of the Huffman codes of symbols with
+// the given frequencies, which are 0 for unused symbols. The frequencies
+// are reduced until no code is longer than tbMaxCodeLen.
+func huffmanLengths(freq []int) []int {
+    lens := make([]int, len(freq))
+    var leaves []int
+    for s, f := range freq {
+        if f > 0 {
+            leaves = append(leaves, s)
+        }
+    }
+    if len(leaves) == 1 {
+        lens[leaves[0]] = 1
+        return lens
+    }
+    for {
+        sort.SliceStable(leaves, func(i, j int) bool {
+            return freq[leaves[i]] < freq[leaves[j]]
+        })
+        // the leaves and the inner nodes are both sorted by frequency,
+        // so the two nodes with the lowest frequencies are at their fronts
+        k := len(leaves)
+        weight, parent := make([]int, k, 2*k-1), make([]int, 2*k-1)
+        for i, s := range leaves {
+            weight[i] = freq[s]
+        }
+        next, inner := 0, k
+        lowest := func() int {
+            if next < k && (inner == len(weight) || weight[next] <= weight[inner]) {
+                next++
+                return next - 1
+            }
+            inner++
+            return inner - 1
+        }
+        for len(weight) < 2*k-1 {
+            a, b := lowest(), lowest()
+            parent[a], parent[b] = len(weight), len(weight)
+            weight = append(weight, weight[a]+weight[b])
+        }
+        depth, max := make([]int, 2*k-1), 0
+        for i := 2*k - 3; i >= 0; i-- {
+            depth[i] = depth[parent[i]] + 1
+        }
+        for i, s := range leaves {
+            if lens[s] = depth[i]; depth[i] > max {
+                max = depth[i]
+            }
+        }
+        if max <= tbMaxCodeLen {
+            return lens
+        }
+        for _, s := range leaves {
+            freq[s] = (freq[s] + 1) / 2
+        }
+    }
+}
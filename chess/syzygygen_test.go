@@ -0,0 +1,79 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "bytes"
+    "io/ioutil"
+    "math/rand"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestCompressValues(t *testing.T) {
+    r := rand.New(rand.NewSource(1))
+    values := make([]int, 200000)
+    for i := 0; i < len(values); {
+        v, n := r.Intn(40), 1+r.Intn(300)
+        if r.Intn(10) == 0 {
+            v = -1
+        }
+        for ; n > 0 && i < len(values); n-- {
+            values[i] = v
+            i++
+        }
+    }
+    c := compressValues(tbWinPlies, values)
+    d := &tbPairs{}
+    d.groupLen[0], d.groupIdx[1] = 1, uint64(len(values))
+    if pos := d.setSizes(c.sizes, 0); pos != len(c.sizes) {
+        t.Fatalf("setSizes read %d of %d bytes", pos, len(c.sizes))
+    }
+    if d.flags != tbWinPlies || d.numBlocks < 10 || len(d.symLen) <= 40 {
+        t.Errorf("unexpected parameters %+v", d)
+    }
+    d.sparse, d.blockLen = c.sparse, c.blockLen
+    d.blocks = append(c.blocks, make([]byte, 16)...)
+    for i, v := range values {
+        if got := d.decompress(uint64(i)); v >= 0 && got != v {
+            t.Fatalf("value %d is %d, want %d", i, got, v)
+        }
+    }
+
+    c = compressValues(0, []int{-1, 3, -1, 3})
+    if !bytes.Equal(c.sizes, []byte{tbSingleValue, 3}) || c.blocks != nil {
+        t.Errorf("expected a single value, got %v", c.sizes)
+    }
+}
+
+// TestGenerateSyzygy checks that the tables in testdata/syzygy are the
+// ones generated by GenerateSyzygy.
+func TestGenerateSyzygy(t *testing.T) {
+    dir, err := ioutil.TempDir("", "syzygy")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    if err := GenerateSyzygy(dir, "KQK", "KPvK"); err != nil {
+        t.Fatal(err)
+    }
+    for _, name := range []string{"KQvK.rtbw", "KQvK.rtbz", "KPvK.rtbw",
+        "KPvK.rtbz"} {
+        data, err := ioutil.ReadFile(filepath.Join(dir, name))
+        if err != nil {
+            t.Fatal(err)
+        }
+        want, err := ioutil.ReadFile(filepath.Join("testdata/syzygy", name))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !bytes.Equal(data, want) {
+            t.Errorf("%s differs from testdata/syzygy", name)
+        }
+    }
+    if err := GenerateSyzygy(dir, "KQQQK"); err == nil {
+        t.Errorf("expected an error for five pieces")
+    }
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "sync/atomic"
+)
+
+// Bound types of scores stored in the transposition table.
+const (
+    boundExact = iota + 1 // the score is exact
+    boundLower            // the real score is at least as good (fail high)
+    boundUpper            // the real score is at most as good (fail low)
+)
+
+// A ttEntry stores the result of a search of a single position.
+type ttEntry struct {
+    key      uint64
+    score    int32
+    src, dst int8
+    depth    int8
+    bound    uint8
+    age      uint8
+}
+
+// pack encodes all fields except the key into a single word. The age is
+// truncated to 6 bits.
+func (e *ttEntry) pack() uint64 {
+    return uint64(uint32(e.score)) | uint64(uint8(e.src))<<32 |
+        uint64(uint8(e.dst))<<40 | uint64(uint8(e.depth))<<48 |
+        uint64(e.bound&3)<<56 | uint64(e.age&63)<<58
+}
+
+// unpack decodes an entry which was encoded with pack.
+func unpack(key, data uint64) ttEntry {
+    return ttEntry{key: key, score: int32(uint32(data)),
+        src: int8(data >> 32), dst: int8(data >> 40), depth: int8(data >> 48),
+        bound: uint8(data>>56) & 3, age: uint8(data>>58) & 63}
+}
+
+// A slot stores a packed entry in two words. The key is xored with the
+// data, so that torn writes of concurrent searches are detected.
+type slot struct {
+    check, data uint64
+}
+
+// size of a single slot in bytes
+const ttEntrySize = 16
+
+// A TransTable is a fixed-size hash table storing the results of previous
+// searches, so that positions reached by transposition don't need to be
+// searched again. Entries from the current search are only replaced by
+// results of searches with an equal or greater depth. The table can be
+// shared by multiple goroutines without any locking.
+type TransTable struct {
+    slots []slot
+    mask  uint64
+    age   uint32
+}
+
+// NewTransTable creates a transposition table using approximately mb
+// megabytes of memory. The number of entries is rounded down to a power of
+// two.
+func NewTransTable(mb int) *TransTable {
+    n := uint64(1)
+    for n*2*ttEntrySize <= uint64(mb)<<20 {
+        n *= 2
+    }
+    return &TransTable{slots: make([]slot, n), mask: n - 1}
+}
+
+// transTable is shared by all searches.
+var transTable = NewTransTable(16)
+
+// SetHashSize replaces the transposition table used by the AI with a new
+// table of approximately mb megabytes.
+func SetHashSize(mb int) {
+    transTable = NewTransTable(mb)
+}
+
+// newSearch marks all existing entries as outdated, so that they will be
+// replaced regardless of their depth.
+func (t *TransTable) newSearch() {
+    atomic.AddUint32(&t.age, 1)
+}
+
+// load reads the slot of the given key. The entry might belong to another
+// position or be corrupted by a concurrent write.
+func (t *TransTable) load(key uint64) ttEntry {
+    s := &t.slots[key&t.mask]
+    check, data := atomic.LoadUint64(&s.check), atomic.LoadUint64(&s.data)
+    return unpack(check^data, data)
+}
+
+// probe looks up the position with the given hash key.
+func (t *TransTable) probe(key uint64) (e ttEntry, ok bool) {
+    e = t.load(key)
+    return e, e.bound != 0 && e.key == key
+}
+
+// store saves the result of a search in the table.
+func (t *TransTable) store(key uint64, m Move, depth int, score int,
+    bound uint8) {
+    age := uint8(atomic.LoadUint32(&t.age)) & 63
+    e := t.load(key)
+    if e.bound == 0 || e.age != age || int(e.depth) <= depth {
+        e = ttEntry{key: key, score: int32(score), src: int8(m.Src),
+            dst: int8(m.Dst), depth: int8(depth), bound: bound, age: age}
+        s, data := &t.slots[key&t.mask], e.pack()
+        atomic.StoreUint64(&s.check, key^data)
+        atomic.StoreUint64(&s.data, data)
+    }
+}
+
+// move returns the best move stored in the entry.
+func (e *ttEntry) move() Move {
+    return Move{Square(e.src), Square(e.dst)}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "context"
+    "encoding/json"
+    "io"
+    "sort"
+)
+
+// Weights contains the parameters of the static evaluation. Each weight is
+// a pair of a middlegame and an endgame value in centipawns. Tuned weights
+// are written by the tune command in JSON and can be loaded with
+// ReadWeights and SetEvalWeights.
+type Weights struct {
+    Material     [7][2]int     // indexed by the piece kind
+    PieceSquare  [7][64][2]int // from white's point of view, a8 first
+    Mobility     [7][2]int     // per square the piece can move to
+    DoubledPawn  [2]int
+    IsolatedPawn [2]int
+    PassedPawn   [8][2]int // indexed by the rank from the pawn's side
+    PawnShield   [2]int
+    OpenKingFile [2]int
+    BishopPair   [2]int
+}
+
+// each calls f for all weights of w together with the corresponding weight
+// used by the evaluation. The order never changes.
+func (w *Weights) each(f func(param *[2]int, s *score)) {
+    for k := range w.Material {
+        f(&w.Material[k], &pieceValues[k])
+    }
+    for k := range w.PieceSquare {
+        for sq := range w.PieceSquare[k] {
+            f(&w.PieceSquare[k][sq], &psqt[k][sq])
+        }
+    }
+    for k := range w.Mobility {
+        f(&w.Mobility[k], &mobilityBonus[k])
+    }
+    f(&w.DoubledPawn, &doubledPawn)
+    f(&w.IsolatedPawn, &isolatedPawn)
+    for r := range w.PassedPawn {
+        f(&w.PassedPawn[r], &passedPawn[r])
+    }
+    f(&w.PawnShield, &pawnShield)
+    f(&w.OpenKingFile, &openKingFile)
+    f(&w.BishopPair, &bishopPairBonus)
+}
+
+// Params returns pointers to all weights of w. The indices are the same
+// as the ones used by EvalTrace.
+func (w *Weights) Params() (params []*[2]int) {
+    w.each(func(param *[2]int, s *score) {
+        params = append(params, param)
+    })
+    return
+}
+
+// paramIndex maps the weights used by the evaluation to their index in
+// the result of Params.
+var paramIndex = make(map[*score]int)
+
+func init() {
+    new(Weights).each(func(param *[2]int, s *score) {
+        paramIndex[s] = len(paramIndex)
+    })
+}
+
+// EvalWeights returns a copy of the weights used by the evaluation.
+func EvalWeights() *Weights {
+    w := new(Weights)
+    w.each(func(param *[2]int, s *score) {
+        *param = [2]int{s.mg, s.eg}
+    })
+    return w
+}
+
+// SetEvalWeights replaces the weights used by the evaluation. It must not
+// be called while a search is running.
+func SetEvalWeights(w *Weights) {
+    w.each(func(param *[2]int, s *score) {
+        *s = score{param[0], param[1]}
+    })
+}
+
+// ReadWeights reads weights in JSON. Weights which are missing in the
+// input keep their current value.
+func ReadWeights(r io.Reader) (*Weights, error) {
+    w := EvalWeights()
+    if err := json.NewDecoder(r).Decode(w); err != nil {
+        return nil, err
+    }
+    return w, nil
+}
+
+// A Trace expresses the static evaluation of a position as a linear
+// function of the weights. Ignoring rounding errors, the evaluation from
+// white's point of view is the sum of N*(mg*Phase + eg*(24-Phase))/24
+// over all terms.
+type Trace struct {
+    Phase int // game phase from 0 (endgame) to 24 (opening)
+    Terms []Term
+}
+
+// A Term states that the weight with the index Param in the result of
+// Params contributes N times to the evaluation. N is negative if the
+// weight is used for black.
+type Term struct {
+    Param, N int
+}
+
+// EvalTrace returns the trace of the static evaluation of the current
+// position. The terms are ordered by their index.
+func (b *Board) EvalTrace() Trace {
+    t := make(trace)
+    e := b.Position.eval(t)
+    tr := Trace{Phase: e.Phase}
+    for w, n := range t {
+        if n != 0 {
+            tr.Terms = append(tr.Terms, Term{paramIndex[w], n})
+        }
+    }
+    sort.Sort(byParam(tr.Terms))
+    return tr
+}
+
+type byParam []Term
+
+func (t byParam) Len() int           { return len(t) }
+func (t byParam) Less(i, j int) bool { return t[i].Param < t[j].Param }
+func (t byParam) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+
+// Quiet reports whether the player to move isn't in check and resolving
+// all captures doesn't change the static evaluation. Only quiet positions
+// are suitable for tuning the evaluation.
+func (p *Position) Quiet() bool {
+    if p.isCheck() {
+        return false
+    }
+    s := newSearcher(context.Background(), SearchLimits{})
+    return s.quiesce(p, 0, -infinity, infinity) == p.evaluate()
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package chess
+
+import (
+    "bytes"
+    "encoding/json"
+    "strings"
+    "testing"
+)
+
+func TestEvalTrace(t *testing.T) {
+    params := EvalWeights().Params()
+    for _, fen := range []string{
+        "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+        "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+        "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+        "2b1kb2/8/8/8/8/8/8/2B1K1N1 w - - 0 1",
+    } {
+        b, _ := ParseFEN(fen)
+        tr := b.EvalTrace()
+        sum := 0
+        for _, term := range tr.Terms {
+            w := params[term.Param]
+            sum += term.N * (w[0]*tr.Phase + w[1]*(maxPhase-tr.Phase))
+        }
+        // every term of the breakdown is rounded separately
+        e := b.EvalBreakdown()
+        if d := sum/maxPhase - e.Total; d < -6 || d > 6 || tr.Phase != e.Phase {
+            t.Errorf("trace of %q evaluates to %d, expected %d", fen,
+                sum/maxPhase, e.Total)
+        }
+    }
+}
+
+func TestSetEvalWeights(t *testing.T) {
+    orig := EvalWeights()
+    defer SetEvalWeights(orig)
+
+    if orig.Material[Q] != [2]int{pieceValues[Q].mg, pieceValues[Q].eg} ||
+        orig.PieceSquare[K][62] != [2]int{psqtMg[K][62], psqtEg[K][62]} {
+        t.Fatalf("unexpected weights %v", orig.Material)
+    }
+
+    data, err := json.Marshal(orig)
+    if err != nil {
+        t.Fatal(err)
+    }
+    w, err := ReadWeights(bytes.NewReader(data))
+    if err != nil || *w != *orig {
+        t.Fatalf("ReadWeights didn't restore the weights (%v)", err)
+    }
+
+    // missing weights keep their value
+    w, err = ReadWeights(strings.NewReader(`{"BishopPair": [100, 200]}`))
+    if err != nil || w.BishopPair != [2]int{100, 200} ||
+        w.Material != orig.Material {
+        t.Fatalf("unexpected weights %v (%v)", w.BishopPair, err)
+    }
+    SetEvalWeights(w)
+    b, _ := ParseFEN("2b1kb2/8/8/8/8/8/8/2B1K1N1 w - - 0 1")
+    if e := b.EvalBreakdown(); e.BishopPair != -(100*e.Phase+
+        200*(maxPhase-e.Phase))/maxPhase {
+        t.Errorf("the new weights aren't used:\n%v", e)
+    }
+}
+
+func TestQuiet(t *testing.T) {
+    for fen, quiet := range map[string]bool{
+        "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1": true,
+        "4k3/8/8/3q4/8/2N5/8/4K3 w - - 0 1":                        false,
+        "4k3/8/8/8/8/8/8/4R1K1 b - - 0 1":                          false,
+    } {
+        b, _ := ParseFEN(fen)
+        if b.Quiet() != quiet {
+            t.Errorf("Quiet(%q) = %v, want %v", fen, b.Quiet(), quiet)
+        }
+    }
+}
@@ -0,0 +1,301 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+// The chessbuddy-uci command runs the ChessBuddy search engine using the
+// Universal Chess Interface (UCI), so that it can be loaded into chess GUIs
+// and take part in engine tournaments. The protocol is spoken on stdin and
+// stdout:
+//
+//	uci, isready, ucinewgame, position [startpos | fen <fen>] [moves ...],
+//	go [depth n] [nodes n] [movetime ms] [wtime ms] [btime ms] [winc ms]
+//	   [binc ms] [movestogo n] [infinite], stop, setoption, quit
+//
+// The supported options are Hash (in MB), Threads and MultiPV.
+package main
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "github.com/tux21b/ChessBuddy/chess"
+    "io"
+    "os"
+    "runtime"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// A session holds the state of the engine between the commands of a GUI.
+type session struct {
+    mu  sync.Mutex // protects out, the search writes concurrently
+    out io.Writer
+
+    board   *chess.Board // nil after an invalid position
+    hash    int
+    threads int
+    multiPV int
+
+    stop func() // stops the running search or nil
+}
+
+func newSession(out io.Writer) *session {
+    return &session{out: out, board: chess.NewBoard(), hash: 16,
+        threads: runtime.NumCPU(), multiPV: 1}
+}
+
+// send writes a single line of output.
+func (s *session) send(format string, args ...interface{}) {
+    s.mu.Lock()
+    fmt.Fprintf(s.out, format+"\n", args...)
+    s.mu.Unlock()
+}
+
+// run processes the commands read from r until the input ends or the
+// "quit" command is received. A running search is stopped before run
+// returns.
+func (s *session) run(r io.Reader) error {
+    defer s.stopSearch()
+    scanner := bufio.NewScanner(r)
+    for scanner.Scan() {
+        if !s.handle(strings.Fields(scanner.Text())) {
+            return nil
+        }
+    }
+    return scanner.Err()
+}
+
+// handle executes a single command. It returns false if the session should
+// be terminated.
+func (s *session) handle(args []string) bool {
+    if len(args) == 0 {
+        return true
+    }
+    switch args[0] {
+    case "uci":
+        s.send("id name ChessBuddy")
+        s.send("id author Christoph Hack")
+        s.send("option name Hash type spin default 16 min 1 max 4096")
+        s.send("option name Threads type spin default %d min 1 max 256",
+            runtime.NumCPU())
+        s.send("option name MultiPV type spin default 1 min 1 max 64")
+        s.send("uciok")
+    case "isready":
+        s.send("readyok")
+    case "ucinewgame":
+        s.stopSearch()
+        chess.SetHashSize(s.hash)
+        s.board = chess.NewBoard()
+    case "position":
+        s.stopSearch()
+        if err := s.position(args[1:]); err != nil {
+            s.send("info string %v", err)
+        }
+    case "go":
+        s.stopSearch()
+        s.goSearch(args[1:])
+    case "stop":
+        s.stopSearch()
+    case "setoption":
+        s.stopSearch()
+        if err := s.setOption(args[1:]); err != nil {
+            s.send("info string %v", err)
+        }
+    case "quit":
+        return false
+    }
+    return true
+}
+
+// position sets up the board given by a "position" command. Underpromotions
+// are replaced by queen promotions, since they aren't supported. If the
+// position is invalid, the board is cleared and searches don't return any
+// move until the next valid position.
+func (s *session) position(args []string) error {
+    s.board = nil
+    var moves []string
+    for i, arg := range args {
+        if arg == "moves" {
+            args, moves = args[:i], args[i+1:]
+            break
+        }
+    }
+    var board *chess.Board
+    switch {
+    case len(args) == 1 && args[0] == "startpos":
+        board = chess.NewBoard()
+    case len(args) > 1 && args[0] == "fen":
+        b, err := chess.ParseFEN(strings.Join(args[1:], " "))
+        if err != nil {
+            return err
+        }
+        board = b
+    default:
+        return fmt.Errorf("invalid position %q", strings.Join(args, " "))
+    }
+    for _, mv := range moves {
+        if len(mv) == 5 {
+            mv = mv[:4]
+        }
+        if err := board.MoveText(mv, chess.UCI); err != nil {
+            return err
+        }
+    }
+    s.board = board
+    return nil
+}
+
+// parseGo converts the arguments of a "go" command into search limits for
+// the player to move. The returned duration is a fixed time per move or 0.
+func parseGo(args []string, color uint8) (limits chess.SearchLimits,
+    movetime time.Duration, err error) {
+    for i := 0; i < len(args); i++ {
+        if args[i] == "infinite" {
+            limits.Infinite = true
+            continue
+        }
+        if args[i] == "ponder" {
+            continue
+        }
+        if i+1 >= len(args) {
+            return limits, 0, fmt.Errorf("missing value for %q", args[i])
+        }
+        n, err := strconv.Atoi(args[i+1])
+        if err != nil {
+            return limits, 0, fmt.Errorf("invalid value for %q", args[i])
+        }
+        ms := time.Duration(n) * time.Millisecond
+        switch args[i] {
+        case "depth":
+            limits.Depth = n
+        case "nodes":
+            limits.Nodes = n
+        case "movetime":
+            movetime = ms
+        case "movestogo":
+            limits.MovesToGo = n
+        case "wtime", "btime":
+            if (args[i] == "wtime") == (color == chess.White) {
+                limits.Time = ms
+            }
+        case "winc", "binc":
+            if (args[i] == "winc") == (color == chess.White) {
+                limits.Inc = ms
+            }
+        }
+        i++
+    }
+    if movetime > 0 && limits.Depth <= 0 && limits.Nodes <= 0 {
+        // search as deep as possible until the time is up
+        limits.Time, limits.Infinite = 0, true
+    }
+    return limits, movetime, nil
+}
+
+// goSearch starts a new search in the background, which prints its
+// progress and finally the best move.
+func (s *session) goSearch(args []string) {
+    if s.board == nil {
+        s.send("info string no valid position")
+        s.send("bestmove 0000")
+        return
+    }
+    board := s.board.Clone()
+    limits, movetime, err := parseGo(args, board.Color())
+    if err != nil {
+        s.send("info string %v", err)
+        return
+    }
+    limits.Threads, limits.MultiPV = s.threads, s.multiPV
+    limits.Progress = func(info chess.Info) {
+        s.send("info %s", formatInfo(board, info))
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    var search context.Context
+    var timeout context.CancelFunc
+    if movetime > 0 {
+        search, timeout = context.WithTimeout(ctx, movetime)
+    } else {
+        search, timeout = context.WithCancel(ctx)
+    }
+    infinite := limits.Infinite && movetime <= 0
+    done := make(chan bool)
+    go func() {
+        defer close(done)
+        defer timeout()
+        m, _ := chess.SearchEngine{}.BestMove(search, board, limits)
+        if infinite {
+            // the best move must not be sent before "stop"
+            <-ctx.Done()
+        }
+        if m.Src < 0 {
+            s.send("bestmove 0000")
+        } else {
+            s.send("bestmove %s", board.FormatMove(m, chess.UCI))
+        }
+    }()
+    s.stop = func() {
+        cancel()
+        <-done
+    }
+}
+
+// stopSearch stops the running search, if any, and waits until the best
+// move has been sent.
+func (s *session) stopSearch() {
+    if s.stop != nil {
+        s.stop()
+        s.stop = nil
+    }
+}
+
+// formatInfo formats the statistics of a search for an "info" command.
+func formatInfo(b *chess.Board, info chess.Info) string {
+    score := fmt.Sprintf("cp %d", info.Score)
+    if info.Mate != 0 {
+        score = fmt.Sprintf("mate %d", info.Mate)
+    }
+    pv, p := make([]string, len(info.PV)), b.Position
+    for i, m := range info.PV {
+        pv[i] = p.FormatMove(m, chess.UCI)
+        p = p.Apply(m)
+    }
+    return fmt.Sprintf("depth %d seldepth %d multipv %d score %s nodes %d "+
+        "nps %d time %d pv %s", info.Depth, info.SelDepth, info.MultiPV,
+        score, info.Nodes, info.NPS, info.Time/time.Millisecond,
+        strings.Join(pv, " "))
+}
+
+// setOption changes one of the engine options, given as
+// "name <id> value <x>".
+func (s *session) setOption(args []string) error {
+    if len(args) != 4 || args[0] != "name" || args[2] != "value" {
+        return fmt.Errorf("invalid option %q", strings.Join(args, " "))
+    }
+    n, err := strconv.Atoi(args[3])
+    if err != nil || n < 1 {
+        return fmt.Errorf("invalid value %q", args[3])
+    }
+    switch strings.ToLower(args[1]) {
+    case "hash":
+        s.hash = n
+        chess.SetHashSize(n)
+    case "threads":
+        s.threads = n
+    case "multipv":
+        s.multiPV = n
+    default:
+        return fmt.Errorf("unknown option %q", args[1])
+    }
+    return nil
+}
+
+func main() {
+    runtime.GOMAXPROCS(runtime.NumCPU())
+    if err := newSession(os.Stdout).run(os.Stdin); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
+    }
+}
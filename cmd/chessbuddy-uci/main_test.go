@@ -0,0 +1,227 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package main
+
+import (
+    "fmt"
+    "github.com/tux21b/ChessBuddy/chess"
+    "github.com/tux21b/ChessBuddy/pool/guitest"
+    "io"
+    "strings"
+    "testing"
+    "time"
+)
+
+// startSession runs a session in the background and allows the test to
+// talk to it like a GUI.
+func startSession(t *testing.T) *guitest.Session {
+    return guitest.Start(t, func(r io.Reader, w io.Writer) error {
+        return newSession(w).run(r)
+    })
+}
+
+// bestMove applies the move of a "bestmove" line to b and checks that it's
+// legal.
+func bestMove(t *testing.T, b *chess.Board, line string) string {
+    fields := strings.Fields(line)
+    if len(fields) < 2 || fields[0] != "bestmove" {
+        t.Fatalf("invalid bestmove line %q", line)
+    }
+    if err := b.MoveText(fields[1], chess.UCI); err != nil {
+        t.Fatalf("illegal best move %q: %v", fields[1], err)
+    }
+    return fields[1]
+}
+
+func TestHandshake(t *testing.T) {
+    u := startSession(t)
+    u.Send("uci")
+    lines := u.Expect("uciok")
+    if lines[0] != "id name ChessBuddy" {
+        t.Errorf("expected the engine name, got %q", lines[0])
+    }
+    for _, opt := range []string{"Hash", "Threads", "MultiPV"} {
+        found := false
+        for _, line := range lines {
+            found = found || strings.HasPrefix(line, "option name "+opt+" ")
+        }
+        if !found {
+            t.Errorf("option %s not announced", opt)
+        }
+    }
+    u.Send("isready")
+    u.Expect("readyok")
+    u.Quit()
+}
+
+func TestGoDepth(t *testing.T) {
+    u := startSession(t)
+    u.Send("ucinewgame")
+    u.Send("position startpos moves e2e4 e7e5 g1f3")
+    u.Send("go depth 3")
+    lines := u.Expect("bestmove")
+
+    depth := 0
+    for _, line := range lines[:len(lines)-1] {
+        if !strings.HasPrefix(line, "info depth ") {
+            t.Fatalf("unexpected output %q", line)
+        }
+        fmt.Sscanf(line, "info depth %d", &depth)
+        if !strings.Contains(line, " pv ") {
+            t.Errorf("missing principal variation in %q", line)
+        }
+    }
+    if depth != 3 {
+        t.Errorf("expected the last info to have depth 3, got %d", depth)
+    }
+
+    b := chess.NewBoard()
+    for _, mv := range strings.Fields("e2e4 e7e5 g1f3") {
+        b.MoveText(mv, chess.UCI)
+    }
+    bestMove(t, b, lines[len(lines)-1])
+    u.Quit()
+}
+
+func TestPositionFEN(t *testing.T) {
+    u := startSession(t)
+    // the black queen on d5 is hanging
+    u.Send("position fen 4k3/8/8/3q4/8/2N5/8/4K3 w - - 0 1")
+    u.Send("go depth 2")
+    lines := u.Expect("bestmove")
+    if line := lines[len(lines)-1]; line != "bestmove c3d5" {
+        t.Errorf("expected bestmove c3d5, got %q", line)
+    }
+
+    // promotions are sent with the piece
+    u.Send("position fen 7k/P7/8/8/8/8/8/K7 w - - 0 1")
+    u.Send("go depth 1")
+    lines = u.Expect("bestmove")
+    if line := lines[len(lines)-1]; line != "bestmove a7a8q" {
+        t.Errorf("expected bestmove a7a8q, got %q", line)
+    }
+
+    // underpromotions are played as queen promotions
+    u.Send("position fen 7k/4P3/8/8/8/8/8/K7 w - - 0 1 moves e7e8n h8h7")
+    u.Send("go depth 1")
+    lines = u.Expect("bestmove")
+    b, _ := chess.ParseFEN("7k/4P3/8/8/8/8/8/K7 w - - 0 1")
+    b.MoveText("e7e8", chess.UCI)
+    b.MoveText("h8h7", chess.UCI)
+    bestMove(t, b, lines[len(lines)-1])
+
+    // invalid positions don't leave the previous board behind
+    u.Send("position startpos moves e2e5")
+    u.Send("go depth 1")
+    if lines = u.Expect("bestmove"); lines[len(lines)-1] != "bestmove 0000" {
+        t.Errorf("expected bestmove 0000 after an invalid position, got %q",
+            lines)
+    }
+
+    // the player to move has been checkmated
+    u.Send("position fen 7k/6Q1/6K1/8/8/8/8/8 b - - 0 1")
+    u.Send("go depth 1")
+    lines = u.Expect("bestmove")
+    if line := lines[len(lines)-1]; line != "bestmove 0000" {
+        t.Errorf("expected bestmove 0000, got %q", line)
+    }
+    u.Quit()
+}
+
+func TestInfiniteAndStop(t *testing.T) {
+    u := startSession(t)
+    u.Send("position startpos")
+    u.Send("go infinite")
+    u.Expect("info depth 2 ")
+    select {
+    case line := <-u.Lines:
+        if strings.HasPrefix(line, "bestmove") {
+            t.Fatalf("best move sent before stop")
+        }
+    case <-time.After(50 * time.Millisecond):
+    }
+    u.Send("stop")
+    lines := u.Expect("bestmove")
+    bestMove(t, chess.NewBoard(), lines[len(lines)-1])
+    u.Quit()
+}
+
+func TestMoveTime(t *testing.T) {
+    u := startSession(t)
+    u.Send("position startpos moves d2d4")
+    start := time.Now()
+    u.Send("go movetime 200")
+    lines := u.Expect("bestmove")
+    if d := time.Since(start); d < 200*time.Millisecond || d > 2*time.Second {
+        t.Errorf("search with movetime 200 took %v", d)
+    }
+    b := chess.NewBoard()
+    b.MoveText("d2d4", chess.UCI)
+    bestMove(t, b, lines[len(lines)-1])
+
+    start = time.Now()
+    u.Send("go wtime 1000 btime 1000 winc 0 binc 0")
+    u.Expect("bestmove")
+    if d := time.Since(start); d > 600*time.Millisecond {
+        t.Errorf("search with 1s on the clock took %v", d)
+    }
+    u.Quit()
+}
+
+func TestMultiPV(t *testing.T) {
+    u := startSession(t)
+    u.Send("setoption name MultiPV value 3")
+    u.Send("setoption name Threads value 1")
+    u.Send("position startpos")
+    u.Send("go depth 2")
+    lines := u.Expect("bestmove")
+    seen := make(map[string]bool)
+    for _, line := range lines {
+        if strings.HasPrefix(line, "info depth 2 ") {
+            seen[line[strings.Index(line, " multipv ")+9:][:1]] = true
+        }
+    }
+    if len(seen) != 3 || !seen["1"] || !seen["2"] || !seen["3"] {
+        t.Errorf("expected 3 lines at depth 2, got %q", lines)
+    }
+
+    u.Send("setoption name Foo value 1")
+    if line := u.Expect("info string")[0]; !strings.Contains(line, "unknown") {
+        t.Errorf("unexpected error %q", line)
+    }
+    u.Quit()
+}
+
+func TestParseGo(t *testing.T) {
+    tests := []struct {
+        args     string
+        color    uint8
+        limits   chess.SearchLimits
+        movetime time.Duration
+    }{
+        {"depth 5", chess.White, chess.SearchLimits{Depth: 5}, 0},
+        {"wtime 60000 btime 30000 winc 1000 binc 500 movestogo 20",
+            chess.Black, chess.SearchLimits{Time: 30 * time.Second,
+                Inc: 500 * time.Millisecond, MovesToGo: 20}, 0},
+        {"infinite", chess.White, chess.SearchLimits{Infinite: true}, 0},
+        {"movetime 1500", chess.White, chess.SearchLimits{Infinite: true},
+            1500 * time.Millisecond},
+        {"movetime 1500 depth 3", chess.White, chess.SearchLimits{Depth: 3},
+            1500 * time.Millisecond},
+    }
+    for _, test := range tests {
+        limits, movetime, err := parseGo(strings.Fields(test.args), test.color)
+        if err != nil || limits.Depth != test.limits.Depth ||
+            limits.Time != test.limits.Time || limits.Inc != test.limits.Inc ||
+            limits.MovesToGo != test.limits.MovesToGo ||
+            limits.Infinite != test.limits.Infinite ||
+            movetime != test.movetime {
+            t.Errorf("parseGo(%q) = %+v, %v, %v", test.args, limits, movetime,
+                err)
+        }
+    }
+    if _, _, err := parseGo([]string{"depth"}, chess.White); err == nil {
+        t.Errorf("expected an error for a missing value")
+    }
+}
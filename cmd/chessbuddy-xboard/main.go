@@ -0,0 +1,323 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+// The chessbuddy-xboard command runs the ChessBuddy search engine using
+// version 2 of the Chess Engine Communication Protocol (CECP), so that it
+// can be used with XBoard, WinBoard and compatible GUIs. The supported
+// commands are:
+//
+//	xboard, protover, accepted, rejected, new, force, go, usermove, ?,
+//	setboard, undo, remove, level, st, sd, time, post, nopost, ping,
+//	result, quit
+//
+// All other commands, e.g. "hard", "easy" or "computer", are ignored.
+package main
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "github.com/tux21b/ChessBuddy/chess"
+    "io"
+    "os"
+    "runtime"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// A session holds the state of the game played under the GUI.
+type session struct {
+    mu  sync.Mutex // protects out and abort, the search runs concurrently
+    out io.Writer
+
+    board  *chess.Board
+    force  bool  // the engine plays neither color
+    engine uint8 // color played by the engine
+    post   bool  // send thinking output
+
+    mps, depth int           // moves per time control, depth limit
+    inc        time.Duration // increment per move set by "level"
+    moveTime   time.Duration // fixed time per move set by "st"
+    clock      time.Duration // remaining time of the engine
+
+    stop  func(abort bool) // stops the running search or nil
+    abort bool             // the result of the search is discarded
+}
+
+func newSession(out io.Writer) *session {
+    s := &session{out: out}
+    s.reset()
+    return s
+}
+
+// reset starts a new game, in which the engine plays black.
+func (s *session) reset() {
+    s.board, s.force, s.engine = chess.NewBoard(), false, chess.Black
+    s.mps, s.depth, s.inc, s.moveTime, s.clock = 0, 0, 0, 0, 0
+}
+
+// send writes a single line of output.
+func (s *session) send(format string, args ...interface{}) {
+    s.mu.Lock()
+    fmt.Fprintf(s.out, format+"\n", args...)
+    s.mu.Unlock()
+}
+
+// run processes the commands read from r until the input ends or the
+// "quit" command is received.
+func (s *session) run(r io.Reader) error {
+    defer s.stopSearch(true)
+    scanner := bufio.NewScanner(r)
+    for scanner.Scan() {
+        if !s.handle(strings.Fields(scanner.Text())) {
+            return nil
+        }
+    }
+    return scanner.Err()
+}
+
+// handle executes a single command. It returns false if the session should
+// be terminated.
+func (s *session) handle(args []string) bool {
+    if len(args) == 0 {
+        return true
+    }
+    switch args[0] {
+    case "protover":
+        s.send("feature myname=\"ChessBuddy\" usermove=1 setboard=1 " +
+            "ping=1 sigint=0 sigterm=0 colors=0 analyze=0 done=1")
+    case "ping":
+        if len(args) > 1 {
+            s.send("pong %s", args[1])
+        }
+    case "time":
+        if len(args) > 1 {
+            n, _ := strconv.Atoi(args[1])
+            s.clock = time.Duration(n) * 10 * time.Millisecond
+        }
+    case "post", "nopost":
+        s.post = args[0] == "post"
+    case "?":
+        s.stopSearch(false)
+    case "new":
+        s.stopSearch(true)
+        s.reset()
+    case "force", "result":
+        s.stopSearch(true)
+        s.force = true
+    case "go":
+        s.stopSearch(true)
+        s.force, s.engine = false, s.board.Color()
+        s.think()
+    case "usermove":
+        s.stopSearch(true)
+        if len(args) > 1 {
+            s.userMove(args[1])
+        }
+    case "setboard":
+        s.stopSearch(true)
+        b, err := chess.ParseFEN(strings.Join(args[1:], " "))
+        if err != nil {
+            s.send("tellusererror Illegal position")
+            return true
+        }
+        s.board = b
+    case "undo", "remove":
+        s.stopSearch(true)
+        n := 1
+        if args[0] == "remove" {
+            n = 2
+        }
+        s.undo(n)
+    case "level":
+        s.stopSearch(true)
+        if err := s.level(args[1:]); err != nil {
+            s.send("Error (%v): %s", err, strings.Join(args, " "))
+        }
+    case "st", "sd":
+        s.stopSearch(true)
+        n := 0
+        if len(args) > 1 {
+            n, _ = strconv.Atoi(args[1])
+        }
+        if args[0] == "st" {
+            s.moveTime = time.Duration(n) * time.Second
+        } else {
+            s.depth = n
+        }
+    case "quit":
+        return false
+    case "xboard", "accepted", "rejected", "otim", "hard", "easy", "random",
+        "computer", "name", "rating", "draw", "ics", "variant", "white",
+        "black", "edit", "hint", "bk", "analyze", "exit", ".":
+    default:
+        // engines which haven't negotiated usermove receive bare moves
+        if _, err := chess.ParseMove(args[0]); err == nil {
+            s.stopSearch(true)
+            s.userMove(args[0])
+        } else {
+            s.send("Error (unknown command): %s", args[0])
+        }
+    }
+    return true
+}
+
+// userMove applies a move of the opponent and starts thinking, if it's the
+// turn of the engine.
+func (s *session) userMove(text string) {
+    if err := s.board.MoveText(text, chess.UCI); err != nil {
+        s.send("Illegal move: %s", text)
+        return
+    }
+    if !s.force && s.board.Color() == s.engine {
+        s.think()
+    }
+}
+
+// undo takes back the last n half-moves by replaying the game.
+func (s *session) undo(n int) {
+    moves := s.board.History(chess.UCI)
+    if n > len(moves) {
+        n = len(moves)
+    }
+    start := s.board.StartPosition()
+    b, _ := chess.ParseFEN(start.String())
+    for _, mv := range moves[:len(moves)-n] {
+        b.MoveText(mv, chess.UCI)
+    }
+    s.board = b
+}
+
+// level parses a conventional time control, e.g. "40 5 0" or "0 2:30 12".
+func (s *session) level(args []string) error {
+    if len(args) != 3 {
+        return fmt.Errorf("invalid time control")
+    }
+    mps, err := strconv.Atoi(args[0])
+    if err != nil {
+        return err
+    }
+    var min, sec int
+    if i := strings.IndexByte(args[1], ':'); i >= 0 {
+        min, err = strconv.Atoi(args[1][:i])
+        if err == nil {
+            sec, err = strconv.Atoi(args[1][i+1:])
+        }
+    } else {
+        min, err = strconv.Atoi(args[1])
+    }
+    if err != nil {
+        return err
+    }
+    inc, err := strconv.ParseFloat(args[2], 64)
+    if err != nil {
+        return err
+    }
+    s.mps, s.inc = mps, time.Duration(inc*float64(time.Second))
+    s.clock = time.Duration(min)*time.Minute + time.Duration(sec)*time.Second
+    s.moveTime = 0
+    return nil
+}
+
+// limits returns the search limits for the next move of the engine and a
+// fixed time per move or 0.
+func (s *session) limits() (limits chess.SearchLimits, movetime time.Duration) {
+    limits.Depth = s.depth
+    if s.moveTime > 0 {
+        if limits.Depth <= 0 {
+            limits.Infinite = true
+        }
+        return limits, s.moveTime
+    }
+    if s.clock > 0 {
+        limits.Time, limits.Inc = s.clock, s.inc
+        if s.mps > 0 {
+            moves := (s.board.Turn() - 1) / 2
+            limits.MovesToGo = s.mps - moves%s.mps
+        }
+    }
+    return limits, 0
+}
+
+// think starts a search in the background, which plays the best move it
+// has found unless it's aborted.
+func (s *session) think() {
+    board := s.board.Clone()
+    limits, movetime := s.limits()
+    limits.Threads = runtime.NumCPU()
+    if s.post {
+        limits.Progress = func(info chess.Info) {
+            s.send("%s", formatThinking(board, info))
+        }
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    var search context.Context
+    var timeout context.CancelFunc
+    if movetime > 0 {
+        search, timeout = context.WithTimeout(ctx, movetime)
+    } else {
+        search, timeout = context.WithCancel(ctx)
+    }
+    done := make(chan bool)
+    s.abort = false
+    go func() {
+        defer close(done)
+        defer timeout()
+        m, _ := chess.SearchEngine{}.BestMove(search, board, limits)
+
+        s.mu.Lock()
+        defer s.mu.Unlock()
+        if s.abort || !s.board.Move(m.Src, m.Dst) {
+            return
+        }
+        fmt.Fprintf(s.out, "move %s\n", board.FormatMove(m, chess.UCI))
+        switch {
+        case s.board.Checkmate() && s.board.Color() == chess.Black:
+            fmt.Fprintln(s.out, "1-0 {White mates}")
+        case s.board.Checkmate():
+            fmt.Fprintln(s.out, "0-1 {Black mates}")
+        case s.board.Stalemate():
+            fmt.Fprintln(s.out, "1/2-1/2 {Stalemate}")
+        }
+    }()
+    s.stop = func(abort bool) {
+        s.mu.Lock()
+        s.abort = abort
+        s.mu.Unlock()
+        cancel()
+        <-done
+    }
+}
+
+// stopSearch stops the running search, if any. The best move found so far
+// is played, unless abort is set.
+func (s *session) stopSearch(abort bool) {
+    if s.stop != nil {
+        s.stop(abort)
+        s.stop = nil
+    }
+}
+
+// formatThinking formats the statistics of a search as thinking output:
+// depth, score in centipawns, time in centiseconds, nodes and the
+// principal variation.
+func formatThinking(b *chess.Board, info chess.Info) string {
+    pv, p := make([]string, len(info.PV)), b.Position
+    for i, m := range info.PV {
+        pv[i] = p.FormatMove(m, chess.SAN)
+        p = p.Apply(m)
+    }
+    return fmt.Sprintf("%d %d %d %d %s", info.Depth, info.Score,
+        info.Time/(10*time.Millisecond), info.Nodes, strings.Join(pv, " "))
+}
+
+func main() {
+    runtime.GOMAXPROCS(runtime.NumCPU())
+    if err := newSession(os.Stdout).run(os.Stdin); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
+    }
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "github.com/tux21b/ChessBuddy/chess"
+    "github.com/tux21b/ChessBuddy/pool/guitest"
+    "io"
+    "io/ioutil"
+    "strings"
+    "testing"
+    "time"
+)
+
+// startSession runs a session in the background, which has been asked to
+// use version 2 of the protocol, and allows the test to talk to it like a
+// GUI.
+func startSession(t *testing.T) *guitest.Session {
+    x := guitest.Start(t, func(r io.Reader, w io.Writer) error {
+        return newSession(w).run(r)
+    })
+    x.Send("xboard")
+    x.Send("protover 2")
+    x.Expect("feature ")
+    return x
+}
+
+// expectMove waits for the next move of the engine and checks that it's
+// legal on b.
+func expectMove(t *testing.T, x *guitest.Session, b *chess.Board) string {
+    lines := x.Expect("move ")
+    mv := strings.TrimPrefix(lines[len(lines)-1], "move ")
+    if err := b.MoveText(mv, chess.UCI); err != nil {
+        t.Fatalf("illegal move %q: %v", mv, err)
+    }
+    return mv
+}
+
+func TestFeatures(t *testing.T) {
+    inR, inW := io.Pipe()
+    outR, outW := io.Pipe()
+    go newSession(outW).run(inR)
+    go fmt.Fprintln(inW, "protover 2")
+    line, _ := bufio.NewReader(outR).ReadString('\n')
+    for _, f := range []string{"usermove=1", "setboard=1", "ping=1", "done=1"} {
+        if !strings.Contains(line, f) {
+            t.Errorf("feature %s not announced in %q", f, line)
+        }
+    }
+    inW.Close()
+
+    x := startSession(t)
+    x.Send("ping 42")
+    x.Expect("pong 42")
+    x.Send("foo")
+    x.Expect("Error (unknown command): foo")
+    x.Quit()
+}
+
+func TestPlayBlack(t *testing.T) {
+    x := startSession(t)
+    x.Send("new", "sd 2", "usermove e2e4")
+    b := chess.NewBoard()
+    b.MoveText("e2e4", chess.UCI)
+    expectMove(t, x, b)
+
+    // the engine keeps playing black
+    mv := b.LegalMoves()[0]
+    x.Send("usermove " + b.FormatMove(mv, chess.UCI))
+    b.Move(mv.Src, mv.Dst)
+    expectMove(t, x, b)
+
+    x.Send("usermove e2e5")
+    x.Expect("Illegal move: e2e5")
+    x.Quit()
+}
+
+func TestGo(t *testing.T) {
+    x := startSession(t)
+    // the black queen on d5 is hanging
+    x.Send("new", "force", "setboard 4k3/8/8/3q4/8/2N5/8/4K3 w - - 0 1",
+        "sd 2", "go")
+    if lines := x.Expect("move "); lines[len(lines)-1] != "move c3d5" {
+        t.Errorf("expected move c3d5, got %q", lines)
+    }
+
+    // the engine claims the result after mating
+    x.Send("new", "force", "setboard 6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1",
+        "sd 2", "go")
+    if lines := x.Expect("move "); lines[len(lines)-1] != "move a1a8" {
+        t.Errorf("expected move a1a8, got %q", lines)
+    }
+    x.Expect("1-0 {White mates}")
+    x.Quit()
+}
+
+func TestForceAndUndo(t *testing.T) {
+    x := startSession(t)
+    x.Send("new", "force", "usermove e2e4", "usermove e7e5", "undo",
+        "sd 1", "go")
+    b := chess.NewBoard()
+    b.MoveText("e2e4", chess.UCI)
+    expectMove(t, x, b)
+
+    x.Send("force", "remove", "remove", "go")
+    expectMove(t, x, chess.NewBoard())
+    x.Quit()
+}
+
+func TestMoveNowAndPost(t *testing.T) {
+    x := startSession(t)
+    x.Send("new", "force", "post", "st 60", "go")
+    lines := x.Expect("2 ")
+    if !strings.HasPrefix(lines[0], "1 ") {
+        t.Errorf("expected thinking output for depth 1, got %q", lines)
+    }
+    start := time.Now()
+    x.Send("?")
+    expectMove(t, x, chess.NewBoard())
+    if d := time.Since(start); d > 2*time.Second {
+        t.Errorf("the engine took %v to move after ?", d)
+    }
+
+    // aborted searches don't play any move
+    x.Send("nopost", "new", "force", "st 60", "go", "force", "ping 1")
+    if lines := x.Expect("pong 1"); len(lines) != 1 {
+        t.Errorf("unexpected output %q", lines)
+    }
+    x.Quit()
+}
+
+func TestLevel(t *testing.T) {
+    tests := []struct {
+        args       string
+        mps        int
+        clock, inc time.Duration
+    }{
+        {"40 5 0", 40, 5 * time.Minute, 0},
+        {"0 2:30 12", 0, 150 * time.Second, 12 * time.Second},
+        {"0 0:30 0.5", 0, 30 * time.Second, 500 * time.Millisecond},
+    }
+    for _, test := range tests {
+        s := newSession(ioutil.Discard)
+        if err := s.level(strings.Fields(test.args)); err != nil ||
+            s.mps != test.mps || s.clock != test.clock || s.inc != test.inc {
+            t.Errorf("level %s: got %d %v %v (%v)", test.args, s.mps, s.clock,
+                s.inc, err)
+        }
+    }
+
+    s := newSession(ioutil.Discard)
+    s.level([]string{"40", "5", "0"})
+    for i := 0; i < 20; i++ {
+        s.board.Move(s.board.LegalMoves()[0].Src, s.board.LegalMoves()[0].Dst)
+    }
+    if limits, _ := s.limits(); limits.MovesToGo != 30 ||
+        limits.Time != 5*time.Minute {
+        t.Errorf("unexpected limits %+v", limits)
+    }
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+// The endgame command generates endgame tables with three or four pieces
+// by retrograde analysis and writes them to the output directory, e.g.
+// KQvK.egt and KBNvK.egt. Tables with four pieces take about a minute, or
+// several minutes if pawns are involved.
+//
+// With the -syzygy flag, the tables are written in the format of the
+// Syzygy tablebases instead, e.g. KRvK.rtbw and KRvK.rtbz, which can be
+// used with the -syzygy flag of the server.
+//
+// With the -probe flag, the given position is looked up in the tables
+// instead, which are either loaded from files or generated on the fly:
+//
+//	endgame -probe="8/8/8/4k3/8/8/8/R3K3 w - - 0 1" KRvK.egt
+//
+// Usage:
+//
+//	endgame [flags] material...
+//	endgame -probe=fen material|file...
+package main
+
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "github.com/tux21b/ChessBuddy/chess"
+    "log"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+var output *string = flag.String("o", ".",
+    "directory the generated tables are written to")
+var fen *string = flag.String("probe", "",
+    "position in FEN which is looked up instead")
+var syzygy *bool = flag.Bool("syzygy", false,
+    "write Syzygy tablebases (.rtbw and .rtbz files)")
+
+// load reads the table files and generates the tables of all other
+// arguments, which are materials like KQK or KRvK.
+func load(args []string) ([]*chess.EndgameTable, error) {
+    var tables, generated []*chess.EndgameTable
+    var materials []string
+    for _, arg := range args {
+        if !strings.HasSuffix(arg, ".egt") {
+            materials = append(materials, arg)
+            continue
+        }
+        f, err := os.Open(arg)
+        if err != nil {
+            return nil, err
+        }
+        t, err := chess.ReadEndgameTable(f)
+        f.Close()
+        if err != nil {
+            return nil, fmt.Errorf("%s: %v", arg, err)
+        }
+        tables = append(tables, t)
+    }
+    if len(materials) > 0 {
+        var err error
+        if generated, err = chess.GenerateEndgames(materials...); err != nil {
+            return nil, err
+        }
+    }
+    return append(tables, generated...), nil
+}
+
+// probe describes the result of the position with perfect play.
+func probe(tables []*chess.EndgameTable, fen string) (string, error) {
+    b, err := chess.ParseFEN(fen)
+    if err != nil {
+        return "", err
+    }
+    for _, t := range tables {
+        wdl, dtm, err := t.Probe(b)
+        if err == chess.ErrNotInTablebases {
+            continue
+        } else if err != nil {
+            return "", err
+        }
+        switch {
+        case wdl == chess.WDLWin:
+            return fmt.Sprintf("%s: win, mate in %d", t.Material(),
+                (dtm+1)/2), nil
+        case wdl == chess.WDLLoss && dtm == 0:
+            return fmt.Sprintf("%s: checkmate", t.Material()), nil
+        case wdl == chess.WDLLoss:
+            return fmt.Sprintf("%s: loss, mated in %d", t.Material(),
+                dtm/2), nil
+        }
+        return fmt.Sprintf("%s: draw", t.Material()), nil
+    }
+    return "", errors.New("position not found in the tables")
+}
+
+func main() {
+    flag.Usage = func() {
+        fmt.Fprintf(os.Stderr, "usage: endgame [flags] material...\n")
+        fmt.Fprintf(os.Stderr, "       endgame -probe=fen material|file...\n")
+        flag.PrintDefaults()
+    }
+    flag.Parse()
+    if flag.NArg() == 0 {
+        flag.Usage()
+        os.Exit(2)
+    }
+
+    if *fen != "" {
+        tables, err := load(flag.Args())
+        if err != nil {
+            log.Fatal(err)
+        }
+        result, err := probe(tables, *fen)
+        if err != nil {
+            log.Fatal(err)
+        }
+        fmt.Println(result)
+        return
+    }
+
+    if *syzygy {
+        if err := chess.GenerateSyzygy(*output, flag.Args()...); err != nil {
+            log.Fatal(err)
+        }
+        log.Printf("Wrote the Syzygy tablebases to %s", *output)
+        return
+    }
+
+    tables, err := chess.GenerateEndgames(flag.Args()...)
+    if err != nil {
+        log.Fatal(err)
+    }
+    for _, t := range tables {
+        path := filepath.Join(*output, t.Material()+".egt")
+        f, err := os.Create(path)
+        if err != nil {
+            log.Fatal(err)
+        }
+        if _, err := t.WriteTo(f); err != nil {
+            log.Fatalf("%s: %v", path, err)
+        }
+        if err := f.Close(); err != nil {
+            log.Fatal(err)
+        }
+        log.Printf("Wrote %s", path)
+    }
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package main
+
+import (
+    "github.com/tux21b/ChessBuddy/chess"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestProbe(t *testing.T) {
+    dir, err := ioutil.TempDir("", "endgame")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    tables, err := chess.GenerateEndgames("KQK")
+    if err != nil {
+        t.Fatal(err)
+    }
+    path := filepath.Join(dir, "KQvK.egt")
+    f, err := os.Create(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    tables[0].WriteTo(f)
+    f.Close()
+
+    tables, err = load([]string{path, "KRK"})
+    if err != nil || len(tables) != 2 {
+        t.Fatalf("load failed: %v", err)
+    }
+    tests := []struct {
+        fen, result string
+    }{
+        {"k7/8/1K6/8/8/8/8/6Q1 w - - 0 1", "KQvK: win, mate in 1"},
+        {"k6Q/8/1K6/8/8/8/8/8 b - - 0 1", "KQvK: checkmate"},
+        {"k7/2Q5/K7/8/8/8/8/8 b - - 0 1", "KQvK: draw"},
+        {"8/8/8/4k3/8/8/8/R3K3 b - - 0 1", "KRvK: loss, mated in 14"},
+    }
+    for _, test := range tests {
+        if result, err := probe(tables, test.fen); err != nil || result != test.result {
+            t.Errorf("probe(%q) = %q, %v, want %q", test.fen, result, err, test.result)
+        }
+    }
+    if _, err := probe(tables,
+        "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"); err == nil {
+        t.Errorf("expected an error for the start position")
+    }
+}
@@ -0,0 +1,319 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+// The tune command optimizes the weights of the static evaluation with the
+// Texel tuning method. It reads finished games from PGN files, extracts all
+// quiet positions and minimizes the mean squared error between the game
+// results and the winning probability predicted by the evaluation:
+//
+//	E = 1/N * sum (result - sigmoid(eval))^2
+//	sigmoid(s) = 1 / (1 + 10^(-K*s/400))
+//
+// The scaling constant K is fitted to the initial weights first. The tuned
+// weights are written in JSON and can be loaded with the -weights flag of
+// the server.
+//
+// Usage:
+//
+//	tune [flags] games.pgn...
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "github.com/tux21b/ChessBuddy/chess"
+    "io/ioutil"
+    "log"
+    "math"
+    "os"
+    "regexp"
+    "runtime"
+    "sync"
+)
+
+var output *string = flag.String("o", "weights.json",
+    "file the tuned weights are written to")
+var initial *string = flag.String("weights", "",
+    "weights to start with instead of the built-in ones")
+var skip *int = flag.Int("skip", 8,
+    "number of half-moves skipped at the start of each game")
+var maxPositions *int = flag.Int("positions", 0,
+    "maximum number of positions used or 0")
+var iterations *int = flag.Int("iter", 1000, "number of iterations")
+var rate *float64 = flag.Float64("rate", 1, "learning rate in centipawns")
+var scale *float64 = flag.Float64("k", 0,
+    "scaling constant of the sigmoid, fitted if 0")
+
+// game phase of the evaluation if all pieces are on the board
+const maxPhase = 24
+
+// A sample is a quiet position together with the result of its game.
+type sample struct {
+    result float64 // from white's point of view
+    phase  int
+    terms  []term
+}
+
+// A term is a compact version of chess.Term.
+type term struct {
+    param, n int16
+}
+
+func newSample(tr chess.Trace, result float64) sample {
+    s := sample{result: result, phase: tr.Phase, terms: make([]term,
+        len(tr.Terms))}
+    for i, t := range tr.Terms {
+        s.terms[i] = term{int16(t.Param), int16(t.N)}
+    }
+    return s
+}
+
+// extract replays the game and returns its quiet positions, except for
+// the first skip half-moves. Games with an unknown result are ignored and
+// games with unsupported moves, e.g. underpromotions, are truncated.
+func extract(g *game, skip int) (samples []sample) {
+    result := g.score()
+    if result < 0 {
+        return nil
+    }
+    b := chess.NewBoard()
+    if g.fen != "" {
+        var err error
+        if b, err = chess.ParseFEN(g.fen); err != nil {
+            return nil
+        }
+    }
+    for i, mv := range g.moves {
+        if b.MoveSAN(mv) != nil {
+            break
+        }
+        if i < skip || b.Stalemate() || !b.Quiet() {
+            continue
+        }
+        samples = append(samples, newSample(b.EvalTrace(), result))
+    }
+    return samples
+}
+
+// A tuner optimizes the weights on a set of samples.
+type tuner struct {
+    samples []sample
+    params  [][2]float64
+}
+
+func newTuner(samples []sample, w *chess.Weights) *tuner {
+    t := &tuner{samples: samples}
+    for _, p := range w.Params() {
+        t.params = append(t.params, [2]float64{float64(p[0]), float64(p[1])})
+    }
+    return t
+}
+
+// eval returns the evaluation of s from white's point of view.
+func (t *tuner) eval(s *sample) float64 {
+    var mg, eg float64
+    for _, tm := range s.terms {
+        mg += float64(tm.n) * t.params[tm.param][0]
+        eg += float64(tm.n) * t.params[tm.param][1]
+    }
+    return (mg*float64(s.phase) + eg*float64(maxPhase-s.phase)) / maxPhase
+}
+
+func sigmoid(k, s float64) float64 {
+    return 1 / (1 + math.Pow(10, -k*s/400))
+}
+
+// gradient returns the mean squared error of all samples. If grad isn't
+// nil, the gradient of the error with respect to the weights is stored in
+// it. The samples are split among all CPUs.
+func (t *tuner) gradient(k float64, grad [][2]float64) float64 {
+    workers := runtime.NumCPU()
+    errs := make([]float64, workers)
+    grads := make([][][2]float64, workers)
+    var wg sync.WaitGroup
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func(w int) {
+            defer wg.Done()
+            if grad != nil {
+                grads[w] = make([][2]float64, len(t.params))
+            }
+            for i := w; i < len(t.samples); i += workers {
+                s := &t.samples[i]
+                p := sigmoid(k, t.eval(s))
+                errs[w] += (s.result - p) * (s.result - p)
+                if grad == nil {
+                    continue
+                }
+                // derivative of the error by the evaluation
+                d := -2 * (s.result - p) * p * (1 - p) * math.Ln10 * k / 400
+                mg := d * float64(s.phase) / maxPhase
+                eg := d * float64(maxPhase-s.phase) / maxPhase
+                for _, tm := range s.terms {
+                    grads[w][tm.param][0] += mg * float64(tm.n)
+                    grads[w][tm.param][1] += eg * float64(tm.n)
+                }
+            }
+        }(w)
+    }
+    wg.Wait()
+
+    n, e := float64(len(t.samples)), 0.0
+    for w := range errs {
+        e += errs[w]
+    }
+    if grad != nil {
+        for i := range grad {
+            grad[i] = [2]float64{}
+            for w := range grads {
+                grad[i][0] += grads[w][i][0] / n
+                grad[i][1] += grads[w][i][1] / n
+            }
+        }
+    }
+    return e / n
+}
+
+// fitK returns the scaling constant which minimizes the error of the
+// current weights.
+func (t *tuner) fitK() float64 {
+    // the error is unimodal in k, so a ternary search is sufficient
+    lo, hi := 0.01, 10.0
+    for hi-lo > 1e-4 {
+        a, b := lo+(hi-lo)/3, hi-(hi-lo)/3
+        if t.gradient(a, nil) < t.gradient(b, nil) {
+            hi = b
+        } else {
+            lo = a
+        }
+    }
+    return (lo + hi) / 2
+}
+
+// tune minimizes the error using the Adam method, which adapts the step
+// size of each weight individually. Weights which aren't used by any
+// sample never change.
+func (t *tuner) tune(k float64, iterations int, rate float64,
+    progress func(iter int, e float64)) float64 {
+    const beta1, beta2, epsilon = 0.9, 0.999, 1e-8
+    grad := make([][2]float64, len(t.params))
+    m := make([][2]float64, len(t.params))
+    v := make([][2]float64, len(t.params))
+    for iter := 1; iter <= iterations; iter++ {
+        e := t.gradient(k, grad)
+        if progress != nil {
+            progress(iter, e)
+        }
+        c1 := 1 - math.Pow(beta1, float64(iter))
+        c2 := 1 - math.Pow(beta2, float64(iter))
+        for i := range t.params {
+            for j := 0; j < 2; j++ {
+                g := grad[i][j]
+                m[i][j] = beta1*m[i][j] + (1-beta1)*g
+                v[i][j] = beta2*v[i][j] + (1-beta2)*g*g
+                t.params[i][j] -= rate * (m[i][j] / c1) /
+                    (math.Sqrt(v[i][j]/c2) + epsilon)
+            }
+        }
+    }
+    return t.gradient(k, nil)
+}
+
+// weights returns the current weights rounded to centipawns.
+func (t *tuner) weights() *chess.Weights {
+    w := chess.EvalWeights()
+    for i, p := range w.Params() {
+        p[0] = int(math.Floor(t.params[i][0] + 0.5))
+        p[1] = int(math.Floor(t.params[i][1] + 0.5))
+    }
+    return w
+}
+
+var rePair = regexp.MustCompile(`\[\s*(-?\d+),\s*(-?\d+)\s*\]`)
+
+// writeWeights stores w in JSON, using a single line for each pair of
+// middlegame and endgame values.
+func writeWeights(path string, w *chess.Weights) error {
+    data, err := json.MarshalIndent(w, "", "  ")
+    if err != nil {
+        return err
+    }
+    data = rePair.ReplaceAll(data, []byte("[$1, $2]"))
+    return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+var errEnough = errors.New("enough positions")
+
+func main() {
+    flag.Usage = func() {
+        fmt.Fprintf(os.Stderr, "usage: tune [flags] games.pgn...\n")
+        flag.PrintDefaults()
+    }
+    flag.Parse()
+    if flag.NArg() == 0 {
+        flag.Usage()
+        os.Exit(2)
+    }
+    runtime.GOMAXPROCS(runtime.NumCPU())
+
+    if *initial != "" {
+        f, err := os.Open(*initial)
+        if err != nil {
+            log.Fatal(err)
+        }
+        w, err := chess.ReadWeights(f)
+        f.Close()
+        if err != nil {
+            log.Fatalf("Couldn't read the weights: %v", err)
+        }
+        // the weights are used to find quiet positions as well
+        chess.SetEvalWeights(w)
+    }
+
+    var samples []sample
+    games := 0
+    for _, path := range flag.Args() {
+        f, err := os.Open(path)
+        if err != nil {
+            log.Fatal(err)
+        }
+        err = readPGN(f, func(g *game) error {
+            games++
+            samples = append(samples, extract(g, *skip)...)
+            if *maxPositions > 0 && len(samples) >= *maxPositions {
+                samples = samples[:*maxPositions]
+                return errEnough
+            }
+            return nil
+        })
+        f.Close()
+        if err == errEnough {
+            break
+        } else if err != nil {
+            log.Fatalf("%s: %v", path, err)
+        }
+    }
+    if len(samples) == 0 {
+        log.Fatal("No quiet positions found")
+    }
+    log.Printf("Read %d quiet positions from %d games", len(samples), games)
+
+    t := newTuner(samples, chess.EvalWeights())
+    k := *scale
+    if k <= 0 {
+        k = t.fitK()
+    }
+    log.Printf("K = %.4f, initial error %.6f", k, t.gradient(k, nil))
+    e := t.tune(k, *iterations, *rate, func(iter int, e float64) {
+        if iter%50 == 0 {
+            log.Printf("Iteration %d: error %.6f", iter, e)
+        }
+    })
+    log.Printf("Final error %.6f", e)
+
+    if err := writeWeights(*output, t.weights()); err != nil {
+        log.Fatal(err)
+    }
+}
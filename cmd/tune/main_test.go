@@ -0,0 +1,100 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package main
+
+import (
+    "github.com/tux21b/ChessBuddy/chess"
+    "io/ioutil"
+    "math"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func testSamples(t *testing.T) (samples []sample) {
+    readPGN(strings.NewReader(testPGN), func(g *game) error {
+        samples = append(samples, extract(g, 0)...)
+        return nil
+    })
+    if len(samples) == 0 {
+        t.Fatalf("no samples extracted")
+    }
+    return samples
+}
+
+func TestExtract(t *testing.T) {
+    terms := 0
+    for _, s := range testSamples(t) {
+        if s.result != 1 {
+            t.Errorf("unexpected sample %+v", s)
+        }
+        terms += len(s.terms)
+    }
+    if terms == 0 {
+        t.Errorf("all traces are empty")
+    }
+
+    g := &game{moves: strings.Fields("e4 d5 exd5 Qxd5"), result: "0-1"}
+    if samples := extract(g, 2); len(samples) != 1 {
+        t.Errorf("expected 1 quiet position, got %d", len(samples))
+    }
+}
+
+func TestEval(t *testing.T) {
+    tr := newTuner(nil, chess.EvalWeights())
+    b, _ := chess.ParseFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/" +
+        "PPPBBPPP/R3K2R w KQkq - 0 1")
+    s := newSample(b.EvalTrace(), 0.5)
+    if e := tr.eval(&s); math.Abs(e-float64(b.EvalBreakdown().Total)) > 6 {
+        t.Errorf("eval = %.1f, expected %d", e, b.EvalBreakdown().Total)
+    }
+}
+
+func TestTune(t *testing.T) {
+    tr := newTuner(testSamples(t), chess.EvalWeights())
+    k := tr.fitK()
+    if k <= 0.01 || k >= 10 {
+        t.Fatalf("unexpected scaling constant %f", k)
+    }
+    before := tr.gradient(k, nil)
+    if after := tr.tune(k, 20, 1, nil); after >= before {
+        t.Errorf("the error didn't decrease: %f -> %f", before, after)
+    }
+
+    // weights which aren't used stay the same
+    orig, w := chess.EvalWeights(), tr.weights()
+    if w.Material[chess.K] != orig.Material[chess.K] ||
+        w.PassedPawn[7] != orig.PassedPawn[7] {
+        t.Errorf("unused weights changed")
+    }
+}
+
+func TestWriteWeights(t *testing.T) {
+    dir, err := ioutil.TempDir("", "tune")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    path := filepath.Join(dir, "weights.json")
+
+    w := chess.EvalWeights()
+    w.Material[chess.N] = [2]int{-1, 2}
+    if err := writeWeights(path, w); err != nil {
+        t.Fatal(err)
+    }
+    f, err := os.Open(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    r, err := chess.ReadWeights(f)
+    if err != nil || *r != *w {
+        t.Errorf("couldn't read the weights back (%v)", err)
+    }
+    data, _ := ioutil.ReadFile(path)
+    if !strings.Contains(string(data), "[-1, 2]") {
+        t.Errorf("pairs aren't written on a single line")
+    }
+}
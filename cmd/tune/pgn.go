@@ -0,0 +1,117 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package main
+
+import (
+    "bufio"
+    "io"
+    "strings"
+)
+
+// A game is a single game read from a PGN file.
+type game struct {
+    fen    string   // start position or ""
+    moves  []string // all moves of the main line in SAN
+    result string   // "1-0", "0-1", "1/2-1/2" or "*"
+}
+
+// score returns the result of the game from white's point of view: 1 for
+// a win, 0.5 for a draw and 0 for a loss. Unfinished games return -1.
+func (g *game) score() float64 {
+    switch g.result {
+    case "1-0":
+        return 1
+    case "0-1":
+        return 0
+    case "1/2-1/2":
+        return 0.5
+    }
+    return -1
+}
+
+// readPGN reads games in the Portable Game Notation and calls f for each
+// of them. Comments, variations and numeric annotation glyphs are skipped.
+func readPGN(r io.Reader, f func(g *game) error) error {
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64*1024), 1<<20)
+    g := &game{}
+    comment, variation := false, 0
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if !comment && variation == 0 && strings.HasPrefix(line, "[") {
+            name, value := parseTag(line)
+            switch name {
+            case "FEN":
+                g.fen = value
+            case "Result":
+                g.result = value
+            }
+            continue
+        }
+
+        // strip comments and variations, which may span multiple lines
+        text := make([]byte, 0, len(line))
+    scan:
+        for i := 0; i < len(line); i++ {
+            c := line[i]
+            switch {
+            case comment:
+                comment = c != '}'
+            case c == '{':
+                comment = true
+            case c == ';':
+                break scan
+            case c == '(':
+                variation++
+            case c == ')':
+                variation--
+            case variation > 0:
+            case c == '.':
+                text = append(text, ' ')
+            default:
+                text = append(text, c)
+            }
+        }
+
+        for _, tok := range strings.Fields(string(text)) {
+            switch {
+            case tok == "1-0" || tok == "0-1" || tok == "1/2-1/2" || tok == "*":
+                if g.result == "" {
+                    g.result = tok
+                }
+                if err := f(g); err != nil {
+                    return err
+                }
+                g = &game{}
+            case tok[0] == '$' || strings.Trim(tok, "0123456789") == "":
+                // annotation glyphs and move numbers
+            default:
+                g.moves = append(g.moves, tok)
+            }
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return err
+    }
+    if len(g.moves) > 0 {
+        // the termination marker of the last game is missing
+        return f(g)
+    }
+    return nil
+}
+
+// parseTag splits a tag pair, e.g. [Result "1-0"].
+func parseTag(line string) (name, value string) {
+    line = strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+    i := strings.IndexByte(line, ' ')
+    if i < 0 {
+        return line, ""
+    }
+    value = strings.TrimSpace(line[i+1:])
+    if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+        value = value[1 : len(value)-1]
+    }
+    value = strings.Replace(value, "\\\"", "\"", -1)
+    return line[:i], value
+}
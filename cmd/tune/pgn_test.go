@@ -0,0 +1,66 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+const testPGN = `[Event "Casual Game"]
+[White "Anderssen, Adolf"]
+[Black "Kieseritzky, Lionel"]
+[Result "1-0"]
+
+1.e4 e5 2.f4 exf4 3.Bc4 Qh4+ 4.Kf1 b5?! {Bryan's counter-gambit, which
+is (nowadays) considered unsound} 5.Bxb5 Nf6 6.Nf3 Qh6 (6...Qh5 7.Nc3)
+7.d3 $1 Nh5 8.Nh4 ; the knight is heading to f5
+Qg5 9.Nf5 c6 1-0
+
+[Event "Second"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1"]
+[Result "*"]
+
+1. e4 Kd7 2. Kf2 1/2-1/2
+
+1. d4 d5
+`
+
+func TestReadPGN(t *testing.T) {
+    var games []*game
+    err := readPGN(strings.NewReader(testPGN), func(g *game) error {
+        games = append(games, g)
+        return nil
+    })
+    if err != nil || len(games) != 3 {
+        t.Fatalf("expected 3 games, got %d (%v)", len(games), err)
+    }
+
+    g := games[0]
+    if g.result != "1-0" || g.score() != 1 || g.fen != "" ||
+        strings.Join(g.moves, " ") != "e4 e5 f4 exf4 Bc4 Qh4+ Kf1 b5?! "+
+            "Bxb5 Nf6 Nf3 Qh6 d3 Nh5 Nh4 Qg5 Nf5 c6" {
+        t.Errorf("unexpected first game: %q %q", g.result, g.moves)
+    }
+
+    // the result tag takes precedence over the termination marker
+    g = games[1]
+    if g.result != "*" || g.score() >= 0 || len(g.moves) != 3 ||
+        g.fen != "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1" {
+        t.Errorf("unexpected second game: %q %q %q", g.fen, g.result, g.moves)
+    }
+
+    g = games[2]
+    if g.result != "" || len(g.moves) != 2 {
+        t.Errorf("unexpected last game: %q %q", g.result, g.moves)
+    }
+}
+
+func TestParseTag(t *testing.T) {
+    name, value := parseTag(`[Annotator "Steinitz, \"The Champion\""]`)
+    if name != "Annotator" || value != `Steinitz, "The Champion"` {
+        t.Errorf("parseTag = %q, %q", name, value)
+    }
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+// Package eco classifies chess openings according to the Encyclopaedia of
+// Chess Openings (ECO). The classification is done by comparing position
+// hashes, so that transpositions into known lines are recognized as well.
+package eco
+
+import (
+    "fmt"
+    "github.com/tux21b/ChessBuddy/chess"
+    "strings"
+)
+
+// An Opening identifies a named line from the ECO table.
+type Opening struct {
+    Code      string // ECO code, e.g. "C60"
+    Name      string // name of the opening, e.g. "Ruy Lopez"
+    Variation string // optional name of the variation
+}
+
+// String returns the name of the opening including the variation, if any.
+func (o *Opening) String() string {
+    if o.Variation == "" {
+        return o.Name
+    }
+    return o.Name + ", " + o.Variation
+}
+
+// positions maps the hash of the final position of each line in the table
+// to the corresponding opening.
+var positions = make(map[uint64]*Opening)
+
+// init replays all lines of the table and indexes their final positions.
+func init() {
+    for i := range table {
+        entry := &table[i]
+        b := chess.NewBoard()
+        for _, mv := range strings.Fields(entry.moves) {
+            if err := b.MoveSAN(mv); err != nil {
+                panic(fmt.Sprintf("eco: invalid line %s %q: %v",
+                    entry.Code, entry.moves, err))
+            }
+        }
+        if _, ok := positions[b.Hash()]; !ok {
+            positions[b.Hash()] = &entry.Opening
+        }
+    }
+}
+
+// Find returns the opening whose line ends in the current position of the
+// board b or nil if the position isn't contained in the table.
+func Find(b *chess.Board) *Opening {
+    return positions[b.Hash()]
+}
+
+// Classify replays a sequence of moves given in SAN from the initial
+// position and returns the last known opening which was reached on the way,
+// or nil if the game never reached a position from the table.
+func Classify(moves []string) (*Opening, error) {
+    var opening *Opening
+    b := chess.NewBoard()
+    for _, mv := range moves {
+        if err := b.MoveSAN(mv); err != nil {
+            return nil, err
+        }
+        if o := Find(b); o != nil {
+            opening = o
+        }
+    }
+    return opening, nil
+}
@@ -0,0 +1,44 @@
+package eco
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestClassify(t *testing.T) {
+    tests := []struct {
+        moves string
+        code  string
+        name  string
+    }{
+        {"", "", ""},
+        {"a3", "", ""},
+        {"e4 e5 Nf3 Nc6 Bb5 a6 Ba4 Nf6 O-O Be7 Re1", "C84", "Ruy Lopez, Closed Variations"},
+        {"e4 c5 Nf3 d6 d4 cxd4 Nxd4 Nf6 Nc3 a6 h3", "B90", "Sicilian Defense, Najdorf Variation"},
+        // transpositions
+        {"c4 e6 d4 Nf6 Nc3 Bb4", "E20", "Nimzo-Indian Defense"},
+        {"Nf3 d5 d4 Nf6 Bf4", "D02", "Queen's Pawn Game, London System"},
+        {"e4 d6 Nc3 Nf6 d4 g6", "B07", "Pirc Defense"},
+    }
+    for _, test := range tests {
+        o, err := Classify(strings.Fields(test.moves))
+        if err != nil {
+            t.Errorf("Classify(%q) failed: %v", test.moves, err)
+            continue
+        }
+        if test.code == "" {
+            if o != nil {
+                t.Errorf("Classify(%q) = %v, want nil", test.moves, o)
+            }
+            continue
+        }
+        if o == nil || o.Code != test.code || o.String() != test.name {
+            t.Errorf("Classify(%q) = %v, want %s %s", test.moves, o,
+                test.code, test.name)
+        }
+    }
+
+    if _, err := Classify([]string{"e4", "e4"}); err == nil {
+        t.Errorf("Classify should fail for illegal moves")
+    }
+}
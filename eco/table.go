@@ -0,0 +1,182 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package eco
+
+// entry describes a single line of the ECO table. The moves are given in
+// SAN, starting from the initial position.
+type entry struct {
+    Opening
+    moves string
+}
+
+// table contains the most common lines of the ECO classification. Lines are
+// sorted by their code. If multiple lines lead to the same position, the
+// first one wins.
+var table = []entry{
+    {Opening{"A00", "Polish Opening", ""}, "b4"},
+    {Opening{"A00", "Grob Opening", ""}, "g4"},
+    {Opening{"A00", "Hungarian Opening", ""}, "g3"},
+    {Opening{"A00", "Van't Kruijs Opening", ""}, "e3"},
+    {Opening{"A00", "Mieses Opening", ""}, "d3"},
+    {Opening{"A00", "Saragossa Opening", ""}, "c3"},
+    {Opening{"A00", "Clemenz Opening", ""}, "h3"},
+    {Opening{"A00", "Amar Opening", ""}, "Nh3"},
+    {Opening{"A00", "Van Geet Opening", ""}, "Nc3"},
+    {Opening{"A01", "Nimzo-Larsen Attack", ""}, "b3"},
+    {Opening{"A02", "Bird Opening", ""}, "f4"},
+    {Opening{"A02", "Bird Opening", "From's Gambit"}, "f4 e5"},
+    {Opening{"A03", "Bird Opening", "Dutch Variation"}, "f4 d5"},
+    {Opening{"A04", "Zukertort Opening", ""}, "Nf3"},
+    {Opening{"A04", "Zukertort Opening", "Sicilian Invitation"}, "Nf3 c5"},
+    {Opening{"A05", "Zukertort Opening", "Indian Defense"}, "Nf3 Nf6"},
+    {Opening{"A06", "Zukertort Opening", "Queen's Gambit Invitation"}, "Nf3 d5"},
+    {Opening{"A07", "King's Indian Attack", ""}, "Nf3 d5 g3"},
+    {Opening{"A09", "Reti Opening", ""}, "Nf3 d5 c4"},
+    {Opening{"A10", "English Opening", ""}, "c4"},
+    {Opening{"A13", "English Opening", "Agincourt Defense"}, "c4 e6"},
+    {Opening{"A15", "English Opening", "Anglo-Indian Defense"}, "c4 Nf6"},
+    {Opening{"A20", "English Opening", "King's English Variation"}, "c4 e5"},
+    {Opening{"A22", "English Opening", "King's English Variation, Two Knights Variation"}, "c4 e5 Nc3 Nf6"},
+    {Opening{"A25", "English Opening", "King's English Variation, Reversed Closed Sicilian"}, "c4 e5 Nc3 Nc6"},
+    {Opening{"A30", "English Opening", "Symmetrical Variation"}, "c4 c5"},
+    {Opening{"A40", "Queen's Pawn Game", ""}, "d4"},
+    {Opening{"A40", "Englund Gambit", ""}, "d4 e5"},
+    {Opening{"A40", "Modern Defense", ""}, "d4 g6"},
+    {Opening{"A43", "Benoni Defense", "Old Benoni"}, "d4 c5"},
+    {Opening{"A45", "Indian Defense", ""}, "d4 Nf6"},
+    {Opening{"A45", "Trompowsky Attack", ""}, "d4 Nf6 Bg5"},
+    {Opening{"A46", "Indian Defense", "Knights Variation"}, "d4 Nf6 Nf3"},
+    {Opening{"A50", "Indian Defense", "Normal Variation"}, "d4 Nf6 c4"},
+    {Opening{"A51", "Budapest Defense", ""}, "d4 Nf6 c4 e5"},
+    {Opening{"A53", "Old Indian Defense", ""}, "d4 Nf6 c4 d6"},
+    {Opening{"A56", "Benoni Defense", ""}, "d4 Nf6 c4 c5"},
+    {Opening{"A57", "Benko Gambit", ""}, "d4 Nf6 c4 c5 d5 b5"},
+    {Opening{"A60", "Benoni Defense", "Modern Variation"}, "d4 Nf6 c4 c5 d5 e6"},
+    {Opening{"A80", "Dutch Defense", ""}, "d4 f5"},
+
+    {Opening{"B00", "King's Pawn Game", ""}, "e4"},
+    {Opening{"B00", "Nimzowitsch Defense", ""}, "e4 Nc6"},
+    {Opening{"B00", "Owen Defense", ""}, "e4 b6"},
+    {Opening{"B01", "Scandinavian Defense", ""}, "e4 d5"},
+    {Opening{"B01", "Scandinavian Defense", "Mieses-Kotroc Variation"}, "e4 d5 exd5 Qxd5"},
+    {Opening{"B01", "Scandinavian Defense", "Modern Variation"}, "e4 d5 exd5 Nf6"},
+    {Opening{"B02", "Alekhine Defense", ""}, "e4 Nf6"},
+    {Opening{"B03", "Alekhine Defense", "Four Pawns Attack"}, "e4 Nf6 e5 Nd5 d4 d6 c4 Nb6 f4"},
+    {Opening{"B04", "Alekhine Defense", "Modern Variation"}, "e4 Nf6 e5 Nd5 d4 d6 Nf3"},
+    {Opening{"B06", "Modern Defense", ""}, "e4 g6"},
+    {Opening{"B07", "Pirc Defense", ""}, "e4 d6 d4 Nf6 Nc3 g6"},
+    {Opening{"B09", "Pirc Defense", "Austrian Attack"}, "e4 d6 d4 Nf6 Nc3 g6 f4"},
+    {Opening{"B10", "Caro-Kann Defense", ""}, "e4 c6"},
+    {Opening{"B12", "Caro-Kann Defense", "Advance Variation"}, "e4 c6 d4 d5 e5"},
+    {Opening{"B13", "Caro-Kann Defense", "Exchange Variation"}, "e4 c6 d4 d5 exd5 cxd5"},
+    {Opening{"B15", "Caro-Kann Defense", ""}, "e4 c6 d4 d5 Nc3"},
+    {Opening{"B18", "Caro-Kann Defense", "Classical Variation"}, "e4 c6 d4 d5 Nc3 dxe4 Nxe4 Bf5"},
+    {Opening{"B20", "Sicilian Defense", ""}, "e4 c5"},
+    {Opening{"B21", "Sicilian Defense", "Smith-Morra Gambit"}, "e4 c5 d4 cxd4 c3"},
+    {Opening{"B22", "Sicilian Defense", "Alapin Variation"}, "e4 c5 c3"},
+    {Opening{"B23", "Sicilian Defense", "Closed"}, "e4 c5 Nc3"},
+    {Opening{"B27", "Sicilian Defense", ""}, "e4 c5 Nf3"},
+    {Opening{"B30", "Sicilian Defense", "Old Sicilian"}, "e4 c5 Nf3 Nc6"},
+    {Opening{"B30", "Sicilian Defense", "Rossolimo Variation"}, "e4 c5 Nf3 Nc6 Bb5"},
+    {Opening{"B32", "Sicilian Defense", "Open"}, "e4 c5 Nf3 Nc6 d4 cxd4 Nxd4"},
+    {Opening{"B33", "Sicilian Defense", "Sveshnikov Variation"}, "e4 c5 Nf3 Nc6 d4 cxd4 Nxd4 Nf6 Nc3 e5"},
+    {Opening{"B34", "Sicilian Defense", "Accelerated Dragon"}, "e4 c5 Nf3 Nc6 d4 cxd4 Nxd4 g6"},
+    {Opening{"B40", "Sicilian Defense", "French Variation"}, "e4 c5 Nf3 e6"},
+    {Opening{"B41", "Sicilian Defense", "Kan Variation"}, "e4 c5 Nf3 e6 d4 cxd4 Nxd4 a6"},
+    {Opening{"B44", "Sicilian Defense", "Taimanov Variation"}, "e4 c5 Nf3 e6 d4 cxd4 Nxd4 Nc6"},
+    {Opening{"B50", "Sicilian Defense", "Modern Variations"}, "e4 c5 Nf3 d6"},
+    {Opening{"B51", "Sicilian Defense", "Moscow Variation"}, "e4 c5 Nf3 d6 Bb5+"},
+    {Opening{"B54", "Sicilian Defense", "Open"}, "e4 c5 Nf3 d6 d4 cxd4 Nxd4"},
+    {Opening{"B56", "Sicilian Defense", "Classical Variation"}, "e4 c5 Nf3 d6 d4 cxd4 Nxd4 Nf6 Nc3 Nc6"},
+    {Opening{"B70", "Sicilian Defense", "Dragon Variation"}, "e4 c5 Nf3 d6 d4 cxd4 Nxd4 Nf6 Nc3 g6"},
+    {Opening{"B76", "Sicilian Defense", "Dragon Variation, Yugoslav Attack"}, "e4 c5 Nf3 d6 d4 cxd4 Nxd4 Nf6 Nc3 g6 Be3 Bg7 f3"},
+    {Opening{"B80", "Sicilian Defense", "Scheveningen Variation"}, "e4 c5 Nf3 d6 d4 cxd4 Nxd4 Nf6 Nc3 e6"},
+    {Opening{"B90", "Sicilian Defense", "Najdorf Variation"}, "e4 c5 Nf3 d6 d4 cxd4 Nxd4 Nf6 Nc3 a6"},
+    {Opening{"B90", "Sicilian Defense", "Najdorf Variation, English Attack"}, "e4 c5 Nf3 d6 d4 cxd4 Nxd4 Nf6 Nc3 a6 Be3"},
+    {Opening{"B94", "Sicilian Defense", "Najdorf Variation, Main Line"}, "e4 c5 Nf3 d6 d4 cxd4 Nxd4 Nf6 Nc3 a6 Bg5"},
+
+    {Opening{"C00", "French Defense", ""}, "e4 e6"},
+    {Opening{"C01", "French Defense", "Exchange Variation"}, "e4 e6 d4 d5 exd5"},
+    {Opening{"C02", "French Defense", "Advance Variation"}, "e4 e6 d4 d5 e5"},
+    {Opening{"C03", "French Defense", "Tarrasch Variation"}, "e4 e6 d4 d5 Nd2"},
+    {Opening{"C10", "French Defense", "Paulsen Variation"}, "e4 e6 d4 d5 Nc3"},
+    {Opening{"C10", "French Defense", "Rubinstein Variation"}, "e4 e6 d4 d5 Nc3 dxe4"},
+    {Opening{"C11", "French Defense", "Classical Variation"}, "e4 e6 d4 d5 Nc3 Nf6"},
+    {Opening{"C15", "French Defense", "Winawer Variation"}, "e4 e6 d4 d5 Nc3 Bb4"},
+    {Opening{"C20", "King's Pawn Game", ""}, "e4 e5"},
+    {Opening{"C21", "Center Game", ""}, "e4 e5 d4 exd4"},
+    {Opening{"C21", "Danish Gambit", ""}, "e4 e5 d4 exd4 c3"},
+    {Opening{"C23", "Bishop's Opening", ""}, "e4 e5 Bc4"},
+    {Opening{"C25", "Vienna Game", ""}, "e4 e5 Nc3"},
+    {Opening{"C30", "King's Gambit", ""}, "e4 e5 f4"},
+    {Opening{"C30", "King's Gambit Declined", "Classical Variation"}, "e4 e5 f4 Bc5"},
+    {Opening{"C31", "King's Gambit Declined", "Falkbeer Countergambit"}, "e4 e5 f4 d5"},
+    {Opening{"C33", "King's Gambit Accepted", ""}, "e4 e5 f4 exf4"},
+    {Opening{"C40", "King's Knight Opening", ""}, "e4 e5 Nf3"},
+    {Opening{"C40", "Latvian Gambit", ""}, "e4 e5 Nf3 f5"},
+    {Opening{"C40", "Elephant Gambit", ""}, "e4 e5 Nf3 d5"},
+    {Opening{"C41", "Philidor Defense", ""}, "e4 e5 Nf3 d6"},
+    {Opening{"C42", "Petrov's Defense", ""}, "e4 e5 Nf3 Nf6"},
+    {Opening{"C43", "Petrov's Defense", "Modern Attack"}, "e4 e5 Nf3 Nf6 d4"},
+    {Opening{"C44", "King's Knight Opening", "Normal Variation"}, "e4 e5 Nf3 Nc6"},
+    {Opening{"C44", "Ponziani Opening", ""}, "e4 e5 Nf3 Nc6 c3"},
+    {Opening{"C44", "Scotch Game", ""}, "e4 e5 Nf3 Nc6 d4"},
+    {Opening{"C44", "Scotch Game", "Scotch Gambit"}, "e4 e5 Nf3 Nc6 d4 exd4 Bc4"},
+    {Opening{"C45", "Scotch Game", "Main Line"}, "e4 e5 Nf3 Nc6 d4 exd4 Nxd4"},
+    {Opening{"C46", "Three Knights Opening", ""}, "e4 e5 Nf3 Nc6 Nc3"},
+    {Opening{"C47", "Four Knights Game", ""}, "e4 e5 Nf3 Nc6 Nc3 Nf6"},
+    {Opening{"C48", "Four Knights Game", "Spanish Variation"}, "e4 e5 Nf3 Nc6 Nc3 Nf6 Bb5"},
+    {Opening{"C50", "Italian Game", ""}, "e4 e5 Nf3 Nc6 Bc4"},
+    {Opening{"C50", "Italian Game", "Hungarian Defense"}, "e4 e5 Nf3 Nc6 Bc4 Be7"},
+    {Opening{"C50", "Italian Game", "Giuoco Piano"}, "e4 e5 Nf3 Nc6 Bc4 Bc5"},
+    {Opening{"C50", "Italian Game", "Giuoco Pianissimo"}, "e4 e5 Nf3 Nc6 Bc4 Bc5 d3"},
+    {Opening{"C51", "Italian Game", "Evans Gambit"}, "e4 e5 Nf3 Nc6 Bc4 Bc5 b4"},
+    {Opening{"C53", "Italian Game", "Classical Variation"}, "e4 e5 Nf3 Nc6 Bc4 Bc5 c3"},
+    {Opening{"C55", "Italian Game", "Two Knights Defense"}, "e4 e5 Nf3 Nc6 Bc4 Nf6"},
+    {Opening{"C57", "Italian Game", "Two Knights Defense, Knight Attack"}, "e4 e5 Nf3 Nc6 Bc4 Nf6 Ng5"},
+    {Opening{"C57", "Italian Game", "Two Knights Defense, Fried Liver Attack"}, "e4 e5 Nf3 Nc6 Bc4 Nf6 Ng5 d5 exd5 Nxd5 Nxf7"},
+    {Opening{"C60", "Ruy Lopez", ""}, "e4 e5 Nf3 Nc6 Bb5"},
+    {Opening{"C62", "Ruy Lopez", "Steinitz Defense"}, "e4 e5 Nf3 Nc6 Bb5 d6"},
+    {Opening{"C63", "Ruy Lopez", "Schliemann Defense"}, "e4 e5 Nf3 Nc6 Bb5 f5"},
+    {Opening{"C65", "Ruy Lopez", "Berlin Defense"}, "e4 e5 Nf3 Nc6 Bb5 Nf6"},
+    {Opening{"C67", "Ruy Lopez", "Berlin Defense, Berlin Wall"}, "e4 e5 Nf3 Nc6 Bb5 Nf6 O-O Nxe4 d4 Nd6 Bxc6 dxc6 dxe5 Nf5 Qxd8+ Kxd8"},
+    {Opening{"C68", "Ruy Lopez", "Morphy Defense"}, "e4 e5 Nf3 Nc6 Bb5 a6"},
+    {Opening{"C68", "Ruy Lopez", "Exchange Variation"}, "e4 e5 Nf3 Nc6 Bb5 a6 Bxc6"},
+    {Opening{"C70", "Ruy Lopez", "Morphy Defense, Columbus Variation"}, "e4 e5 Nf3 Nc6 Bb5 a6 Ba4"},
+    {Opening{"C78", "Ruy Lopez", "Morphy Defense, Normal Variation"}, "e4 e5 Nf3 Nc6 Bb5 a6 Ba4 Nf6 O-O"},
+    {Opening{"C80", "Ruy Lopez", "Open Variation"}, "e4 e5 Nf3 Nc6 Bb5 a6 Ba4 Nf6 O-O Nxe4"},
+    {Opening{"C84", "Ruy Lopez", "Closed Variations"}, "e4 e5 Nf3 Nc6 Bb5 a6 Ba4 Nf6 O-O Be7"},
+    {Opening{"C88", "Ruy Lopez", "Closed"}, "e4 e5 Nf3 Nc6 Bb5 a6 Ba4 Nf6 O-O Be7 Re1 b5 Bb3"},
+    {Opening{"C89", "Ruy Lopez", "Marshall Attack"}, "e4 e5 Nf3 Nc6 Bb5 a6 Ba4 Nf6 O-O Be7 Re1 b5 Bb3 O-O c3 d5"},
+
+    {Opening{"D00", "Queen's Pawn Game", ""}, "d4 d5"},
+    {Opening{"D00", "Blackmar-Diemer Gambit", ""}, "d4 d5 e4"},
+    {Opening{"D02", "Queen's Pawn Game", "London System"}, "d4 d5 Nf3 Nf6 Bf4"},
+    {Opening{"D04", "Queen's Pawn Game", "Colle System"}, "d4 d5 Nf3 Nf6 e3"},
+    {Opening{"D06", "Queen's Gambit", ""}, "d4 d5 c4"},
+    {Opening{"D07", "Queen's Gambit Declined", "Chigorin Defense"}, "d4 d5 c4 Nc6"},
+    {Opening{"D08", "Queen's Gambit Declined", "Albin Countergambit"}, "d4 d5 c4 e5"},
+    {Opening{"D10", "Slav Defense", ""}, "d4 d5 c4 c6"},
+    {Opening{"D11", "Slav Defense", "Modern Line"}, "d4 d5 c4 c6 Nf3"},
+    {Opening{"D20", "Queen's Gambit Accepted", ""}, "d4 d5 c4 dxc4"},
+    {Opening{"D30", "Queen's Gambit Declined", ""}, "d4 d5 c4 e6"},
+    {Opening{"D32", "Tarrasch Defense", ""}, "d4 d5 c4 e6 Nc3 c5"},
+    {Opening{"D35", "Queen's Gambit Declined", "Exchange Variation"}, "d4 d5 c4 e6 Nc3 Nf6 cxd5 exd5"},
+    {Opening{"D43", "Semi-Slav Defense", ""}, "d4 d5 c4 e6 Nc3 Nf6 Nf3 c6"},
+    {Opening{"D80", "Grunfeld Defense", ""}, "d4 Nf6 c4 g6 Nc3 d5"},
+    {Opening{"D85", "Grunfeld Defense", "Exchange Variation"}, "d4 Nf6 c4 g6 Nc3 d5 cxd5 Nxd5 e4 Nxc3 bxc3"},
+
+    {Opening{"E01", "Catalan Opening", ""}, "d4 Nf6 c4 e6 g3"},
+    {Opening{"E11", "Bogo-Indian Defense", ""}, "d4 Nf6 c4 e6 Nf3 Bb4+"},
+    {Opening{"E12", "Queen's Indian Defense", ""}, "d4 Nf6 c4 e6 Nf3 b6"},
+    {Opening{"E20", "Nimzo-Indian Defense", ""}, "d4 Nf6 c4 e6 Nc3 Bb4"},
+    {Opening{"E32", "Nimzo-Indian Defense", "Classical Variation"}, "d4 Nf6 c4 e6 Nc3 Bb4 Qc2"},
+    {Opening{"E40", "Nimzo-Indian Defense", "Normal Variation"}, "d4 Nf6 c4 e6 Nc3 Bb4 e3"},
+    {Opening{"E60", "King's Indian Defense", ""}, "d4 Nf6 c4 g6"},
+    {Opening{"E62", "King's Indian Defense", "Fianchetto Variation"}, "d4 Nf6 c4 g6 Nf3 Bg7 g3"},
+    {Opening{"E70", "King's Indian Defense", "Normal Variation"}, "d4 Nf6 c4 g6 Nc3 Bg7 e4 d6"},
+    {Opening{"E76", "King's Indian Defense", "Four Pawns Attack"}, "d4 Nf6 c4 g6 Nc3 Bg7 e4 d6 f4"},
+    {Opening{"E80", "King's Indian Defense", "Samisch Variation"}, "d4 Nf6 c4 g6 Nc3 Bg7 e4 d6 f3"},
+    {Opening{"E97", "King's Indian Defense", "Mar del Plata Variation"}, "d4 Nf6 c4 g6 Nc3 Bg7 e4 d6 Nf3 O-O Be2 e5 O-O Nc6 d5 Ne7"},
+}
@@ -0,0 +1,207 @@
+// ChessBuddy - Play chess with Go, HTML5, WebSockets and random strangers!
+//
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package main
+
+import (
+    "github.com/tux21b/ChessBuddy/chess"
+    "image"
+    "image/color"
+    "image/gif"
+)
+
+// Size of a single square in pixels. The piece sprites are scaled up
+// accordingly.
+const squareSize = 48
+
+// Colors used for drawing boards. The index of each color is used directly
+// as value in paletted images.
+var palette = color.Palette{
+    color.RGBA{0xf0, 0xd9, 0xb5, 0xff}, // light square
+    color.RGBA{0xb5, 0x88, 0x63, 0xff}, // dark square
+    color.RGBA{0xf6, 0xeb, 0x72, 0xff}, // highlighted light square
+    color.RGBA{0xdc, 0xc3, 0x4b, 0xff}, // highlighted dark square
+    color.RGBA{0xff, 0xff, 0xff, 0xff}, // white pieces
+    color.RGBA{0x33, 0x33, 0x33, 0xff}, // black pieces
+    color.RGBA{0x00, 0x00, 0x00, 0xff}, // outlines
+}
+
+// sprites contains a small 16x16 pixel art image for each piece type. A '#'
+// marks the outline, 'o' the body of a piece and '.' transparent pixels.
+var sprites = [7][16]string{
+    chess.P: {
+        "................",
+        "................",
+        "................",
+        "......####......",
+        ".....#oooo#.....",
+        ".....#oooo#.....",
+        ".....#oooo#.....",
+        "......#oo#......",
+        ".....#oooo#.....",
+        "......#oo#......",
+        "......#oo#......",
+        ".....#oooo#.....",
+        "....#oooooo#....",
+        "...#oooooooo#...",
+        "...##########...",
+        "................",
+    },
+    chess.N: {
+        "................",
+        "................",
+        ".....##.#.......",
+        "....#oo#o#......",
+        "...#oooooo#.....",
+        "..#oo#ooooo#....",
+        "..#oooooooo#....",
+        "...##ooooooo#...",
+        ".....#oooooo#...",
+        "....#ooooooo#...",
+        "...#oooooooo#...",
+        "...#ooooooo#....",
+        "....#ooooo#.....",
+        "...#oooooooo#...",
+        "...##########...",
+        "................",
+    },
+    chess.B: {
+        "................",
+        ".......##.......",
+        "......#oo#......",
+        ".......##.......",
+        "......#oo#......",
+        ".....#oo#o#.....",
+        "....#oo#ooo#....",
+        "....#oooooo#....",
+        ".....#oooo#.....",
+        "......#oo#......",
+        ".....#oooo#.....",
+        "....#oooooo#....",
+        "....#oooooo#....",
+        "...#oooooooo#...",
+        "...##########...",
+        "................",
+    },
+    chess.R: {
+        "................",
+        "................",
+        "...##..##..##...",
+        "...#o##oo##o#...",
+        "...#oooooooo#...",
+        "....#oooooo#....",
+        ".....#oooo#.....",
+        ".....#oooo#.....",
+        ".....#oooo#.....",
+        ".....#oooo#.....",
+        ".....#oooo#.....",
+        "....#oooooo#....",
+        "...#oooooooo#...",
+        "...#oooooooo#...",
+        "...##########...",
+        "................",
+    },
+    chess.Q: {
+        "................",
+        "..#....##....#..",
+        "..#o#.#oo#.#o#..",
+        "..#oo#oooo#oo#..",
+        "..#oooooooooo#..",
+        "...#oooooooo#...",
+        "....#oooooo#....",
+        ".....#oooo#.....",
+        ".....#oooo#.....",
+        ".....#oooo#.....",
+        "....#oooooo#....",
+        "....#oooooo#....",
+        "...#oooooooo#...",
+        "...#oooooooo#...",
+        "...##########...",
+        "................",
+    },
+    chess.K: {
+        "................",
+        ".......##.......",
+        "......####......",
+        ".......##.......",
+        "...###.##.###...",
+        "..#ooo#oo#ooo#..",
+        "..#oooooooooo#..",
+        "..#oooooooooo#..",
+        "...#oooooooo#...",
+        "....#oooooo#....",
+        ".....#oooo#.....",
+        "....#oooooo#....",
+        "...#oooooooo#...",
+        "...#oooooooo#...",
+        "...##########...",
+        "................",
+    },
+}
+
+// drawBoard renders the position of the board b into a new paletted image.
+// Squares contained in the bitboard marked are highlighted, e.g. to show the
+// last move.
+func drawBoard(b *chess.Board, marked chess.Bitboard) *image.Paletted {
+    img := image.NewPaletted(image.Rect(0, 0, 8*squareSize, 8*squareSize), palette)
+    scale := squareSize / 16
+    for sq := chess.Square(0); sq < 64; sq++ {
+        x0, y0 := sq.File()*squareSize, (7-sq.Rank())*squareSize
+        bg := uint8(0)
+        if (sq.File()+sq.Rank())%2 == 0 {
+            bg = 1
+        }
+        if marked&(1<<uint(sq)) != 0 {
+            bg += 2
+        }
+        fill := uint8(4)
+        if b.Piece(sq)&chess.ColorMask == chess.Black {
+            fill = 5
+        }
+        sprite := sprites[b.Piece(sq)&chess.PieceMask]
+        for y := 0; y < squareSize; y++ {
+            for x := 0; x < squareSize; x++ {
+                c := bg
+                if row := sprite[y/scale]; len(row) > x/scale {
+                    switch row[x/scale] {
+                    case '#':
+                        c = 6
+                    case 'o':
+                        c = fill
+                    }
+                }
+                img.SetColorIndex(x0+x, y0+y, c)
+            }
+        }
+    }
+    return img
+}
+
+// drawGame replays a list of moves given in SAN and returns an animation
+// containing one frame for each position of the game. The squares which
+// were changed by the last move are highlighted.
+func drawGame(moves []string) (*gif.GIF, error) {
+    b := chess.NewBoard()
+    anim := &gif.GIF{
+        Image: []*image.Paletted{drawBoard(b, 0)},
+        Delay: []int{100},
+    }
+    for _, mv := range moves {
+        prev := *b
+        if err := b.MoveSAN(mv); err != nil {
+            return nil, err
+        }
+        marked := chess.Bitboard(0)
+        for sq := chess.Square(0); sq < 64; sq++ {
+            if prev.Piece(sq) != b.Piece(sq) {
+                marked |= 1 << uint(sq)
+            }
+        }
+        anim.Image = append(anim.Image, drawBoard(b, marked))
+        anim.Delay = append(anim.Delay, 100)
+    }
+    anim.Delay[len(anim.Delay)-1] = 500
+    return anim, nil
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package main
+
+import (
+    "bytes"
+    "github.com/tux21b/ChessBuddy/chess"
+    "image"
+    "image/color"
+    "image/gif"
+    "image/png"
+    "testing"
+)
+
+// squareColors counts how often each color of the palette is used in the
+// square sq of img.
+func squareColors(img image.Image, sq chess.Square) (counts [7]int) {
+    x0, y0 := sq.File()*squareSize, (7-sq.Rank())*squareSize
+    for y := y0; y < y0+squareSize; y++ {
+        for x := x0; x < x0+squareSize; x++ {
+            counts[palette.Index(img.At(x, y))]++
+        }
+    }
+    return
+}
+
+func sameColor(a, b color.Color) bool {
+    r1, g1, b1, a1 := a.RGBA()
+    r2, g2, b2, a2 := b.RGBA()
+    return r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
+}
+
+func TestDrawBoard(t *testing.T) {
+    b := chess.NewBoard()
+    b.MoveSAN("e4")
+    marked := chess.Bitboard(1<<uint(chess.Sq("e2")) | 1<<uint(chess.Sq("e4")))
+    var buf bytes.Buffer
+    if err := png.Encode(&buf, drawBoard(b, marked)); err != nil {
+        t.Fatal(err)
+    }
+    img, err := png.Decode(&buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if size := img.Bounds().Size(); size.X != 8*squareSize ||
+        size.Y != 8*squareSize {
+        t.Fatalf("unexpected image size %v", size)
+    }
+
+    tests := []struct {
+        sq         string
+        bg, pieces int // palette index of the background and piece color
+    }{
+        {"a1", 1, 4}, {"h1", 0, 4}, {"d4", 1, -1}, {"e2", 2, -1},
+        {"e4", 2, 4}, {"e8", 0, 5}, {"a7", 1, 5},
+    }
+    for _, test := range tests {
+        sq := chess.Sq(test.sq)
+        x0, y0 := sq.File()*squareSize, (7-sq.Rank())*squareSize
+        if !sameColor(img.At(x0, y0), palette[test.bg]) {
+            t.Errorf("%s: unexpected background %v", test.sq, img.At(x0, y0))
+        }
+        counts := squareColors(img, sq)
+        if test.pieces < 0 {
+            if counts[test.bg] != squareSize*squareSize {
+                t.Errorf("%s: expected an empty square, got %v", test.sq,
+                    counts)
+            }
+        } else if counts[test.pieces] == 0 || counts[6] == 0 ||
+            counts[9-test.pieces] != 0 {
+            t.Errorf("%s: expected a piece with color %d, got %v", test.sq,
+                test.pieces, counts)
+        }
+    }
+}
+
+func TestDrawGame(t *testing.T) {
+    anim, err := drawGame([]string{"e4", "e5", "Nf3"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    var buf bytes.Buffer
+    if err := gif.EncodeAll(&buf, anim); err != nil {
+        t.Fatal(err)
+    }
+    decoded, err := gif.DecodeAll(&buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(decoded.Image) != 4 || len(decoded.Delay) != 4 ||
+        decoded.Delay[0] != 100 || decoded.Delay[3] != 500 {
+        t.Fatalf("expected 4 frames, got %d with delays %v",
+            len(decoded.Image), decoded.Delay)
+    }
+
+    // the squares of the last move are highlighted in each frame
+    highlighted := [][]string{nil, {"e2", "e4"}, {"e7", "e5"}, {"g1", "f3"}}
+    for i, img := range decoded.Image {
+        n := 0
+        for sq := chess.Square(0); sq < 64; sq++ {
+            x0, y0 := sq.File()*squareSize, (7-sq.Rank())*squareSize
+            if palette.Index(img.At(x0, y0)) >= 2 {
+                n++
+            }
+        }
+        for _, name := range highlighted[i] {
+            sq := chess.Sq(name)
+            x0, y0 := sq.File()*squareSize, (7-sq.Rank())*squareSize
+            if palette.Index(img.At(x0, y0)) < 2 {
+                t.Errorf("frame %d: %s isn't highlighted", i, name)
+            }
+        }
+        if n != len(highlighted[i]) {
+            t.Errorf("frame %d: %d squares highlighted, want %d", i, n,
+                len(highlighted[i]))
+        }
+    }
+
+    if _, err := drawGame([]string{"e4", "e4"}); err == nil {
+        t.Errorf("expected an error for an illegal move")
+    }
+}
@@ -6,20 +6,34 @@
 package main
 
 import (
+    "bytes"
     "code.google.com/p/go.net/websocket"
+    "context"
     "expvar"
     "flag"
     "fmt"
     "github.com/tux21b/ChessBuddy/chess"
+    "github.com/tux21b/ChessBuddy/eco"
+    "github.com/tux21b/ChessBuddy/uci"
+    "github.com/tux21b/ChessBuddy/xboard"
     "go/build"
     "html/template"
+    "image/gif"
+    "image/png"
     "log"
     "math/rand"
     "net"
     "net/http"
+    "net/url"
+    "os"
+    "os/signal"
     "path/filepath"
     "runtime"
+    "strconv"
+    "strings"
+    "sync"
     "sync/atomic"
+    "syscall"
     "time"
 )
 
@@ -36,6 +50,12 @@ type Message struct {
     RemainingA, RemainingB time.Duration
     Text                   string
     Moves                  []chess.Square `json:"moves"`
+    Game                   int            `json:"game"`
+    Opening                string
+    Depth, Nodes           int
+    Score, Mate            int    // from the point of view of white
+    TB                     string // tablebase result, e.g. "1-0, DTZ 13"
+    PV                     string
 }
 
 type Player struct {
@@ -43,7 +63,19 @@ type Player struct {
     Color     uint8
     Remaining time.Duration
     Out       chan<- Message
-    ReqAI     chan bool
+    ReqAI     chan *Player
+    Notation  chess.Notation
+    Bot       string       // name of the AI player or ""
+    Engine    chess.Engine // engine which makes the moves of AI players
+    Gone      chan bool    // closed when the connection is lost
+    leave     sync.Once
+}
+
+// Leave marks the player as disconnected by closing Gone.
+func (p *Player) Leave() {
+    if p.Gone != nil {
+        p.leave.Do(func() { close(p.Gone) })
+    }
 }
 
 // Check wethever the player is still connected by sending a ping command.
@@ -68,12 +100,147 @@ func (p *Player) String() string {
     return "Unknown"
 }
 
+// Name returns the name of the player used in game records.
+func (p *Player) Name() string {
+    if p.Bot != "" {
+        return "ChessBuddy AI (" + p.Bot + ")"
+    }
+    return "Anonymous"
+}
+
 func (p *Player) Send(msg Message) {
     if p.Conn != nil {
         p.Out <- msg
     }
 }
 
+// Game records the moves of a running or finished game, so that it can be
+// exported even after both players have left.
+type Game struct {
+    ID           int
+    Date         time.Time
+    White, Black string
+
+    mu      sync.Mutex
+    moves   []string
+    opening *eco.Opening
+    result  string
+}
+
+// AddMove appends a half-move, formatted using SAN, to the game record. The
+// opening is updated if the resulting position is a known ECO line.
+func (g *Game) AddMove(san string, opening *eco.Opening) {
+    g.mu.Lock()
+    g.moves = append(g.moves, san)
+    if opening != nil {
+        g.opening = opening
+    }
+    g.mu.Unlock()
+}
+
+// Moves returns a copy of all half-moves played so far.
+func (g *Game) Moves() []string {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    return append([]string(nil), g.moves...)
+}
+
+// Opening returns the name of the last known opening reached in the game.
+func (g *Game) Opening() string {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    if g.opening == nil {
+        return ""
+    }
+    return g.opening.String()
+}
+
+// SetResult marks the game as finished. The result must be one of "1-0",
+// "0-1" or "1/2-1/2".
+func (g *Game) SetResult(result string) {
+    g.mu.Lock()
+    g.result = result
+    g.mu.Unlock()
+}
+
+// PGN formats the game record using the Portable Game Notation.
+func (g *Game) PGN() string {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    result := g.result
+    if result == "" {
+        result = "*"
+    }
+
+    buf := &bytes.Buffer{}
+    fmt.Fprintf(buf, "[Event \"ChessBuddy Game\"]\n")
+    fmt.Fprintf(buf, "[Site \"ChessBuddy\"]\n")
+    fmt.Fprintf(buf, "[Date \"%s\"]\n", g.Date.Format("2006.01.02"))
+    fmt.Fprintf(buf, "[Round \"-\"]\n")
+    fmt.Fprintf(buf, "[White \"%s\"]\n", g.White)
+    fmt.Fprintf(buf, "[Black \"%s\"]\n", g.Black)
+    fmt.Fprintf(buf, "[Result \"%s\"]\n", result)
+    if g.opening != nil {
+        fmt.Fprintf(buf, "[ECO \"%s\"]\n", g.opening.Code)
+        fmt.Fprintf(buf, "[Opening \"%s\"]\n", g.opening.Name)
+        if g.opening.Variation != "" {
+            fmt.Fprintf(buf, "[Variation \"%s\"]\n", g.opening.Variation)
+        }
+    }
+    buf.WriteByte('\n')
+
+    // wrap the move text at 80 characters
+    line, tokens := 0, append(append([]string(nil), g.moves...), result)
+    for i, mv := range tokens {
+        if strings.HasPrefix(mv, "0-0") {
+            mv = strings.Replace(mv, "0", "O", -1)
+        }
+        if i%2 == 0 && i < len(g.moves) {
+            mv = fmt.Sprintf("%d. %s", i/2+1, mv)
+        }
+        if line > 0 && line+len(mv) >= 80 {
+            buf.WriteByte('\n')
+            line = 0
+        } else if line > 0 {
+            buf.WriteByte(' ')
+            line++
+        }
+        buf.WriteString(mv)
+        line += len(mv)
+    }
+    buf.WriteByte('\n')
+    return buf.String()
+}
+
+// Maximal number of recent games which are kept in memory.
+const maxGames = 1000
+
+// Registry of recent games, indexed by their ID.
+var games = struct {
+    sync.RWMutex
+    m    map[int]*Game
+    last int
+}{m: make(map[int]*Game)}
+
+// newGame creates and registers a new game record. The oldest game is
+// dropped if there are more than maxGames games.
+func newGame() *Game {
+    games.Lock()
+    defer games.Unlock()
+    games.last++
+    g := &Game{ID: games.last, Date: time.Now()}
+    games.m[g.ID] = g
+    delete(games.m, g.ID-maxGames)
+    return g
+}
+
+// findGame returns the game record with the given ID or nil.
+func findGame(id int) *Game {
+    games.RLock()
+    defer games.RUnlock()
+    return games.m[id]
+}
+
 // Available Players which are currently looking for a taff opponent.
 var available = make(chan *Player, 100)
 
@@ -93,26 +260,41 @@ func hookUp() {
                 close(a.Out)
                 a = b
             }
-        case <-a.ReqAI:
-            go play(a, &Player{})
+        case ai := <-a.ReqAI:
+            go play(a, ai)
             a = <-available
         }
     }
 }
 
 func play(a, b *Player) {
+    // Once the game is over, both players may analyze it on their own.
+    board := chess.NewBoard()
     defer func() {
         if a.Conn != nil {
-            close(a.Out)
+            go analyze(a, board.Clone())
         }
         if b.Conn != nil {
-            close(b.Out)
+            go analyze(b, board.Clone())
         }
     }()
 
-    log.Println("Starting new game")
+    game := newGame()
+    log.Printf("Starting new game #%d", game.ID)
+
+    // Searches of AI players are cancelled as soon as the game ends, the
+    // opponent disconnects or the server shuts down.
+    ctx, cancel := context.WithCancel(serverCtx)
+    defer cancel()
+    go func() {
+        select {
+        case <-a.Gone:
+        case <-b.Gone:
+        case <-ctx.Done():
+        }
+        cancel()
+    }()
 
-    board := chess.NewBoard()
     if rand.Float32() > 0.5 {
         a, b = b, a
     }
@@ -121,23 +303,39 @@ func play(a, b *Player) {
     a.Remaining = *timeLimit
     b.Color = chess.Black
     b.Remaining = *timeLimit
+    game.White, game.Black = a.Name(), b.Name()
 
     a.Send(Message{Cmd: "start", Color: a.Color, Turn: board.Turn(),
-        RemainingA: a.Remaining, RemainingB: b.Remaining})
+        RemainingA: a.Remaining, RemainingB: b.Remaining, Game: game.ID})
     b.Send(Message{Cmd: "start", Color: b.Color, Turn: board.Turn(),
-        RemainingA: a.Remaining, RemainingB: b.Remaining})
+        RemainingA: a.Remaining, RemainingB: b.Remaining, Game: game.ID})
 
     start := time.Now()
     for {
         var msg Message
-        if a.Conn == nil {
-            msg.Cmd, msg.Turn = "move", board.Turn()
-            msg.Src, msg.Dst = board.MoveAI()
+        if a.Engine != nil {
+            m, _ := a.Engine.BestMove(ctx, board,
+                chess.SearchLimits{Time: a.Remaining, Threads: *aiThreads})
+            if !board.Legal(m) {
+                // the search was cancelled or e.g. an external engine has
+                // crashed, which counts as resignation
+                if ctx.Err() == nil {
+                    game.SetResult(result(b.Color))
+                    msg = Message{
+                        Cmd:  "msg",
+                        Text: fmt.Sprintf("The computer resigned: %v wins!", b),
+                    }
+                    b.Send(msg)
+                }
+                break
+            }
+            msg.Cmd, msg.Turn, msg.Src, msg.Dst = "move", board.Turn(), m.Src, m.Dst
         } else {
             a.Conn.SetReadDeadline(start.Add(a.Remaining))
             if err := websocket.JSON.Receive(a.Conn, &msg); err != nil {
                 if err, ok := err.(net.Error); ok && err.Timeout() {
                     a.Remaining = 0
+                    game.SetResult(result(b.Color))
                     msg = Message{
                         Cmd:  "msg",
                         Text: fmt.Sprintf("Out of time: %v wins!", b),
@@ -145,6 +343,8 @@ func play(a, b *Player) {
                     b.Send(msg)
                     a.Send(msg)
                 } else {
+                    a.Leave()
+                    game.SetResult(result(b.Color))
                     msg = Message{
                         Cmd:  "msg",
                         Text: "Opponent quit... Reload?",
@@ -159,6 +359,8 @@ func play(a, b *Player) {
             a.Color == board.Color() && board.Move(msg.Src, msg.Dst) {
             msg.Color = a.Color
             msg.History = board.LastMove()
+            game.AddMove(msg.History, eco.Find(board))
+            msg.Opening = game.Opening()
             now := time.Now()
             a.Remaining -= now.Sub(start)
             if a.Remaining <= 10*time.Millisecond {
@@ -170,10 +372,13 @@ func play(a, b *Player) {
                 msg.RemainingA, msg.RemainingB = b.Remaining, a.Remaining
             }
             a, b = b, a
+            msg.History = board.LastMoveIn(a.Notation)
             a.Send(msg)
+            msg.History = board.LastMoveIn(b.Notation)
             b.Send(msg)
 
             if board.Checkmate() {
+                game.SetResult(result(b.Color))
                 msg = Message{
                     Cmd:  "msg",
                     Text: fmt.Sprintf("Checkmate: %v wins!", b),
@@ -182,6 +387,7 @@ func play(a, b *Player) {
                 a.Send(msg)
                 return
             } else if board.Stalemate() {
+                game.SetResult("1/2-1/2")
                 msg = Message{
                     Cmd:  "msg",
                     Text: "Stalemate",
@@ -189,28 +395,287 @@ func play(a, b *Player) {
                 b.Send(msg)
                 a.Send(msg)
                 return
+            } else if wdl, ok := adjudicate(board); ok {
+                msg = Message{Cmd: "msg"}
+                switch wdl {
+                case chess.WDLWin:
+                    game.SetResult(result(a.Color))
+                    msg.Text = fmt.Sprintf("Tablebases: %v wins!", a)
+                case chess.WDLLoss:
+                    game.SetResult(result(b.Color))
+                    msg.Text = fmt.Sprintf("Tablebases: %v wins!", b)
+                default:
+                    game.SetResult("1/2-1/2")
+                    msg.Text = "Tablebases: Draw"
+                }
+                b.Send(msg)
+                a.Send(msg)
+                return
             }
         } else if msg.Cmd == "select" {
             msg.Moves = board.Moves(msg.Src)
             a.Send(msg)
         }
+        // "analyze" commands are ignored, the engine must not help the
+        // players during a game
+    }
+}
+
+// adjudicate looks up the position of board in the endgame tablebases.
+// The result is given from the point of view of the player to move and
+// takes the fifty-move rule into account, i.e. it's either a win, a loss
+// or a draw.
+func adjudicate(board *chess.Board) (chess.WDL, bool) {
+    wdl, err := chess.ProbeWDL(board)
+    if err != nil {
+        return chess.WDLDraw, false
+    }
+    dtz, err := chess.ProbeDTZ(board)
+    if err != nil {
+        return chess.WDLDraw, false
+    }
+    switch clock := board.HalfMoveClock(); {
+    case wdl == chess.WDLWin && dtz+clock <= 100:
+        return chess.WDLWin, true
+    case wdl == chess.WDLLoss && clock-dtz <= 100:
+        return chess.WDLLoss, true
+    }
+    return chess.WDLDraw, true
+}
+
+// analyze lets the player examine the position of board, either on the
+// analysis page or after a game has finished. Moves can be made for both
+// sides and the "analyze" and "stop" commands control an engine, which
+// streams its results as "info" messages. The session ends when the
+// connection is lost.
+func analyze(p *Player, board *chess.Board) {
+    defer close(p.Out)
+    var stop func()
+    defer func() {
+        if stop != nil {
+            stop()
+        }
+    }()
+
+    p.Send(Message{Cmd: "analysis", Color: p.Color, Turn: board.Turn()})
+    p.Conn.SetReadDeadline(time.Time{})
+    for {
+        var msg Message
+        if err := websocket.JSON.Receive(p.Conn, &msg); err != nil {
+            p.Leave()
+            return
+        }
+        switch msg.Cmd {
+        case "analyze":
+            if stop != nil {
+                stop()
+            }
+            stop = startAnalysis(p, board.Clone())
+        case "stop":
+            if stop != nil {
+                stop()
+                stop = nil
+            }
+        case "move":
+            color := board.Color()
+            if msg.Turn != board.Turn() || !board.Move(msg.Src, msg.Dst) {
+                continue
+            }
+            msg.Color = color
+            msg.History = board.LastMoveIn(p.Notation)
+            if opening := eco.Find(board); opening != nil {
+                msg.Opening = opening.String()
+            }
+            p.Send(msg)
+            if stop != nil {
+                stop()
+                stop = startAnalysis(p, board.Clone())
+            }
+        case "select":
+            msg.Moves = board.Moves(msg.Src)
+            p.Send(msg)
+        }
+    }
+}
+
+// startAnalysis runs the default engine on the position of b in the
+// background and sends its results to the player. The returned function
+// stops the engine and waits until it has finished. Each analysis uses a
+// single thread and the player is told to try again later if too many
+// analyses are already running.
+func startAnalysis(p *Player, b *chess.Board) (stop func()) {
+    select {
+    case analysisSlots <- true:
+    default:
+        p.Send(Message{Cmd: "info", Turn: b.Turn(),
+            Text: "The server is busy, please try again later."})
+        return func() {}
+    }
+    ctx, cancel := context.WithTimeout(serverCtx, *analysisTime)
+    done := make(chan bool)
+    progress := func(info chess.Info) {
+        msg := Message{Cmd: "info", Turn: b.Turn(), Depth: info.Depth,
+            Nodes: info.Nodes, Score: info.Score, Mate: info.Mate,
+            PV: formatPV(b, info.PV, p.Notation)}
+        if b.Color() == chess.Black {
+            msg.Score, msg.Mate = -msg.Score, -msg.Mate
+        }
+        if info.TB {
+            msg.TB = tablebaseResult(info, b.Color())
+        }
+        select {
+        case p.Out <- msg:
+        case <-ctx.Done():
+        }
+    }
+    go func() {
+        defer close(done)
+        defer func() { <-analysisSlots }()
+        chess.SearchEngine{}.Analyze(ctx, b, chess.SearchLimits{
+            Infinite: true, Threads: 1, Progress: progress})
+    }()
+    return func() {
+        cancel()
+        <-done
+    }
+}
+
+// tablebaseResult formats the tablebase result of info for the analysis
+// of a position with the given player to move.
+func tablebaseResult(info chess.Info, color uint8) string {
+    dtz := info.DTZ
+    if dtz < 0 {
+        dtz = -dtz
+    }
+    switch {
+    case info.WDL == chess.WDLWin:
+        return fmt.Sprintf("%s, DTZ %d", result(color), dtz)
+    case info.WDL == chess.WDLLoss:
+        return fmt.Sprintf("%s, DTZ %d", result(color^chess.ColorMask), dtz)
+    }
+    return "1/2-1/2"
+}
+
+// formatPV formats the moves of a principal variation starting at the
+// position of b using the notation n.
+func formatPV(b *chess.Board, pv []chess.Move, n chess.Notation) string {
+    b = b.Clone()
+    moves := make([]string, 0, len(pv))
+    for _, m := range pv {
+        if !b.Move(m.Src, m.Dst) {
+            break
+        }
+        moves = append(moves, b.LastMoveIn(n))
+    }
+    return strings.Join(moves, " ")
+}
+
+// result returns the PGN result of a game won by the given color.
+func result(winner uint8) string {
+    if winner == chess.White {
+        return "1-0"
+    }
+    return "0-1"
+}
+
+// newAI creates an AI player. The engine is selected by the "bot" parameter
+// and its strength is limited by the "level" parameter of the request.
+func newAI(r *http.Request) *Player {
+    bot := r.FormValue("bot")
+    engine, ok := chess.Engines[bot]
+    if !ok {
+        bot, engine = chess.DefaultEngine, chess.Engines[chess.DefaultEngine]
+    }
+    level, err := strconv.Atoi(r.FormValue("level"))
+    if err == nil && level >= 1 && level <= chess.MaxLevel &&
+        bot == chess.DefaultEngine {
+        bot, engine = fmt.Sprintf("level %d", level), chess.LevelEngine(level)
     }
+    if book != nil && bot != "random" {
+        engine = chess.BookEngine{Book: book, Engine: engine}
+    }
+    return &Player{Bot: bot, Engine: engine}
 }
 
 // Serve the index page.
 func handleIndex(w http.ResponseWriter, r *http.Request) {
-    wsURL := fmt.Sprintf("ws://%s/ws", r.Host)
+    wsURL, query := fmt.Sprintf("ws://%s/ws", r.Host), url.Values{}
     if r.URL.Path == "/ai" {
-        wsURL += "?ai=true"
+        query.Set("ai", "true")
+        if bot := r.FormValue("bot"); bot != "" {
+            query.Set("bot", bot)
+        }
+        if level := r.FormValue("level"); level != "" {
+            query.Set("level", level)
+        }
+    } else if r.URL.Path == "/analysis" {
+        query.Set("analysis", "true")
     } else if r.URL.Path != "/" {
         http.Error(w, "Not Found", http.StatusNotFound)
         return
     }
+    if notation := r.FormValue("notation"); notation != "" {
+        query.Set("notation", notation)
+    }
+    if len(query) > 0 {
+        wsURL += "?" + query.Encode()
+    }
     if err := tmpl.Execute(w, wsURL); err != nil {
         log.Printf("tmpl.Execute: %v", err)
     }
 }
 
+// Serve a PNG image of a position given in FEN, e.g. /img/8/8/8/4k3/8/8/8/4K3.png.
+// Spaces between the FEN fields can be replaced by underscores.
+func handleImage(w http.ResponseWriter, r *http.Request) {
+    fen := strings.TrimPrefix(r.URL.Path, "/img/")
+    if !strings.HasSuffix(fen, ".png") {
+        http.Error(w, "Not Found", http.StatusNotFound)
+        return
+    }
+    fen = strings.Replace(strings.TrimSuffix(fen, ".png"), "_", " ", -1)
+    board, err := chess.ParseFEN(fen)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    w.Header().Set("Content-Type", "image/png")
+    if err := png.Encode(w, drawBoard(board, 0)); err != nil {
+        log.Printf("png.Encode: %v", err)
+    }
+}
+
+// Serve a game record, either as animated GIF image (e.g. /game/42.gif) or
+// using the Portable Game Notation (e.g. /game/42.pgn).
+func handleGame(w http.ResponseWriter, r *http.Request) {
+    name := strings.TrimPrefix(r.URL.Path, "/game/")
+    ext := filepath.Ext(name)
+    id, err := strconv.Atoi(strings.TrimSuffix(name, ext))
+    game := findGame(id)
+    if err != nil || game == nil {
+        http.Error(w, "Not Found", http.StatusNotFound)
+        return
+    }
+    switch ext {
+    case ".gif":
+        anim, err := drawGame(game.Moves())
+        if err != nil {
+            log.Printf("drawGame: %v", err)
+            http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+            return
+        }
+        w.Header().Set("Content-Type", "image/gif")
+        if err := gif.EncodeAll(w, anim); err != nil {
+            log.Printf("gif.EncodeAll: %v", err)
+        }
+    case ".pgn":
+        w.Header().Set("Content-Type", "application/x-chess-pgn")
+        fmt.Fprint(w, game.PGN())
+    default:
+        http.Error(w, "Not Found", http.StatusNotFound)
+    }
+}
+
 // Serve a static file (e.g. style sheets, scripts or images).
 func handleFile(path string) http.HandlerFunc {
     path = filepath.Join(root, path)
@@ -223,8 +688,16 @@ func handleWS(ws *websocket.Conn) {
     log.Println("Connected:", ws.Request().RemoteAddr)
     atomic.AddInt32(&numPlayers, 1)
     exitStat := make(chan bool, 1)
+    notation, ok := chess.Notations[ws.Request().FormValue("notation")]
+    if !ok {
+        notation = chess.SAN
+    }
+    out := make(chan Message, 1)
+    p := &Player{Conn: ws, Out: out, Notation: notation,
+        Gone: make(chan bool)}
 
     defer func() {
+        p.Leave()
         exitStat <- true
         atomic.AddInt32(&numPlayers, -1)
         log.Println("Disconnected", ws.Request().RemoteAddr)
@@ -244,6 +717,7 @@ func handleWS(ws *websocket.Conn) {
                 if nerr, ok := err.(net.Error); ok && !nerr.Temporary() {
                     log.Printf("Network Error: %v", nerr)
                     ws.Close()
+                    p.Leave()
                     return
                 }
             }
@@ -256,14 +730,21 @@ func handleWS(ws *websocket.Conn) {
         }
     }()
 
-    // Add the player to the pool of available players so that he can get
-    // hooked up
-    reqAI := make(chan bool, 1)
-    if ws.Request().FormValue("ai") == "true" {
-        reqAI <- true
+    if ws.Request().FormValue("analysis") == "true" {
+        // analyze positions without an opponent
+        board := chess.NewBoard()
+        p.Color = chess.White
+        p.Send(Message{Cmd: "start", Color: p.Color, Turn: board.Turn()})
+        go analyze(p, board)
+    } else {
+        // Add the player to the pool of available players so that he can
+        // get hooked up
+        p.ReqAI = make(chan *Player, 1)
+        if ws.Request().FormValue("ai") == "true" {
+            p.ReqAI <- newAI(ws.Request())
+        }
+        available <- p
     }
-    out := make(chan Message, 1)
-    available <- &Player{Conn: ws, Out: out, ReqAI: reqAI}
 
     // Send the move commands from the game asynchronously, so that a slow
     // internet connection can not be simulated to use up the opponents
@@ -285,6 +766,37 @@ var timeLimit *time.Duration = flag.Duration("time", 5*time.Minute,
     "time limit per side (sudden death, no add)")
 var listenAddr *string = flag.String("http", ":8000",
     "listen on this http address")
+var hashSize *int = flag.Int("hash", 16,
+    "size of the transposition table used by the AI in MB")
+var aiThreads *int = flag.Int("threads", runtime.NumCPU(),
+    "number of goroutines used by each AI search")
+var bookFile *string = flag.String("book", "",
+    "opening book for the AI in the Polyglot format")
+var weightsFile *string = flag.String("weights", "",
+    "evaluation weights written by the tune command")
+var uciEngine *string = flag.String("uci", "",
+    "external UCI engine offered as AI opponent, e.g. /usr/bin/stockfish")
+var uciProcs *int = flag.Int("uciprocs", 4,
+    "maximum number of processes of the external UCI engine")
+var xboardEngine *string = flag.String("xboard", "",
+    "external XBoard engine offered as AI opponent, e.g. /usr/games/gnuchess")
+var xboardProcs *int = flag.Int("xboardprocs", 4,
+    "maximum number of processes of the external XBoard engine")
+var syzygyPath *string = flag.String("syzygy", "",
+    "directories containing Syzygy endgame tablebases")
+var analysisTime *time.Duration = flag.Duration("analysis", 5*time.Minute,
+    "maximum duration of a single engine analysis")
+var maxAnalyses *int = flag.Int("analyses", 2,
+    "maximum number of engine analyses running at the same time")
+
+// Opening book used by AI players or nil.
+var book *chess.Book
+
+// analysisSlots limits the number of running analyses to -analyses.
+var analysisSlots chan bool
+
+// serverCtx is cancelled when the server shuts down.
+var serverCtx, shutdown = context.WithCancel(context.Background())
 
 func main() {
     runtime.GOMAXPROCS(runtime.NumCPU())
@@ -294,6 +806,52 @@ func main() {
         flag.Usage()
         return
     }
+    chess.SetHashSize(*hashSize)
+    analysisSlots = make(chan bool, *maxAnalyses)
+    if *weightsFile != "" {
+        f, err := os.Open(*weightsFile)
+        if err != nil {
+            log.Fatalf("Couldn't open the evaluation weights: %v", err)
+        }
+        w, err := chess.ReadWeights(f)
+        f.Close()
+        if err != nil {
+            log.Fatalf("Couldn't read the evaluation weights: %v", err)
+        }
+        chess.SetEvalWeights(w)
+    }
+    if *syzygyPath != "" {
+        if err := chess.SetSyzygyPath(*syzygyPath); err != nil {
+            log.Fatalf("Couldn't load the endgame tablebases: %v", err)
+        }
+    }
+    if *bookFile != "" {
+        f, err := os.Open(*bookFile)
+        if err != nil {
+            log.Fatalf("Couldn't open the opening book: %v", err)
+        }
+        book, err = chess.ReadBook(f)
+        f.Close()
+        if err != nil {
+            log.Fatalf("Couldn't read the opening book: %v", err)
+        }
+    }
+
+    if *uciEngine != "" {
+        // the engine is selected by the name of its executable
+        engine := uci.NewPool(*uciProcs, nil, *uciEngine)
+        name := strings.TrimSuffix(filepath.Base(*uciEngine),
+            filepath.Ext(*uciEngine))
+        chess.Engines[name] = engine
+        defer engine.Close()
+    }
+    if *xboardEngine != "" {
+        engine := xboard.NewPool(*xboardProcs, *xboardEngine)
+        name := strings.TrimSuffix(filepath.Base(*xboardEngine),
+            filepath.Ext(*xboardEngine))
+        chess.Engines[name] = engine
+        defer engine.Close()
+    }
 
     expvar.Publish("numplayers", expvar.Func(func() interface{} {
         return atomic.LoadInt32(&numPlayers)
@@ -317,9 +875,22 @@ func main() {
     http.HandleFunc("/chess.css", handleFile("chess.css"))
     http.HandleFunc("/bg.png", handleFile("bg.png"))
     http.HandleFunc("/favicon.ico", handleFile("favicon.ico"))
+    http.HandleFunc("/img/", handleImage)
+    http.HandleFunc("/game/", handleGame)
     http.Handle("/ws", websocket.Handler(handleWS))
 
-    if err := http.ListenAndServe(*listenAddr, nil); err != nil {
+    // stop all running games and searches on SIGINT or SIGTERM
+    srv := &http.Server{Addr: *listenAddr}
+    go func() {
+        sig := make(chan os.Signal, 1)
+        signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+        <-sig
+        log.Println("Shutting down")
+        shutdown()
+        srv.Close()
+    }()
+
+    if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
         log.Fatalf("http.ListenAndServe: %v", err)
     }
 }
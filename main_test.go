@@ -0,0 +1,73 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package main
+
+import (
+    "context"
+    "github.com/tux21b/ChessBuddy/chess"
+    "testing"
+    "time"
+)
+
+// cancelledEngine waits until the search is cancelled and returns no move,
+// like an engine pool without free processes.
+type cancelledEngine struct{}
+
+func (cancelledEngine) BestMove(ctx context.Context, b *chess.Board,
+    limits chess.SearchLimits) (chess.Move, chess.Info) {
+    <-ctx.Done()
+    return chess.Move{Src: -1, Dst: -1}, chess.Info{}
+}
+
+func TestPlayOpponentGone(t *testing.T) {
+    gone := make(chan bool)
+    close(gone)
+    a := &Player{Bot: "a", Engine: cancelledEngine{}, Gone: gone}
+    b := &Player{Bot: "b", Engine: cancelledEngine{}}
+    done := make(chan bool)
+    go func() {
+        play(a, b)
+        close(done)
+    }()
+    select {
+    case <-done:
+    case <-time.After(5 * time.Second):
+        t.Fatal("play didn't return after the opponent left")
+    }
+}
+
+func TestPlayerLeave(t *testing.T) {
+    p := &Player{Gone: make(chan bool)}
+    p.Leave()
+    p.Leave()
+    select {
+    case <-p.Gone:
+    default:
+        t.Errorf("Gone wasn't closed")
+    }
+    (&Player{}).Leave()
+}
+
+func TestAnalysisLimit(t *testing.T) {
+    analysisSlots = make(chan bool, 1)
+    defer func() { analysisSlots = nil }()
+    out := make(chan Message)
+    go func() {
+        for _ = range out {
+        }
+    }()
+    defer close(out)
+    p := &Player{Out: out}
+    b, _ := chess.ParseFEN("4k3/8/8/3q4/4P3/8/8/4K3 w - - 0 1")
+    stop := startAnalysis(p, b)
+    startAnalysis(p, b)()
+    if len(analysisSlots) != 1 {
+        t.Errorf("%d analyses are running, want 1", len(analysisSlots))
+    }
+    stop()
+    if len(analysisSlots) != 0 {
+        t.Errorf("the analysis didn't release its slot")
+    }
+    startAnalysis(p, b)()
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package pool
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "io"
+    "os/exec"
+    "time"
+)
+
+// ErrExited is returned if the engine process has terminated.
+var ErrExited = errors.New("pool: engine exited")
+
+// ResponseTimeout is the time an engine may take to answer commands which
+// don't require a search, to move after it has been asked to stop and to
+// quit.
+var ResponseTimeout = 10 * time.Second
+
+// A Cmd is a running engine executable, which is controlled by writing
+// commands to its standard input and reading its output line by line. The
+// protocol itself, e.g. UCI or CECP, is up to the caller. A Cmd must not be
+// used by multiple goroutines at once.
+type Cmd struct {
+    Lines <-chan string // output of the engine, closed on exit
+
+    cmd *exec.Cmd
+    in  io.WriteCloser
+    err error // the first fatal error
+}
+
+// Command starts the engine executable.
+func Command(path string, args ...string) (*Cmd, error) {
+    cmd := exec.Command(path, args...)
+    in, err := cmd.StdinPipe()
+    if err != nil {
+        return nil, err
+    }
+    out, err := cmd.StdoutPipe()
+    if err != nil {
+        return nil, err
+    }
+    if err := cmd.Start(); err != nil {
+        return nil, err
+    }
+    lines := make(chan string, 64)
+    go func() {
+        scanner := bufio.NewScanner(out)
+        for scanner.Scan() {
+            lines <- scanner.Text()
+        }
+        close(lines)
+    }()
+    return &Cmd{Lines: lines, cmd: cmd, in: in}, nil
+}
+
+// Err returns the error which made the engine unusable or nil.
+func (c *Cmd) Err() error {
+    return c.err
+}
+
+// Fail marks the engine as unusable, unless it has failed before.
+func (c *Cmd) Fail(err error) {
+    if c.err == nil {
+        c.err = err
+    }
+}
+
+// Send writes a command to the engine. Nothing is sent after the engine
+// has failed.
+func (c *Cmd) Send(format string, args ...interface{}) {
+    if c.err != nil {
+        return
+    }
+    if _, err := fmt.Fprintf(c.in, format+"\n", args...); err != nil {
+        c.err = err
+    }
+}
+
+// Kill terminates the engine immediately.
+func (c *Cmd) Kill() {
+    c.cmd.Process.Kill()
+}
+
+// Close asks the engine to quit and kills it, if it doesn't terminate in
+// time.
+func (c *Cmd) Close() error {
+    c.Send("quit")
+    c.in.Close()
+    exited := make(chan error, 1)
+    go func() {
+        exited <- c.cmd.Wait()
+    }()
+    select {
+    case err := <-exited:
+        return err
+    case <-time.After(ResponseTimeout):
+        c.cmd.Process.Kill()
+        return <-exited
+    }
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package pool
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "os"
+    "testing"
+    "time"
+)
+
+// TestHelperProcess isn't a real test. It's started as a subprocess by the
+// other tests and echoes all commands until "quit", or ignores "quit" if
+// the mode argument is "stubborn".
+func TestHelperProcess(t *testing.T) {
+    args := os.Args
+    for len(args) > 0 && args[0] != "--" {
+        args = args[1:]
+    }
+    if len(args) < 2 {
+        return
+    }
+    scanner := bufio.NewScanner(os.Stdin)
+    for scanner.Scan() {
+        if scanner.Text() == "quit" && args[1] != "stubborn" {
+            break
+        }
+        fmt.Println(scanner.Text())
+    }
+    if args[1] == "stubborn" {
+        time.Sleep(time.Minute)
+    }
+    os.Exit(0)
+}
+
+func startEcho(t *testing.T, mode string) *Cmd {
+    c, err := Command(os.Args[0], "-test.run=^TestHelperProcess$", "--", mode)
+    if err != nil {
+        t.Fatalf("couldn't start the helper process: %v", err)
+    }
+    return c
+}
+
+func TestCmd(t *testing.T) {
+    c := startEcho(t, "echo")
+    c.Send("go depth %d", 3)
+    select {
+    case line := <-c.Lines:
+        if line != "go depth 3" {
+            t.Errorf("expected %q, got %q", "go depth 3", line)
+        }
+    case <-time.After(10 * time.Second):
+        t.Fatalf("no response")
+    }
+    failed := errors.New("failed")
+    c.Fail(failed)
+    c.Fail(ErrExited)
+    if c.Err() != failed {
+        t.Errorf("expected the first error, got %v", c.Err())
+    }
+    // nothing is sent after a failure, not even "quit"
+    done := make(chan error, 1)
+    go func() { done <- c.Close() }()
+    select {
+    case <-done:
+    case <-time.After(10 * time.Second):
+        t.Fatalf("Close didn't return")
+    }
+    if _, ok := <-c.Lines; ok {
+        t.Errorf("expected no further output")
+    }
+}
+
+func TestCmdClose(t *testing.T) {
+    c := startEcho(t, "echo")
+    if err := c.Close(); err != nil {
+        t.Errorf("Close failed: %v", err)
+    }
+
+    defer func(d time.Duration) { ResponseTimeout = d }(ResponseTimeout)
+    ResponseTimeout = 200 * time.Millisecond
+    c = startEcho(t, "stubborn")
+    start := time.Now()
+    if err := c.Close(); err == nil {
+        t.Errorf("expected an error for a killed process")
+    }
+    if d := time.Since(start); d > 5*time.Second {
+        t.Errorf("Close took %v", d)
+    }
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+// Package guitest lets tests talk to an engine session like a chess GUI,
+// e.g. to the UCI or XBoard sessions of the ChessBuddy commands.
+package guitest
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "strings"
+    "testing"
+    "time"
+)
+
+// Timeout is the time a session may take to send an expected line or to
+// terminate.
+var Timeout = 10 * time.Second
+
+// A Session runs in the background and reads its commands from a pipe.
+type Session struct {
+    Lines <-chan string // output of the session, closed when it ends
+
+    t    *testing.T
+    in   *io.PipeWriter
+    done chan error
+}
+
+// Start runs the session in the background. The session reads its
+// commands from r and writes its output to w until it returns.
+func Start(t *testing.T, run func(r io.Reader, w io.Writer) error) *Session {
+    inR, inW := io.Pipe()
+    outR, outW := io.Pipe()
+    lines := make(chan string, 1000)
+    s := &Session{Lines: lines, t: t, in: inW, done: make(chan error, 1)}
+    go func() {
+        s.done <- run(inR, outW)
+        outW.Close()
+    }()
+    go func() {
+        scanner := bufio.NewScanner(outR)
+        for scanner.Scan() {
+            lines <- scanner.Text()
+        }
+        close(lines)
+    }()
+    return s
+}
+
+// Send writes the commands to the session.
+func (s *Session) Send(cmds ...string) {
+    for _, cmd := range cmds {
+        if _, err := fmt.Fprintln(s.in, cmd); err != nil {
+            s.t.Fatalf("send %q: %v", cmd, err)
+        }
+    }
+}
+
+// Expect reads lines until one starts with prefix and returns all lines
+// read so far.
+func (s *Session) Expect(prefix string) []string {
+    var lines []string
+    timeout := time.After(Timeout)
+    for {
+        select {
+        case line, ok := <-s.Lines:
+            if !ok {
+                s.t.Fatalf("session ended while waiting for %q", prefix)
+            }
+            lines = append(lines, line)
+            if strings.HasPrefix(line, prefix) {
+                return lines
+            }
+        case <-timeout:
+            s.t.Fatalf("timeout while waiting for %q, got %q", prefix, lines)
+        }
+    }
+}
+
+// Quit terminates the session and waits until it has finished.
+func (s *Session) Quit() {
+    s.Send("quit")
+    select {
+    case err := <-s.done:
+        if err != nil {
+            s.t.Errorf("session failed: %v", err)
+        }
+    case <-time.After(Timeout):
+        s.t.Fatalf("session didn't terminate")
+    }
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+// Package pool manages the processes of external chess engines, so that
+// several games can be played at once. Processes are started on demand and
+// reused for later searches.
+package pool
+
+import (
+    "context"
+    "github.com/tux21b/ChessBuddy/chess"
+    "log"
+    "sync"
+)
+
+// A Process is a running engine which can search one position at a time.
+type Process interface {
+    chess.Engine
+
+    // Err returns the error which made the process unusable or nil.
+    Err() error
+
+    // Close terminates the process.
+    Close() error
+}
+
+// A Pool runs a limited number of engine processes. It implements
+// chess.Engine.
+type Pool struct {
+    start func() (Process, error)
+
+    mu     sync.Mutex
+    idle   []Process
+    busy   chan bool // limits the number of processes
+    closed bool
+}
+
+// New creates a pool which runs at most size processes created by start.
+func New(size int, start func() (Process, error)) *Pool {
+    if size < 1 {
+        size = 1
+    }
+    return &Pool{start: start, busy: make(chan bool, size)}
+}
+
+// Get returns an idle process or starts a new one. If all processes are
+// busy, Get waits until one of them is returned with Put.
+func (p *Pool) Get(ctx context.Context) (Process, error) {
+    select {
+    case p.busy <- true:
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    }
+    p.mu.Lock()
+    if n := len(p.idle); n > 0 {
+        e := p.idle[n-1]
+        p.idle = p.idle[:n-1]
+        p.mu.Unlock()
+        return e, nil
+    }
+    p.mu.Unlock()
+
+    e, err := p.start()
+    if err != nil {
+        <-p.busy
+        return nil, err
+    }
+    return e, nil
+}
+
+// Put returns a process obtained by Get to the pool. Processes which have
+// failed are terminated.
+func (p *Pool) Put(e Process) {
+    p.mu.Lock()
+    if e.Err() != nil || p.closed {
+        p.mu.Unlock()
+        e.Close()
+    } else {
+        p.idle = append(p.idle, e)
+        p.mu.Unlock()
+    }
+    <-p.busy
+}
+
+// BestMove implements chess.Engine by running the search on one of the
+// processes of the pool. Errors are logged and result in an invalid move.
+func (p *Pool) BestMove(ctx context.Context, b *chess.Board,
+    limits chess.SearchLimits) (chess.Move, chess.Info) {
+    e, err := p.Get(ctx)
+    if err != nil {
+        log.Printf("pool: %v", err)
+        return chess.Move{Src: -1, Dst: -1}, chess.Info{}
+    }
+    defer p.Put(e)
+    return e.BestMove(ctx, b, limits)
+}
+
+// Close terminates all idle processes. Busy processes are terminated as
+// soon as they are returned.
+func (p *Pool) Close() {
+    p.mu.Lock()
+    idle := p.idle
+    p.idle, p.closed = nil, true
+    p.mu.Unlock()
+    for _, e := range idle {
+        e.Close()
+    }
+}
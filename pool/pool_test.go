@@ -0,0 +1,115 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package pool
+
+import (
+    "context"
+    "errors"
+    "github.com/tux21b/ChessBuddy/chess"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// fakeProcess plays the first legal move, or fails if broken is set.
+type fakeProcess struct {
+    broken bool
+    err    error
+    closed *int32
+}
+
+func (f *fakeProcess) BestMove(ctx context.Context, b *chess.Board,
+    limits chess.SearchLimits) (chess.Move, chess.Info) {
+    if f.broken {
+        f.err = errors.New("broken")
+        return chess.Move{Src: -1, Dst: -1}, chess.Info{}
+    }
+    time.Sleep(time.Millisecond)
+    return b.LegalMoves()[0], chess.Info{}
+}
+
+func (f *fakeProcess) Err() error { return f.err }
+
+func (f *fakeProcess) Close() error {
+    atomic.AddInt32(f.closed, 1)
+    return nil
+}
+
+// fakePool creates a pool of fake processes and counts how many of them
+// have been started and closed.
+func fakePool(size int, broken bool) (p *Pool, started, closed *int32) {
+    started, closed = new(int32), new(int32)
+    p = New(size, func() (Process, error) {
+        atomic.AddInt32(started, 1)
+        return &fakeProcess{broken: broken, closed: closed}, nil
+    })
+    return
+}
+
+func TestPool(t *testing.T) {
+    p, started, closed := fakePool(2, false)
+    var wg sync.WaitGroup
+    for i := 0; i < 10; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            b := chess.NewBoard()
+            if m, _ := p.BestMove(context.Background(), b,
+                chess.SearchLimits{}); !b.Legal(m) {
+                t.Errorf("illegal move %v", m)
+            }
+        }()
+    }
+    wg.Wait()
+    if n := atomic.LoadInt32(started); n < 1 || n > 2 {
+        t.Errorf("expected 1 or 2 processes, %d were started", n)
+    }
+
+    // all processes are busy
+    e1, _ := p.Get(context.Background())
+    e2, _ := p.Get(context.Background())
+    ctx, cancel := context.WithTimeout(context.Background(),
+        10*time.Millisecond)
+    defer cancel()
+    if _, err := p.Get(ctx); err != context.DeadlineExceeded {
+        t.Errorf("expected a timeout, got %v", err)
+    }
+    p.Put(e1)
+    p.Close()
+    if n := atomic.LoadInt32(closed); n != 1 {
+        t.Errorf("expected 1 idle process to be closed, got %d", n)
+    }
+    p.Put(e2)
+    if n := atomic.LoadInt32(closed); n != 2 {
+        t.Errorf("processes returned after Close must be closed")
+    }
+}
+
+func TestPoolFailure(t *testing.T) {
+    p, started, closed := fakePool(1, true)
+    for i := 0; i < 2; i++ {
+        if m, _ := p.BestMove(context.Background(), chess.NewBoard(),
+            chess.SearchLimits{}); m.Src >= 0 {
+            t.Errorf("expected an invalid move, got %v", m)
+        }
+    }
+    if *started != 2 || *closed != 2 {
+        t.Errorf("failed processes must not be reused")
+    }
+
+    p = New(1, func() (Process, error) {
+        return nil, errors.New("no such engine")
+    })
+    if _, err := p.Get(context.Background()); err == nil {
+        t.Errorf("expected an error")
+    }
+    // the slot must be released after an error
+    ctx, cancel := context.WithTimeout(context.Background(),
+        10*time.Millisecond)
+    defer cancel()
+    if _, err := p.Get(ctx); err == context.DeadlineExceeded {
+        t.Errorf("failed starts must not occupy the pool")
+    }
+}
@@ -0,0 +1,278 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+// Package uci connects external chess engines which speak the Universal
+// Chess Interface (UCI), e.g. Stockfish, so that they can be used as AI
+// players. Each engine runs as a subprocess and is controlled using its
+// standard input and output.
+package uci
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/tux21b/ChessBuddy/chess"
+    "github.com/tux21b/ChessBuddy/pool"
+    "log"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// ErrNoResponse is returned if the engine didn't answer in time.
+var ErrNoResponse = errors.New("uci: engine not responding")
+
+// An Engine is a running UCI engine process. It implements chess.Engine,
+// but only a single search can be run at once.
+type Engine struct {
+    Name string // name reported by the engine
+
+    mu   sync.Mutex // serializes all commands
+    proc *pool.Cmd
+}
+
+// Start launches the engine executable and performs the UCI handshake.
+func Start(path string, args ...string) (*Engine, error) {
+    proc, err := pool.Command(path, args...)
+    if err != nil {
+        return nil, err
+    }
+    e := &Engine{proc: proc}
+    e.proc.Send("uci")
+    err = e.expect("uciok", func(line string) {
+        if strings.HasPrefix(line, "id name ") {
+            e.Name = strings.TrimPrefix(line, "id name ")
+        }
+    })
+    if err != nil {
+        e.Close()
+        return nil, err
+    }
+    return e, nil
+}
+
+// Err returns the error which made the engine unusable or nil.
+func (e *Engine) Err() error {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    return e.proc.Err()
+}
+
+// expect reads the output of the engine until a line starting with prefix
+// is received. All other lines are passed to handle, if not nil.
+func (e *Engine) expect(prefix string, handle func(line string)) error {
+    timeout := time.After(pool.ResponseTimeout)
+    for e.proc.Err() == nil {
+        select {
+        case line, ok := <-e.proc.Lines:
+            if !ok {
+                e.proc.Fail(pool.ErrExited)
+            } else if strings.HasPrefix(line, prefix) {
+                return nil
+            } else if handle != nil {
+                handle(line)
+            }
+        case <-timeout:
+            e.proc.Fail(ErrNoResponse)
+        }
+    }
+    return e.proc.Err()
+}
+
+// SetOption changes an option of the engine, e.g. "Hash" or "Threads".
+func (e *Engine) SetOption(name, value string) error {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    e.proc.Send("setoption name %s value %s", name, value)
+    e.proc.Send("isready")
+    return e.expect("readyok", nil)
+}
+
+// BestMove implements chess.Engine. Errors are logged and result in an
+// invalid move.
+func (e *Engine) BestMove(ctx context.Context, b *chess.Board,
+    limits chess.SearchLimits) (chess.Move, chess.Info) {
+    m, info, err := e.Search(ctx, b, limits)
+    if err != nil {
+        log.Printf("%s: %v", e.Name, err)
+    }
+    return m, info
+}
+
+// Search lets the engine search the best move in the current position of
+// b. The search is stopped when ctx is cancelled or the remaining time of
+// the player has run out. Progress reports of the engine are passed to
+// limits.Progress.
+func (e *Engine) Search(ctx context.Context, b *chess.Board,
+    limits chess.SearchLimits) (chess.Move, chess.Info, error) {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+
+    if limits.Time > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, limits.Time)
+        defer cancel()
+    }
+    start := time.Now()
+    e.proc.Send("position %s", position(b))
+    e.proc.Send("go %s", goArgs(b, limits))
+
+    var info chess.Info
+    done, timeout := ctx.Done(), (<-chan time.Time)(nil)
+    for e.proc.Err() == nil {
+        select {
+        case line, ok := <-e.proc.Lines:
+            if !ok {
+                e.proc.Fail(pool.ErrExited)
+                break
+            }
+            fields := strings.Fields(line)
+            if len(fields) == 0 {
+                continue
+            }
+            switch fields[0] {
+            case "info":
+                i, ok := parseInfo(b, fields[1:])
+                if !ok {
+                    continue
+                }
+                if i.MultiPV <= 1 {
+                    info = i
+                }
+                if limits.Progress != nil {
+                    limits.Progress(i)
+                }
+            case "bestmove":
+                info.Time = time.Since(start)
+                if len(fields) < 2 {
+                    return chess.Move{Src: -1, Dst: -1}, info, nil
+                }
+                return parseMove(&b.Position, fields[1]), info, nil
+            }
+        case <-done:
+            e.proc.Send("stop")
+            done, timeout = nil, time.After(pool.ResponseTimeout)
+        case <-timeout:
+            e.proc.Fail(ErrNoResponse)
+        }
+    }
+    e.proc.Kill()
+    return chess.Move{Src: -1, Dst: -1}, info, e.proc.Err()
+}
+
+// Close asks the engine to quit and kills it, if it doesn't terminate in
+// time.
+func (e *Engine) Close() error {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    return e.proc.Close()
+}
+
+// position formats the arguments of a "position" command for the board,
+// e.g. "startpos moves e2e4 e7e5".
+func position(b *chess.Board) string {
+    pos := "startpos"
+    if start := b.StartPosition(); start != chess.NewBoard().Position {
+        pos = "fen " + start.String()
+    }
+    if moves := b.History(chess.UCI); len(moves) > 0 {
+        pos += " moves " + strings.Join(moves, " ")
+    }
+    return pos
+}
+
+// goArgs formats the arguments of a "go" command for the limits. The time
+// of the opponent is unknown and assumed to be the same.
+func goArgs(b *chess.Board, limits chess.SearchLimits) string {
+    var args []string
+    if limits.Infinite {
+        args = append(args, "infinite")
+    }
+    if limits.Depth > 0 {
+        args = append(args, fmt.Sprintf("depth %d", limits.Depth))
+    }
+    if limits.Nodes > 0 {
+        args = append(args, fmt.Sprintf("nodes %d", limits.Nodes))
+    }
+    if limits.Time > 0 {
+        ms, inc := limits.Time/time.Millisecond, limits.Inc/time.Millisecond
+        args = append(args, fmt.Sprintf("wtime %d btime %d", ms, ms))
+        if inc > 0 {
+            args = append(args, fmt.Sprintf("winc %d binc %d", inc, inc))
+        }
+        if limits.MovesToGo > 0 {
+            args = append(args, fmt.Sprintf("movestogo %d", limits.MovesToGo))
+        }
+    }
+    if len(args) == 0 {
+        // the same default as the built-in search
+        return "depth 4"
+    }
+    return strings.Join(args, " ")
+}
+
+// parseMove parses a move in the pure coordinate notation. Underpromotions
+// are replaced by queen promotions, since they aren't supported. Illegal
+// moves result in an invalid move.
+func parseMove(p *chess.Position, text string) chess.Move {
+    if len(text) == 5 {
+        text = text[:4]
+    }
+    m, err := chess.ParseMove(text)
+    if err != nil || !p.Legal(m) {
+        return chess.Move{Src: -1, Dst: -1}
+    }
+    return m
+}
+
+// parseInfo parses the arguments of an "info" line. Lines which don't
+// contain a search depth, e.g. "info string", are skipped.
+func parseInfo(b *chess.Board, args []string) (info chess.Info, ok bool) {
+    for i := 0; i+1 < len(args); i++ {
+        key, n := args[i], 0
+        if key == "pv" {
+            p := b.Position
+            for _, text := range args[i+1:] {
+                m := parseMove(&p, text)
+                if m.Src < 0 {
+                    break
+                }
+                info.PV = append(info.PV, m)
+                p = p.Apply(m)
+            }
+            break
+        }
+        if key == "score" && i+2 < len(args) {
+            n, _ = strconv.Atoi(args[i+2])
+            if args[i+1] == "mate" {
+                info.Mate = n
+            } else {
+                info.Score = n
+            }
+            i += 2
+            continue
+        }
+        n, _ = strconv.Atoi(args[i+1])
+        switch key {
+        case "depth":
+            info.Depth, ok = n, true
+        case "seldepth":
+            info.SelDepth = n
+        case "multipv":
+            info.MultiPV = n
+        case "nodes":
+            info.Nodes = n
+        case "nps":
+            info.NPS = n
+        case "time":
+            info.Time = time.Duration(n) * time.Millisecond
+        case "string":
+            return info, false
+        default:
+            continue
+        }
+        i++
+    }
+    return
+}
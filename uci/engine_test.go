@@ -0,0 +1,273 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package uci
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "github.com/tux21b/ChessBuddy/chess"
+    "github.com/tux21b/ChessBuddy/pool"
+    "io"
+    "io/ioutil"
+    "os"
+    "strings"
+    "testing"
+    "time"
+)
+
+// TestHelperProcess isn't a real test. It's started as a subprocess by the
+// other tests and acts as a fake UCI engine, which always plays the first
+// legal move. The behavior can be changed with a mode argument:
+//
+//	normal    answers all commands immediately
+//	infinite  doesn't send the best move before "stop"
+//	crash     exits as soon as it should search
+//	hang      ignores "go" and "stop"
+//	mute      doesn't answer at all
+func TestHelperProcess(t *testing.T) {
+    args := os.Args
+    for len(args) > 0 && args[0] != "--" {
+        args = args[1:]
+    }
+    if len(args) < 2 {
+        return
+    }
+    fakeEngine(os.Stdin, os.Stdout, args[1])
+    os.Exit(0)
+}
+
+func fakeEngine(r io.Reader, w io.Writer, mode string) {
+    if mode == "mute" {
+        io.Copy(ioutil.Discard, r)
+        return
+    }
+    board := chess.NewBoard()
+    scanner := bufio.NewScanner(r)
+    for scanner.Scan() {
+        args := strings.Fields(scanner.Text())
+        if len(args) == 0 {
+            continue
+        }
+        switch args[0] {
+        case "uci":
+            fmt.Fprintln(w, "id name Fake Engine")
+            fmt.Fprintln(w, "id author Nobody")
+            fmt.Fprintln(w, "option name Hash type spin default 1 min 1 max 8")
+            fmt.Fprintln(w, "uciok")
+        case "isready":
+            fmt.Fprintln(w, "readyok")
+        case "position":
+            board = fakePosition(args[1:])
+        case "go":
+            switch mode {
+            case "crash":
+                os.Exit(1)
+            case "hang":
+                continue
+            case "infinite":
+                for scanner.Scan() && scanner.Text() != "stop" {
+                }
+            }
+            moves := board.LegalMoves()
+            if len(moves) == 0 {
+                fmt.Fprintln(w, "bestmove (none)")
+                continue
+            }
+            m := board.FormatMove(moves[0], chess.UCI)
+            fmt.Fprintln(w, "info string thinking hard")
+            fmt.Fprintf(w, "info depth 1 seldepth 2 score cp 15 nodes 20 "+
+                "nps 1000 time 5 pv %s\n", m)
+            fmt.Fprintf(w, "bestmove %s ponder a1a1\n", m)
+        case "quit":
+            return
+        }
+    }
+}
+
+func fakePosition(args []string) *chess.Board {
+    board := chess.NewBoard()
+    i := 1
+    if args[0] == "fen" {
+        for i < len(args) && args[i] != "moves" {
+            i++
+        }
+        board, _ = chess.ParseFEN(strings.Join(args[1:i], " "))
+    }
+    if i < len(args) && args[i] == "moves" {
+        for _, mv := range args[i+1:] {
+            board.MoveText(mv, chess.UCI)
+        }
+    }
+    return board
+}
+
+// startFake starts the test binary as fake engine.
+func startFake(t *testing.T, mode string) *Engine {
+    e, err := Start(os.Args[0], "-test.run=^TestHelperProcess$", "--", mode)
+    if err != nil {
+        t.Fatalf("couldn't start the fake engine: %v", err)
+    }
+    return e
+}
+
+func TestStart(t *testing.T) {
+    e := startFake(t, "normal")
+    if e.Name != "Fake Engine" {
+        t.Errorf("expected the name %q, got %q", "Fake Engine", e.Name)
+    }
+    if err := e.SetOption("Hash", "4"); err != nil {
+        t.Errorf("SetOption failed: %v", err)
+    }
+    if err := e.Close(); err != nil {
+        t.Errorf("Close failed: %v", err)
+    }
+
+    defer func(d time.Duration) {
+        pool.ResponseTimeout = d
+    }(pool.ResponseTimeout)
+    pool.ResponseTimeout = 200 * time.Millisecond
+    if _, err := Start(os.Args[0], "-test.run=^TestHelperProcess$", "--",
+        "mute"); err != ErrNoResponse {
+        t.Errorf("expected ErrNoResponse for a mute engine, got %v", err)
+    }
+}
+
+func TestSearch(t *testing.T) {
+    e := startFake(t, "normal")
+    defer e.Close()
+
+    b, _ := chess.ParseFEN("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+    for _, mv := range strings.Fields("e1g1 e8c8") {
+        b.MoveText(mv, chess.UCI)
+    }
+    progress := 0
+    m, info, err := e.Search(context.Background(), b, chess.SearchLimits{
+        Depth: 3, Progress: func(chess.Info) { progress++ }})
+    if err != nil {
+        t.Fatalf("search failed: %v", err)
+    }
+    if want := b.LegalMoves()[0]; m != want {
+        t.Errorf("expected the move %v, got %v", want, m)
+    }
+    if info.Depth != 1 || info.Score != 15 || info.Nodes != 20 ||
+        len(info.PV) != 1 || info.PV[0] != m {
+        t.Errorf("unexpected info %+v", info)
+    }
+    if progress != 1 {
+        t.Errorf("expected 1 progress report, got %d", progress)
+    }
+
+    // the engine must report that there are no moves
+    b, _ = chess.ParseFEN("7k/6Q1/6K1/8/8/8/8/8 b - - 0 1")
+    if m, _, err := e.Search(context.Background(), b,
+        chess.SearchLimits{}); err != nil || m.Src >= 0 {
+        t.Errorf("expected no move, got %v (%v)", m, err)
+    }
+}
+
+func TestStop(t *testing.T) {
+    e := startFake(t, "infinite")
+    defer e.Close()
+    ctx, cancel := context.WithTimeout(context.Background(),
+        50*time.Millisecond)
+    defer cancel()
+    b := chess.NewBoard()
+    m, _, err := e.Search(ctx, b, chess.SearchLimits{Infinite: true})
+    if err != nil || !b.Legal(m) {
+        t.Errorf("expected a legal move after stop, got %v (%v)", m, err)
+    }
+
+    // the remaining time of the player limits the search as well
+    start := time.Now()
+    m, _, err = e.Search(context.Background(), b,
+        chess.SearchLimits{Time: 100 * time.Millisecond})
+    if err != nil || !b.Legal(m) || time.Since(start) > time.Second {
+        t.Errorf("expected a legal move in time, got %v (%v)", m, err)
+    }
+}
+
+func TestFailures(t *testing.T) {
+    defer func(d time.Duration) {
+        pool.ResponseTimeout = d
+    }(pool.ResponseTimeout)
+    pool.ResponseTimeout = 200 * time.Millisecond
+
+    tests := []struct {
+        mode string
+        err  error
+    }{
+        {"crash", pool.ErrExited},
+        {"hang", ErrNoResponse},
+    }
+    for _, test := range tests {
+        e := startFake(t, test.mode)
+        ctx, cancel := context.WithTimeout(context.Background(),
+            50*time.Millisecond)
+        m, _, err := e.Search(ctx, chess.NewBoard(), chess.SearchLimits{})
+        cancel()
+        if err != test.err || m.Src >= 0 {
+            t.Errorf("%s: expected %v, got %v (%v)", test.mode, test.err, m,
+                err)
+        }
+        if e.Err() != test.err {
+            t.Errorf("%s: expected Err() = %v, got %v", test.mode, test.err,
+                e.Err())
+        }
+        e.Close()
+    }
+}
+
+func TestPosition(t *testing.T) {
+    b := chess.NewBoard()
+    if pos := position(b); pos != "startpos" {
+        t.Errorf("unexpected position %q", pos)
+    }
+    b.MoveText("e2e4", chess.UCI)
+    b.MoveText("e7e5", chess.UCI)
+    if pos := position(b); pos != "startpos moves e2e4 e7e5" {
+        t.Errorf("unexpected position %q", pos)
+    }
+    b, _ = chess.ParseFEN("7k/P7/8/8/8/8/8/K7 w - - 0 1")
+    b.MoveText("a7a8q", chess.UCI)
+    if pos := position(b); pos != "fen 7k/P7/8/8/8/8/8/K7 w - - 0 1 moves a7a8q" {
+        t.Errorf("unexpected position %q", pos)
+    }
+}
+
+func TestGoArgs(t *testing.T) {
+    tests := []struct {
+        limits chess.SearchLimits
+        args   string
+    }{
+        {chess.SearchLimits{}, "depth 4"},
+        {chess.SearchLimits{Depth: 8, Nodes: 1000}, "depth 8 nodes 1000"},
+        {chess.SearchLimits{Infinite: true}, "infinite"},
+        {chess.SearchLimits{Time: time.Minute, Inc: time.Second, MovesToGo: 9},
+            "wtime 60000 btime 60000 winc 1000 binc 1000 movestogo 9"},
+    }
+    for _, test := range tests {
+        if args := goArgs(chess.NewBoard(), test.limits); args != test.args {
+            t.Errorf("goArgs(%+v) = %q, want %q", test.limits, args, test.args)
+        }
+    }
+}
+
+func TestParseInfo(t *testing.T) {
+    b := chess.NewBoard()
+    info, ok := parseInfo(b, strings.Fields("depth 12 seldepth 18 multipv 2 "+
+        "score mate -3 lowerbound nodes 123456 nps 654321 hashfull 10 "+
+        "time 250 pv e2e4 e7e5 g1f3 x9x9"))
+    if !ok || info.Depth != 12 || info.SelDepth != 18 || info.MultiPV != 2 ||
+        info.Mate != -3 || info.Nodes != 123456 || info.NPS != 654321 ||
+        info.Time != 250*time.Millisecond || len(info.PV) != 3 {
+        t.Errorf("unexpected info %+v", info)
+    }
+    if _, ok := parseInfo(b, strings.Fields("string depth 3")); ok {
+        t.Errorf("info strings must be skipped")
+    }
+    if _, ok := parseInfo(b, strings.Fields("currmove e2e4 currmovenumber 1")); ok {
+        t.Errorf("info lines without depth must be skipped")
+    }
+}
@@ -0,0 +1,27 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package uci
+
+import (
+    "github.com/tux21b/ChessBuddy/pool"
+)
+
+// NewPool creates a pool which runs at most size processes of the engine
+// executable. The UCI options are set on each new process.
+func NewPool(size int, options map[string]string, path string,
+    args ...string) *pool.Pool {
+    return pool.New(size, func() (pool.Process, error) {
+        e, err := Start(path, args...)
+        if err != nil {
+            return nil, err
+        }
+        for name, value := range options {
+            if err := e.SetOption(name, value); err != nil {
+                e.Close()
+                return nil, err
+            }
+        }
+        return e, nil
+    })
+}
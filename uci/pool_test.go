@@ -0,0 +1,47 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package uci
+
+import (
+    "context"
+    "github.com/tux21b/ChessBuddy/chess"
+    "os"
+    "sync"
+    "testing"
+)
+
+func TestPool(t *testing.T) {
+    p := NewPool(2, map[string]string{"Hash": "2"}, os.Args[0],
+        "-test.run=^TestHelperProcess$", "--", "normal")
+    defer p.Close()
+
+    var wg sync.WaitGroup
+    for i := 0; i < 6; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            b := chess.NewBoard()
+            if m, _ := p.BestMove(context.Background(), b,
+                chess.SearchLimits{}); !b.Legal(m) {
+                t.Errorf("illegal move %v", m)
+            }
+        }()
+    }
+    wg.Wait()
+}
+
+func TestPoolFailure(t *testing.T) {
+    p := NewPool(1, nil, os.Args[0], "-test.run=^TestHelperProcess$", "--",
+        "crash")
+    defer p.Close()
+    if m, _ := p.BestMove(context.Background(), chess.NewBoard(),
+        chess.SearchLimits{}); m.Src >= 0 {
+        t.Errorf("expected an invalid move from a crashed engine, got %v", m)
+    }
+
+    p = NewPool(1, map[string]string{"Hash": "2"}, "/nonexistent/engine")
+    if _, err := p.Get(context.Background()); err == nil {
+        t.Errorf("expected an error for a missing executable")
+    }
+}
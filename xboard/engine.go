@@ -0,0 +1,352 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+// Package xboard connects external chess engines which speak the Chess
+// Engine Communication Protocol (CECP) used by XBoard and WinBoard, e.g.
+// GNU Chess or Crafty, so that they can be used as AI players.
+package xboard
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/tux21b/ChessBuddy/chess"
+    "github.com/tux21b/ChessBuddy/pool"
+    "log"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+var (
+    // ErrNoResponse is returned if the engine didn't answer in time.
+    ErrNoResponse = errors.New("xboard: engine not responding")
+
+    // ErrResigned is returned if the engine resigned instead of moving.
+    ErrResigned = errors.New("xboard: engine resigned")
+
+    // ErrNoSetboard is returned if the game didn't start from the initial
+    // position and the engine doesn't support the setboard command.
+    ErrNoSetboard = errors.New("xboard: setboard not supported")
+)
+
+// featureTimeout is the time an engine may take to announce its features.
+// Engines which only speak version 1 of the protocol don't announce any.
+var featureTimeout = 2 * time.Second
+
+// An Engine is a running CECP engine process. It implements chess.Engine,
+// but only a single search can be run at once.
+type Engine struct {
+    Name string // name announced by the engine or ""
+
+    mu       sync.Mutex // serializes all commands
+    proc     *pool.Cmd
+    usermove bool // moves must be prefixed with "usermove"
+    setboard bool // the engine supports setboard
+}
+
+// Start launches the engine executable and negotiates the features of
+// version 2 of the protocol.
+func Start(path string, args ...string) (*Engine, error) {
+    proc, err := pool.Command(path, args...)
+    if err != nil {
+        return nil, err
+    }
+    e := &Engine{proc: proc}
+    e.proc.Send("xboard")
+    e.proc.Send("protover 2")
+    if err := e.negotiate(); err != nil {
+        e.Close()
+        return nil, err
+    }
+    return e, nil
+}
+
+// negotiate processes the feature commands of the engine until it sends
+// "done=1" or the feature timeout expires.
+func (e *Engine) negotiate() error {
+    timeout := time.After(featureTimeout)
+    for e.proc.Err() == nil {
+        select {
+        case line, ok := <-e.proc.Lines:
+            if !ok {
+                e.proc.Fail(pool.ErrExited)
+                break
+            }
+            if !strings.HasPrefix(line, "feature ") {
+                continue
+            }
+            for _, f := range parseFeatures(line[len("feature "):]) {
+                switch f.name {
+                case "done":
+                    if f.value == "1" {
+                        return nil
+                    }
+                    // the engine needs more time to start up
+                    timeout = time.After(pool.ResponseTimeout)
+                    continue
+                case "myname":
+                    e.Name = f.value
+                case "usermove":
+                    e.usermove = f.value == "1"
+                case "setboard":
+                    e.setboard = f.value == "1"
+                case "ping", "sigint", "sigterm", "colors", "reuse",
+                    "san", "time", "draw", "analyze", "variants":
+                default:
+                    e.proc.Send("rejected %s", f.name)
+                    continue
+                }
+                e.proc.Send("accepted %s", f.name)
+            }
+        case <-timeout:
+            return nil
+        }
+    }
+    return e.proc.Err()
+}
+
+// A feature is a name=value pair of a feature command.
+type feature struct {
+    name, value string
+}
+
+// parseFeatures splits the arguments of a feature command. Values may be
+// enclosed in double quotes.
+func parseFeatures(args string) (features []feature) {
+    for {
+        args = strings.TrimLeft(args, " ")
+        eq := strings.IndexByte(args, '=')
+        if eq < 0 {
+            return
+        }
+        f, rest := feature{name: args[:eq]}, args[eq+1:]
+        if strings.HasPrefix(rest, "\"") {
+            rest = rest[1:]
+            if end := strings.IndexByte(rest, '"'); end >= 0 {
+                f.value, args = rest[:end], rest[end+1:]
+            } else {
+                f.value, args = rest, ""
+            }
+        } else if sp := strings.IndexByte(rest, ' '); sp >= 0 {
+            f.value, args = rest[:sp], rest[sp:]
+        } else {
+            f.value, args = rest, ""
+        }
+        features = append(features, f)
+    }
+}
+
+// Err returns the error which made the engine unusable or nil.
+func (e *Engine) Err() error {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    return e.proc.Err()
+}
+
+// BestMove implements chess.Engine. Errors are logged and result in an
+// invalid move.
+func (e *Engine) BestMove(ctx context.Context, b *chess.Board,
+    limits chess.SearchLimits) (chess.Move, chess.Info) {
+    m, info, err := e.Search(ctx, b, limits)
+    if err != nil {
+        log.Printf("%s: %v", e.Name, err)
+    }
+    return m, info
+}
+
+// Search sets up the game of b in force mode and lets the engine move. The
+// engine is asked to move immediately when ctx is cancelled or the
+// remaining time of the player has run out. The thinking output of the
+// engine is passed to limits.Progress.
+func (e *Engine) Search(ctx context.Context, b *chess.Board,
+    limits chess.SearchLimits) (chess.Move, chess.Info, error) {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    invalid := chess.Move{Src: -1, Dst: -1}
+    if err := e.proc.Err(); err != nil {
+        return invalid, chess.Info{}, err
+    }
+    if limits.Time > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, limits.Time)
+        defer cancel()
+    }
+
+    e.proc.Send("new")
+    e.proc.Send("force")
+    e.proc.Send("post")
+    if start := b.StartPosition(); start != chess.NewBoard().Position {
+        if !e.setboard {
+            return invalid, chess.Info{}, ErrNoSetboard
+        }
+        e.proc.Send("setboard %v", start)
+    }
+    for _, mv := range b.History(chess.UCI) {
+        if e.usermove {
+            e.proc.Send("usermove %s", mv)
+        } else {
+            e.proc.Send("%s", mv)
+        }
+    }
+    for _, cmd := range timeControl(limits) {
+        e.proc.Send("%s", cmd)
+    }
+    start := time.Now()
+    e.proc.Send("go")
+
+    var info chess.Info
+    done, timeout := ctx.Done(), (<-chan time.Time)(nil)
+    for e.proc.Err() == nil {
+        select {
+        case line, ok := <-e.proc.Lines:
+            if !ok {
+                e.proc.Fail(pool.ErrExited)
+                break
+            }
+            fields := strings.Fields(line)
+            switch {
+            case len(fields) == 0:
+            case fields[0] == "move" && len(fields) == 2,
+                len(fields) == 4 && fields[0] == "My" && fields[2] == "is:":
+                // the second form is used by version 1 engines
+                e.proc.Send("force")
+                info.Time = time.Since(start)
+                m := parseMove(&b.Position, fields[len(fields)-1])
+                if m.Src < 0 {
+                    return invalid, info, fmt.Errorf(
+                        "xboard: invalid move %q", fields[len(fields)-1])
+                }
+                return m, info, nil
+            case fields[0] == "resign":
+                e.proc.Send("force")
+                return invalid, info, ErrResigned
+            case fields[0] == "Error" || strings.HasPrefix(line, "Illegal move"):
+                // the engine didn't accept the position and might still
+                // reply to "go", so the process can't be reused
+                e.proc.Fail(fmt.Errorf("xboard: %s", line))
+            default:
+                if i, ok := parseThinking(b, fields); ok {
+                    info = i
+                    if limits.Progress != nil {
+                        limits.Progress(i)
+                    }
+                }
+            }
+        case <-done:
+            e.proc.Send("?")
+            done, timeout = nil, time.After(pool.ResponseTimeout)
+        case <-timeout:
+            e.proc.Fail(ErrNoResponse)
+        }
+    }
+    e.proc.Kill()
+    return invalid, info, e.proc.Err()
+}
+
+// Close asks the engine to quit and kills it, if it doesn't terminate in
+// time.
+func (e *Engine) Close() error {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    return e.proc.Close()
+}
+
+// NewPool creates a pool which runs at most size processes of the engine
+// executable.
+func NewPool(size int, path string, args ...string) *pool.Pool {
+    return pool.New(size, func() (pool.Process, error) {
+        e, err := Start(path, args...)
+        if err != nil {
+            return nil, err
+        }
+        return e, nil
+    })
+}
+
+// timeControl returns the commands which set up the limits. The time of
+// the opponent is unknown and assumed to be the same.
+func timeControl(limits chess.SearchLimits) (cmds []string) {
+    if limits.Depth > 0 {
+        cmds = append(cmds, fmt.Sprintf("sd %d", limits.Depth))
+    }
+    if limits.Time > 0 {
+        sec := int(limits.Time / time.Second)
+        cmds = append(cmds,
+            fmt.Sprintf("level %d %d:%02d %d", limits.MovesToGo, sec/60,
+                sec%60, int(limits.Inc/time.Second)),
+            fmt.Sprintf("time %d", limits.Time/(10*time.Millisecond)),
+            fmt.Sprintf("otim %d", limits.Time/(10*time.Millisecond)))
+    }
+    if len(cmds) == 0 {
+        // the same default as the built-in search
+        cmds = append(cmds, "sd 4")
+    }
+    return
+}
+
+// parseMove parses a move in the coordinate notation, e.g. "e2e4", or the
+// standard algebraic notation, e.g. "Nf3" or "O-O". Underpromotions are
+// replaced by queen promotions, since they aren't supported. Illegal moves
+// result in an invalid move.
+func parseMove(p *chess.Position, text string) chess.Move {
+    coord := text
+    if len(coord) == 5 && coord[4] >= 'a' && coord[4] <= 'z' {
+        coord = coord[:4]
+    }
+    if m, err := chess.ParseMove(coord); err == nil && p.Legal(m) {
+        return m
+    }
+    san := normalizeSAN(text)
+    for _, m := range p.LegalMoves() {
+        if normalizeSAN(p.FormatMove(m, chess.SAN)) == san {
+            return m
+        }
+    }
+    return chess.Move{Src: -1, Dst: -1}
+}
+
+// normalizeSAN removes annotations and the promotion piece from a move in
+// the standard algebraic notation.
+func normalizeSAN(text string) string {
+    text = strings.Replace(strings.TrimRight(text, "+#!?"), "O", "0", -1)
+    if i := strings.IndexByte(text, '='); i >= 0 {
+        text = text[:i]
+    }
+    return text
+}
+
+// parseThinking parses a line of thinking output, which consists of the
+// depth, the score in centipawns, the time in centiseconds, the number of
+// nodes and the principal variation.
+func parseThinking(b *chess.Board, fields []string) (info chess.Info,
+    ok bool) {
+    if len(fields) < 4 {
+        return info, false
+    }
+    var nums [4]int
+    for i := range nums {
+        n, err := strconv.Atoi(strings.TrimRight(fields[i], ".&"))
+        if err != nil {
+            return info, false
+        }
+        nums[i] = n
+    }
+    info.Depth, info.Score = nums[0], nums[1]
+    info.Time = time.Duration(nums[2]) * 10 * time.Millisecond
+    info.Nodes = nums[3]
+    p := b.Position
+    for _, text := range fields[4:] {
+        if strings.HasSuffix(text, ".") {
+            continue // move numbers
+        }
+        m := parseMove(&p, text)
+        if m.Src < 0 {
+            break
+        }
+        info.PV = append(info.PV, m)
+        p = p.Apply(m)
+    }
+    return info, true
+}
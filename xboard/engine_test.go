@@ -0,0 +1,250 @@
+// Copyright (c) 2012 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package xboard
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "github.com/tux21b/ChessBuddy/chess"
+    "github.com/tux21b/ChessBuddy/pool"
+    "io"
+    "os"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// TestHelperProcess isn't a real test. It's started as a subprocess by the
+// other tests and acts as a fake CECP engine, which always plays the first
+// legal move. The behavior can be changed with a mode argument:
+//
+//	v2      negotiates usermove and setboard
+//	v1      doesn't send any features and uses "My move is:"
+//	san     negotiates usermove, but sends moves using SAN
+//	slow    waits for "?" before moving
+//	hang    ignores "go" and "?"
+//	resign  resigns instead of moving
+//	reject  rejects all moves of the opponent
+func TestHelperProcess(t *testing.T) {
+    args := os.Args
+    for len(args) > 0 && args[0] != "--" {
+        args = args[1:]
+    }
+    if len(args) < 2 {
+        return
+    }
+    fakeEngine(os.Stdin, os.Stdout, args[1])
+    os.Exit(0)
+}
+
+func fakeEngine(r io.Reader, w io.Writer, mode string) {
+    board := chess.NewBoard()
+    scanner := bufio.NewScanner(r)
+    for scanner.Scan() {
+        args := strings.Fields(scanner.Text())
+        if len(args) == 0 {
+            continue
+        }
+        switch args[0] {
+        case "protover":
+            if mode != "v1" {
+                fmt.Fprintln(w, "feature done=0")
+                fmt.Fprintln(w, `feature myname="Fake Engine" usermove=1`)
+                fmt.Fprintln(w, "feature setboard=1 nps=1 done=1")
+            }
+        case "new":
+            board = chess.NewBoard()
+        case "setboard":
+            board, _ = chess.ParseFEN(strings.Join(args[1:], " "))
+        case "usermove":
+            if mode == "reject" {
+                fmt.Fprintf(w, "Illegal move: %s\n", args[1])
+            } else {
+                board.MoveText(args[1], chess.UCI)
+            }
+        case "go":
+            switch mode {
+            case "hang":
+                continue
+            case "resign":
+                fmt.Fprintln(w, "resign")
+                continue
+            case "slow":
+                for scanner.Scan() && scanner.Text() != "?" {
+                }
+            }
+            m := board.LegalMoves()[0]
+            text := board.FormatMove(m, chess.UCI)
+            fmt.Fprintf(w, "1 15 3 20 %s\n", text)
+            switch mode {
+            case "v1":
+                fmt.Fprintf(w, "My move is: %s\n", text)
+            case "san":
+                fmt.Fprintf(w, "move %s\n", board.FormatMove(m, chess.SAN))
+            default:
+                fmt.Fprintf(w, "move %s\n", text)
+            }
+            board.Move(m.Src, m.Dst)
+        case "quit":
+            return
+        default:
+            // bare moves of version 1
+            if mode == "v1" {
+                board.MoveText(args[0], chess.UCI)
+            }
+        }
+    }
+}
+
+func startFake(t *testing.T, mode string) *Engine {
+    e, err := Start(os.Args[0], "-test.run=^TestHelperProcess$", "--", mode)
+    if err != nil {
+        t.Fatalf("couldn't start the fake engine: %v", err)
+    }
+    return e
+}
+
+func TestSearch(t *testing.T) {
+    defer func(d time.Duration) { featureTimeout = d }(featureTimeout)
+    featureTimeout = 100 * time.Millisecond
+
+    for _, mode := range []string{"v2", "v1", "san"} {
+        e := startFake(t, mode)
+        if name := e.Name; (name == "Fake Engine") != (mode != "v1") {
+            t.Errorf("%s: unexpected name %q", mode, name)
+        }
+        b := chess.NewBoard()
+        for _, mv := range strings.Fields("e2e4 e7e5 g1f3") {
+            b.MoveText(mv, chess.UCI)
+        }
+        progress := 0
+        m, info, err := e.Search(context.Background(), b, chess.SearchLimits{
+            Progress: func(chess.Info) { progress++ }})
+        if want := b.LegalMoves()[0]; err != nil || m != want {
+            t.Errorf("%s: expected %v, got %v (%v)", mode, want, m, err)
+        }
+        if info.Depth != 1 || info.Score != 15 || info.Nodes != 20 ||
+            len(info.PV) != 1 || progress != 1 {
+            t.Errorf("%s: unexpected info %+v", mode, info)
+        }
+        e.Close()
+    }
+}
+
+func TestSetboard(t *testing.T) {
+    b, _ := chess.ParseFEN("4k3/8/8/3q4/8/2N5/8/4K3 w - - 0 1")
+    e := startFake(t, "v2")
+    m, _, err := e.Search(context.Background(), b, chess.SearchLimits{})
+    if want := b.LegalMoves()[0]; err != nil || m != want {
+        t.Errorf("expected %v, got %v (%v)", want, m, err)
+    }
+    e.Close()
+
+    defer func(d time.Duration) { featureTimeout = d }(featureTimeout)
+    featureTimeout = 100 * time.Millisecond
+    e = startFake(t, "v1")
+    if _, _, err := e.Search(context.Background(), b,
+        chess.SearchLimits{}); err != ErrNoSetboard {
+        t.Errorf("expected ErrNoSetboard, got %v", err)
+    }
+    e.Close()
+}
+
+func TestFailures(t *testing.T) {
+    defer func(d time.Duration) {
+        pool.ResponseTimeout = d
+    }(pool.ResponseTimeout)
+    pool.ResponseTimeout = 200 * time.Millisecond
+
+    b := chess.NewBoard()
+    b.MoveText("e2e4", chess.UCI)
+    for _, mode := range []string{"slow", "hang", "resign", "reject"} {
+        e := startFake(t, mode)
+        ctx, cancel := context.WithTimeout(context.Background(),
+            50*time.Millisecond)
+        m, _, err := e.Search(ctx, b, chess.SearchLimits{})
+        cancel()
+        switch mode {
+        case "slow":
+            if err != nil || !b.Legal(m) {
+                t.Errorf("slow: expected a move after ?, got %v (%v)", m, err)
+            }
+        case "hang":
+            if err != ErrNoResponse || e.Err() != ErrNoResponse {
+                t.Errorf("hang: expected ErrNoResponse, got %v", err)
+            }
+        case "resign":
+            if err != ErrResigned || m.Src >= 0 || e.Err() != nil {
+                t.Errorf("resign: expected ErrResigned, got %v (%v)", m, err)
+            }
+        case "reject":
+            if err == nil || m.Src >= 0 || e.Err() == nil {
+                t.Errorf("reject: expected a failed engine, got %v", m)
+            }
+        }
+        e.Close()
+    }
+}
+
+func TestPool(t *testing.T) {
+    p := NewPool(2, os.Args[0], "-test.run=^TestHelperProcess$", "--", "v2")
+    defer p.Close()
+    var wg sync.WaitGroup
+    for i := 0; i < 4; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            b := chess.NewBoard()
+            if m, _ := p.BestMove(context.Background(), b,
+                chess.SearchLimits{Depth: 2}); !b.Legal(m) {
+                t.Errorf("illegal move %v", m)
+            }
+        }()
+    }
+    wg.Wait()
+}
+
+func TestParseFeatures(t *testing.T) {
+    got := parseFeatures(`myname="Foo Bar 1.0" usermove=1  done=1 x="unterminated`)
+    want := []feature{{"myname", "Foo Bar 1.0"}, {"usermove", "1"},
+        {"done", "1"}, {"x", "unterminated"}}
+    if fmt.Sprint(got) != fmt.Sprint(want) {
+        t.Errorf("parseFeatures = %v, want %v", got, want)
+    }
+}
+
+func TestParseMove(t *testing.T) {
+    b, _ := chess.ParseFEN("r3k3/1P6/8/8/8/8/8/R3K2R w KQ - 0 1")
+    tests := []struct {
+        text string
+        want chess.Move
+    }{
+        {"e1g1", chess.Move{Src: chess.Sq("e1"), Dst: chess.Sq("g1")}},
+        {"O-O-O", chess.Move{Src: chess.Sq("e1"), Dst: chess.Sq("c1")}},
+        {"Rxa8+", chess.Move{Src: chess.Sq("a1"), Dst: chess.Sq("a8")}},
+        {"b8=Q+", chess.Move{Src: chess.Sq("b7"), Dst: chess.Sq("b8")}},
+        {"b7b8n", chess.Move{Src: chess.Sq("b7"), Dst: chess.Sq("b8")}},
+        {"Kf8", chess.Move{Src: -1, Dst: -1}},
+    }
+    for _, test := range tests {
+        if m := parseMove(&b.Position, test.text); m != test.want {
+            t.Errorf("parseMove(%q) = %v, want %v", test.text, m, test.want)
+        }
+    }
+}
+
+func TestParseThinking(t *testing.T) {
+    b := chess.NewBoard()
+    info, ok := parseThinking(b, strings.Fields("9 -35 120 123456 1. e4 e5 2. Nf3"))
+    if !ok || info.Depth != 9 || info.Score != -35 ||
+        info.Time != 1200*time.Millisecond || info.Nodes != 123456 ||
+        len(info.PV) != 3 {
+        t.Errorf("unexpected info %+v", info)
+    }
+    if _, ok := parseThinking(b, strings.Fields("Illegal move: e2e5")); ok {
+        t.Errorf("expected an error")
+    }
+}